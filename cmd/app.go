@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+
+	gokitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/jackc/pgx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	postgresadapter "github.com/jnikolaeva/eshop-common/postgres"
+	"github.com/jnikolaeva/eshop-common/uuid"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/bulk"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/cache"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/duplicate"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/identity"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/postgres"
+)
+
+// app holds the dependencies shared by the server and the admin commands.
+type app struct {
+	logger           *logrus.Logger
+	connPool         *pgx.ConnPool
+	events           *application.EventDispatcher
+	repository       application.Repository
+	identityProvider application.IdentityProvider
+	service          application.Service
+	webhooks         *application.Webhooks
+	preferences      *application.PreferencesService
+	organizations    *application.Organizations
+	duplicates       *application.Duplicates
+	attributes       *application.Attributes
+	tags             *application.Tags
+	segments         *application.Segments
+	exporter         *application.Exporter
+	closeCache       func()
+}
+
+func newApp(logger *logrus.Logger) (*app, error) {
+	identityConfig, err := identity.ParseEnvConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+	cacheConfig, err := cache.ParseEnvConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+	duplicateConfig, err := duplicate.ParseEnvConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+	exportConfig, err := bulk.ParseEnvConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+
+	connConfig, err := postgresadapter.ParseEnvConfig(appName)
+	if err != nil {
+		return nil, err
+	}
+	poolCollector := postgres.NewPoolCollector("customer")
+	connConfig.Logger = poolCollector.Logger(logger)
+	connConfig.LogLevel = pgx.LogLevelWarn
+	connectionPool, err := postgresadapter.NewConnectionPool(connConfig)
+	if err != nil {
+		return nil, err
+	}
+	poolCollector.SetPool(connectionPool)
+	prometheus.MustRegister(poolCollector)
+
+	events := application.NewEventDispatcher()
+	repository, closeCache, err := newRepository(cacheConfig, connectionPool, events, logger)
+	if err != nil {
+		connectionPool.Close()
+		return nil, err
+	}
+	identityMetrics := identity.NewMetrics(
+		gokitprometheus.NewCounterFrom(prometheus.CounterOpts{
+			Namespace: "customer",
+			Subsystem: "idp",
+			Name:      "request_count",
+			Help:      "Number of identity provider calls by outcome.",
+		}, []string{"operation", "outcome"}),
+		gokitprometheus.NewHistogramFrom(prometheus.HistogramOpts{
+			Namespace: "customer",
+			Subsystem: "idp",
+			Name:      "request_latency_seconds",
+			Help:      "Total duration of identity provider calls in seconds, including retries.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"operation"}))
+	identityProvider := newIdentityProvider(identityConfig, identityMetrics, connectionPool, logger)
+
+	organizationRepository := postgres.NewOrganizationRepository(connectionPool)
+	attributeRepository := postgres.NewAttributeRepository(connectionPool)
+	service := application.NewService(repository, identityProvider, events)
+	service = application.NewAuthService(service, repository, organizationRepository, attributeRepository)
+	service = application.NewInstrumentingService(service, newServiceMetrics())
+	service = application.NewTracingService(service)
+
+	// deliveries are written in the transaction of every customer write, only serve dispatches them
+	webhooks := application.NewWebhooks(postgres.NewWebhookRepository(connectionPool))
+
+	// the merge is committed when the identity of the merged customer is deleted, so a failure only leaves the identity
+	// behind, for the reconciliation with the identity provider to find
+	events.Subscribe(application.EventHandlerFunc(func(ctx context.Context, event application.Event) {
+		if event.EventType() != application.EventTypeCustomersMerged {
+			return
+		}
+		if err := identityProvider.Delete(ctx, uuid.UUID(event.CustomerID())); err != nil {
+			logger.WithError(err).WithField("customer", event.CustomerID().String()).Error("failed to delete the identity of the merged customer")
+		}
+	}))
+
+	// the preferences of a registration in the API follow its Accept-Language header, the others get the defaults when read
+	preferences := application.NewPreferencesService(postgres.NewPreferencesRepository(connectionPool), repository)
+	events.Subscribe(application.EventHandlerFunc(func(ctx context.Context, event application.Event) {
+		if event.EventType() != application.EventTypeCustomerRegistered {
+			return
+		}
+		if err := preferences.InitializeDefaults(ctx, event.CustomerID(), application.GetAcceptLanguage(ctx)); err != nil {
+			logger.WithError(err).WithField("customer", event.CustomerID().String()).Error("failed to initialize preferences")
+		}
+	}))
+
+	// registrations and profile changes are scored against the customers they share an email, a phone or a name with
+	duplicates := application.NewDuplicates(postgres.NewDuplicateRepository(connectionPool), repository, duplicateConfig.Settings())
+	events.Subscribe(application.EventHandlerFunc(func(ctx context.Context, event application.Event) {
+		var customer application.Customer
+		switch e := event.(type) {
+		case application.CustomerRegistered:
+			customer = e.Customer
+		case application.CustomerUpdated:
+			customer = e.Customer
+		default:
+			return
+		}
+		pairs, err := duplicates.Check(ctx, customer)
+		if err != nil {
+			logger.WithError(err).WithField("customer", customer.ID.String()).Error("failed to check for duplicates")
+			return
+		}
+		for _, pair := range pairs {
+			if duplicates.Flagged(pair) {
+				logger.WithFields(logrus.Fields{
+					"customer":  customer.ID.String(),
+					"candidate": pair.CandidateID.String(),
+					"score":     pair.Score,
+				}).Info("likely duplicate customer")
+			}
+		}
+	}))
+
+	// segment members follow the changes of profiles, attributes, statuses and tags; the merged customer left its
+	// segments with its deletion. Customers are read past the cache, which may still hold them from before the change
+	// and would take in every customer of a rebuild.
+	tagRepository := postgres.NewTagRepository(connectionPool)
+	segments := application.NewSegments(postgres.NewSegmentRepository(connectionPool), postgres.New(connectionPool), tagRepository, attributeRepository)
+	events.Subscribe(application.EventHandlerFunc(func(ctx context.Context, event application.Event) {
+		id := event.CustomerID()
+		switch e := event.(type) {
+		case application.CustomerRegistered, application.CustomerUpdated, application.CustomerStatusChanged, application.CustomerTagsChanged:
+		case application.CustomersMerged:
+			id = e.Survivor.ID
+		default:
+			return
+		}
+		if err := segments.Evaluate(ctx, id); err != nil {
+			logger.WithError(err).WithField("customer", id.String()).Error("failed to evaluate segments")
+		}
+	}))
+
+	return &app{
+		logger:           logger,
+		connPool:         connectionPool,
+		events:           events,
+		repository:       repository,
+		identityProvider: identityProvider,
+		service:          service,
+		webhooks:         webhooks,
+		preferences:      preferences,
+		organizations:    application.NewOrganizations(organizationRepository, repository),
+		duplicates:       duplicates,
+		attributes:       application.NewAttributes(attributeRepository, repository, events),
+		tags:             application.NewTags(tagRepository, repository, events),
+		segments:         segments,
+		exporter:         application.NewExporter(repository, []byte(exportConfig.HashKey)),
+		closeCache:       closeCache,
+	}, nil
+}
+
+func (a *app) close() {
+	a.closeCache()
+	a.connPool.Close()
+}
+
+func newServiceMetrics() *application.Metrics {
+	counter := func(name, help string, labels ...string) *gokitprometheus.Counter {
+		return gokitprometheus.NewCounterFrom(prometheus.CounterOpts{
+			Namespace: "customer",
+			Name:      name,
+			Help:      help,
+		}, labels)
+	}
+	return &application.Metrics{
+		Registrations: counter("registrations_total", "Number of customer registrations by outcome.", "outcome"),
+		Updates:       counter("updates_total", "Number of customer profile updates by outcome.", "outcome"),
+		Failures:      counter("failures_total", "Number of failed customer operations by error type.", "operation", "error"),
+		Compensations: counter("registration_compensations_total", "Number of identities deleted after a failed registration, by outcome.", "outcome"),
+		IdPFailures:   counter("idp_failures_total", "Number of failed identity provider operations during registration, by error type.", "error"),
+		FunnelSteps:   counter("registration_funnel_steps_total", "Number of registrations that reached a funnel step.", "step"),
+		StatusChanges: counter("status_changes_total", "Number of account status changes by target status and outcome.", "status", "outcome"),
+	}
+}
+
+// newRepository decorates the postgres repository with a cache subscribed to customer events.
+func newRepository(config cache.Config, connPool *pgx.ConnPool, events *application.EventDispatcher, logger *logrus.Logger) (application.Repository, func(), error) {
+	repository := postgres.New(connPool)
+	var store cache.Store
+	closeStore := func() {}
+	switch config.Backend {
+	case cache.BackendNone:
+		return repository, closeStore, nil
+	case cache.BackendRedis:
+		client, err := cache.NewRedisClient(config.RedisURL)
+		if err != nil {
+			return nil, nil, err
+		}
+		store = cache.NewRedisStore(client)
+		closeStore = func() { _ = client.Close() }
+	default:
+		store = cache.NewMemoryStore(config.Size)
+	}
+	cachingRepository := cache.NewRepository(repository, store, config.TTL, logger)
+	events.Subscribe(cachingRepository)
+	return cachingRepository, closeStore, nil
+}
+
+func newIdentityProvider(config identity.Config, metrics *identity.Metrics, connPool *pgx.ConnPool, logger logrus.FieldLogger) application.IdentityProvider {
+	switch config.Backend {
+	case identity.BackendKeycloak:
+		return identity.NewKeycloakProvider(config, metrics, logger)
+	case identity.BackendLocal:
+		return identity.NewLocalProvider(config.Local, postgres.NewCredentialStore(connPool))
+	default:
+		return identity.NewProviderProxy(config, metrics, logger)
+	}
+}
@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+type customerView struct {
+	ID        string `json:"id"`
+	FirstName string `json:"firstName,omitempty"`
+	LastName  string `json:"lastName,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+	Status    string `json:"status"`
+}
+
+func toCustomerView(customer application.Customer) customerView {
+	return customerView{
+		ID:        customer.ID.String(),
+		FirstName: customer.FirstName,
+		LastName:  customer.LastName,
+		Email:     customer.Email,
+		Phone:     customer.Phone,
+		Status:    customer.Status,
+	}
+}
+
+func writeJSON(w io.Writer, v interface{}) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
+
+func runCustomer(logger *logrus.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: customer get <id> | find <email> | update [flags] <id> | close [-yes] <id> | status [flags] <id> <status> | merge [-yes] <survivor-id> <merged-id>")
+		return exitUsage
+	}
+	subcommand, args := args[0], args[1:]
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer a.close()
+	ctx := application.WithAdmin(context.Background())
+
+	switch subcommand {
+	case "get":
+		err = customerGet(ctx, a.service, args)
+	case "find":
+		err = customerFind(ctx, a.service, args)
+	case "update":
+		err = customerUpdate(ctx, a.service, args)
+	case "close":
+		err = customerClose(ctx, a.service, args)
+	case "status":
+		err = customerStatus(ctx, a.service, args)
+	case "merge":
+		err = customerMerge(ctx, a.service, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown customer command: %s\n", subcommand)
+		return exitUsage
+	}
+	if err == flag.ErrHelp || err == errUsage {
+		return exitUsage
+	}
+	if err != nil {
+		logger.WithError(err).Error("command failed")
+		return exitFailure
+	}
+	return exitOK
+}
+
+func customerGet(ctx context.Context, service application.Service, args []string) error {
+	id, err := parseIDArg(args)
+	if err != nil {
+		return err
+	}
+	customer, err := service.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	return writeJSON(os.Stdout, toCustomerView(*customer))
+}
+
+func customerFind(ctx context.Context, service application.Service, args []string) error {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "Usage: customer find <email>")
+		return errUsage
+	}
+	customers, err := service.FindByEmail(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	views := make([]customerView, 0, len(customers))
+	for _, customer := range customers {
+		views = append(views, toCustomerView(customer))
+	}
+	return writeJSON(os.Stdout, views)
+}
+
+// customerUpdate changes only the given fields.
+func customerUpdate(ctx context.Context, service application.Service, args []string) error {
+	flags := flag.NewFlagSet("customer update", flag.ContinueOnError)
+	firstName := flags.String("first-name", "", "new first name")
+	lastName := flags.String("last-name", "", "new last name")
+	email := flags.String("email", "", "new email")
+	phone := flags.String("phone", "", "new phone")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	id, err := parseIDArg(flags.Args())
+	if err != nil {
+		return err
+	}
+
+	customer, err := service.FindByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) { set[f.Name] = true })
+	if set["first-name"] {
+		customer.FirstName = *firstName
+	}
+	if set["last-name"] {
+		customer.LastName = *lastName
+	}
+	if set["email"] {
+		customer.Email = *email
+	}
+	if set["phone"] {
+		customer.Phone = *phone
+	}
+
+	customer, err = service.Update(ctx, id, customer.FirstName, customer.LastName, customer.Email, customer.Phone)
+	if err != nil {
+		return err
+	}
+	return writeJSON(os.Stdout, toCustomerView(*customer))
+}
+
+func customerClose(ctx context.Context, service application.Service, args []string) error {
+	flags := flag.NewFlagSet("customer close", flag.ContinueOnError)
+	confirmed := flags.Bool("yes", false, "confirm closing the account and deleting the identity")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	id, err := parseIDArg(flags.Args())
+	if err != nil {
+		return err
+	}
+	if !*confirmed {
+		fmt.Fprintln(os.Stderr, "closing is final and deletes the identity of the customer, pass -yes to confirm")
+		return errUsage
+	}
+	return service.Close(ctx, id)
+}
+
+func customerStatus(ctx context.Context, service application.Service, args []string) error {
+	flags := flag.NewFlagSet("customer status", flag.ContinueOnError)
+	reason := flags.String("reason", "", "reason code of the change, e.g. fraud_suspected or resolved")
+	note := flags.String("note", "", "free text note, required for the reason other")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 || *reason == "" {
+		fmt.Fprintln(os.Stderr, "Usage: customer status -reason <reason> [-note <note>] <id> <status>")
+		return errUsage
+	}
+	id, err := uuid.FromString(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	customer, err := service.ChangeStatus(ctx, id, flags.Arg(1), *reason, *note)
+	if err != nil {
+		return err
+	}
+	return writeJSON(os.Stdout, toCustomerView(*customer))
+}
+
+func customerMerge(ctx context.Context, service application.Service, args []string) error {
+	flags := flag.NewFlagSet("customer merge", flag.ContinueOnError)
+	confirmed := flags.Bool("yes", false, "confirm deletion of the merged profile and identity")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if flags.NArg() != 2 {
+		fmt.Fprintln(os.Stderr, "Usage: customer merge [-yes] <survivor-id> <merged-id>")
+		return errUsage
+	}
+	survivorID, err := uuid.FromString(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	mergedID, err := uuid.FromString(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	if !*confirmed {
+		fmt.Fprintln(os.Stderr, "merging deletes the merged customer profile and identity, pass -yes to confirm")
+		return errUsage
+	}
+	customer, err := service.Merge(ctx, survivorID, mergedID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(os.Stdout, toCustomerView(*customer))
+}
+
+func parseIDArg(args []string) (uuid.UUID, error) {
+	if len(args) != 1 {
+		fmt.Fprintln(os.Stderr, "expected exactly one customer id")
+		return uuid.UUID{}, errUsage
+	}
+	return uuid.FromString(args[0])
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func runDuplicates(logger *logrus.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, "Usage: duplicates scan | report [-min-score <score>]")
+		return exitUsage
+	}
+	subcommand, args := args[0], args[1:]
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer a.close()
+	ctx := application.WithAdmin(context.Background())
+
+	switch subcommand {
+	case "scan":
+		err = duplicatesScan(ctx, a.duplicates, logger)
+	case "report":
+		err = duplicatesReport(ctx, a.duplicates, args)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown duplicates command: %s\n", subcommand)
+		return exitUsage
+	}
+	if err == flag.ErrHelp || err == errUsage {
+		return exitUsage
+	}
+	if err != nil {
+		logger.WithError(err).Error("command failed")
+		return exitFailure
+	}
+	return exitOK
+}
+
+// duplicatesScan checks every customer, e.g. the ones registered before the detection or after the thresholds changed.
+func duplicatesScan(ctx context.Context, duplicates *application.Duplicates, logger *logrus.Logger) error {
+	flagged := 0
+	checked, err := duplicates.Scan(ctx, func(_ application.Customer, pairs []application.DuplicatePair) {
+		for _, pair := range pairs {
+			if duplicates.Flagged(pair) {
+				flagged++
+			}
+		}
+	})
+	logger.WithFields(logrus.Fields{"checked": checked, "flagged": flagged}).Info("duplicate scan finished")
+	return err
+}
+
+func duplicatesReport(ctx context.Context, duplicates *application.Duplicates, args []string) error {
+	flags := flag.NewFlagSet("duplicates report", flag.ContinueOnError)
+	minScore := flags.Float64("min-score", 0, "lowest score of the pairs in a cluster, the flag threshold when 0")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	clusters, err := duplicates.Clusters(ctx, *minScore)
+	if err != nil {
+		return err
+	}
+	views := make([]duplicateClusterView, 0, len(clusters))
+	for _, cluster := range clusters {
+		view := duplicateClusterView{}
+		for _, id := range cluster.CustomerIDs {
+			view.CustomerIDs = append(view.CustomerIDs, id.String())
+		}
+		for _, pair := range cluster.Pairs {
+			view.Pairs = append(view.Pairs, duplicatePairView{
+				CustomerID:  pair.CustomerID.String(),
+				CandidateID: pair.CandidateID.String(),
+				Score:       pair.Score,
+				Reasons:     pair.Reasons,
+				Flagged:     duplicates.Flagged(pair),
+				DetectedAt:  pair.DetectedAt,
+			})
+		}
+		views = append(views, view)
+	}
+	return writeJSON(os.Stdout, views)
+}
+
+type duplicateClusterView struct {
+	CustomerIDs []string            `json:"customerIds"`
+	Pairs       []duplicatePairView `json:"pairs"`
+}
+
+type duplicatePairView struct {
+	CustomerID  string    `json:"customerId"`
+	CandidateID string    `json:"candidateId"`
+	Score       float64   `json:"score"`
+	Reasons     []string  `json:"reasons"`
+	Flagged     bool      `json:"flagged"`
+	DetectedAt  time.Time `json:"detectedAt"`
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/bulk"
+)
+
+func runExport(logger *logrus.Logger, args []string) int {
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := flags.String("format", bulk.FormatNDJSON, "ndjson, csv or parquet")
+	output := flags.String("o", "-", "output file, stdout by default")
+	updatedSince := flags.String("updated-since", "", "export customers updated at or after this RFC 3339 time")
+	updatedBefore := flags.String("updated-before", "", "export customers updated before this RFC 3339 time")
+	redact := flags.String("redact", "", "redacted columns, e.g. email:hash,phone:drop")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: export [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	options := application.ExportOptions{}
+	var err error
+	for value, target := range map[string]*time.Time{*updatedSince: &options.Filter.UpdatedSince, *updatedBefore: &options.Filter.UpdatedBefore} {
+		if value == "" {
+			continue
+		}
+		if *target, err = time.Parse(time.RFC3339, value); err != nil {
+			fmt.Fprintf(os.Stderr, "invalid time %q, expected RFC 3339\n", value)
+			return exitUsage
+		}
+	}
+	if options.Redact, err = application.ParseRedaction(*redact); err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitUsage
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "-" {
+		file, err := os.Create(*output)
+		if err != nil {
+			logger.Error(err.Error())
+			return exitFailure
+		}
+		defer file.Close()
+		out = file
+	}
+	writer, err := bulk.NewExportWriter(*format, out)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err.Error())
+		return exitUsage
+	}
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer a.close()
+
+	count, err := a.exporter.Export(application.WithAdmin(context.Background()), writer, options)
+	if err != nil {
+		logger.WithError(err).Error("export failed")
+		return exitFailure
+	}
+	logger.WithFields(logrus.Fields{"customers": count}).Info("export finished")
+	return exitOK
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/bulk"
+)
+
+func runImport(logger *logrus.Logger, args []string) int {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	format := flags.String("format", "", "csv or ndjson, taken from the file extension by default")
+	dryRun := flags.Bool("dry-run", false, "validate and dedupe without creating customers")
+	provisionIdentities := flags.Bool("provision-identities", false, "register identities from the username and password columns")
+	batchSize := flags.Int("batch-size", 100, "number of records per batch")
+	concurrency := flags.Int("concurrency", 4, "number of records imported in parallel")
+	resumeAfter := flags.Int("resume-after", 0, "skip the records up to this line")
+	checkpointFile := flags.String("checkpoint", "", "file to resume from and to record the last completed line in")
+	flags.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage: import [flags] <file|->")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return exitUsage
+	}
+	path := flags.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(filepath.Ext(path), ".")
+	}
+
+	if *checkpointFile != "" && *resumeAfter == 0 {
+		checkpoint, err := readCheckpoint(*checkpointFile)
+		if err != nil {
+			logger.Error(err.Error())
+			return exitFailure
+		}
+		*resumeAfter = checkpoint
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		file, err := os.Open(path)
+		if err != nil {
+			logger.Error(err.Error())
+			return exitFailure
+		}
+		defer file.Close()
+		in = file
+	}
+	source, err := bulk.NewImportSource(*format, in)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitUsage
+	}
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer a.close()
+
+	options := application.ImportOptions{
+		DryRun:              *dryRun,
+		ProvisionIdentities: *provisionIdentities,
+		BatchSize:           *batchSize,
+		Concurrency:         *concurrency,
+		ResumeAfter:         *resumeAfter,
+		OnBatch: func(report application.ImportReport) {
+			logger.WithFields(logrus.Fields{
+				"checkpoint": report.Checkpoint,
+				"imported":   report.Imported,
+				"duplicates": report.Duplicates,
+				"invalid":    report.Invalid,
+				"failed":     report.Failed,
+			}).Info("batch imported")
+			if *checkpointFile != "" && !report.DryRun {
+				if err := os.WriteFile(*checkpointFile, []byte(strconv.Itoa(report.Checkpoint)+"\n"), 0o644); err != nil {
+					logger.WithError(err).Warn("failed to write checkpoint")
+				}
+			}
+		},
+	}
+	report, err := application.NewImporter(a.service).Import(application.WithAdmin(context.Background()), source, options)
+	if report != nil {
+		if err := writeJSON(os.Stdout, report); err != nil {
+			logger.Error(err.Error())
+			return exitFailure
+		}
+	}
+	if err != nil {
+		logger.WithError(err).Error("import failed, rerun with the same checkpoint to resume")
+		return exitFailure
+	}
+	if report.Invalid > 0 || report.Failed > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+func readCheckpoint(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	checkpoint, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid checkpoint in %s: %w", path, err)
+	}
+	return checkpoint, nil
+}
@@ -1,28 +1,16 @@
 package main
 
 import (
-	"context"
-	"net/http"
+	"errors"
+	"fmt"
 	"os"
-	"os/signal"
-	"syscall"
-	"time"
+	"sort"
+	// the runtime image has no zoneinfo, the time zones of the preferences are validated against the embedded one
+	_ "time/tzdata"
 
-	gokitlog "github.com/go-kit/kit/log"
-	"github.com/go-kit/kit/log/level"
-	gokitprometheus "github.com/go-kit/kit/metrics/prometheus"
-	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/sirupsen/logrus"
 
-	"github.com/jnikolaeva/eshop-common/httpkit"
-	postgresadapter "github.com/jnikolaeva/eshop-common/postgres"
-
-	"github.com/jnikolaeva/customerservice/internal/customer/application"
-	usertransport "github.com/jnikolaeva/customerservice/internal/customer/infrastructure/transport"
-	"github.com/jnikolaeva/customerservice/internal/probes"
-
-	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/postgres"
+	"github.com/jnikolaeva/customerservice/internal/logging"
 )
 
 const (
@@ -30,87 +18,67 @@ const (
 	defaultPort = "8080"
 )
 
-func main() {
-	serverAddr := ":" + envString("APP_PORT", defaultPort)
+// Exit codes of the admin commands; serve reports the codes of the lifecycle manager.
+const (
+	exitOK      = 0
+	exitFailure = 1
+	exitUsage   = 64
+)
+
+// errUsage reports invalid arguments, the usage is printed where they are parsed.
+var errUsage = errors.New("invalid arguments")
 
-	logger := logrus.New()
-	logger.SetOutput(os.Stdout)
-	logger.SetFormatter(&logrus.JSONFormatter{
-		TimestampFormat: time.RFC3339Nano,
-		FieldMap: logrus.FieldMap{
-			logrus.FieldKeyTime: "@timestamp",
-			logrus.FieldKeyMsg:  "message",
-		},
-	})
+type command struct {
+	description string
+	run         func(logger *logrus.Logger, args []string) int
+}
 
-	errorLogger := gokitlog.NewJSONLogger(gokitlog.NewSyncWriter(os.Stderr))
-	errorLogger = level.NewFilter(errorLogger, level.AllowDebug())
-	errorLogger = gokitlog.With(errorLogger,
-		"appName", appName,
-		"@timestamp", gokitlog.DefaultTimestampUTC,
-	)
+var commands = map[string]command{
+	"serve":         {"start the HTTP server (default)", runServe},
+	"migrate":       {"manage the database schema: status, up, down, goto, force", runMigrate},
+	"customer":      {"operate on customers: get, find, update, close", runCustomer},
+	"export":        {"write customers to stdout or a file as NDJSON, CSV or Parquet", runExport},
+	"seed":          {"create sample customers for development", runSeed},
+	"import":        {"create customers from a CSV or NDJSON file", runImport},
+	"reconcile-idp": {"report and repair mismatches between customers and identities", runReconcileIdP},
+	"duplicates":    {"find likely duplicate customers: scan, report", runDuplicates},
+	"segments":      {"evaluate every customer against the segments: rebuild", runSegments},
+}
 
-	identityProviderUrl := envString("IDP_URL", "")
-	if identityProviderUrl == "" {
-		logger.Fatal("environment variable IDP_URL is not set")
+func main() {
+	name, args := "serve", os.Args[1:]
+	if len(args) > 0 {
+		name, args = args[0], args[1:]
+	}
+	cmd, ok := commands[name]
+	if !ok {
+		usage()
+		os.Exit(exitUsage)
 	}
 
-	connConfig, err := postgresadapter.ParseEnvConfig(appName)
+	loggingConfig, err := logging.ParseEnvConfig(appName)
 	if err != nil {
-		logger.Fatal(err.Error())
+		logrus.Fatal(err.Error())
 	}
-	connectionPool, err := postgresadapter.NewConnectionPool(connConfig)
-	if err != nil {
-		logger.Fatal(err.Error())
+	logger := logging.New(appName, loggingConfig)
+	if name != "serve" {
+		// stdout is reserved for the command output
+		logger.SetOutput(os.Stderr)
 	}
-	defer connectionPool.Close()
-
-	repository := postgres.New(connectionPool)
-	service := application.NewAuthService(application.NewService(repository))
-	endpoints := usertransport.MakeEndpoints(service, identityProviderUrl)
 
-	metrics := httpkit.NewMetricsHolder(gokitprometheus.NewCounterFrom(prometheus.CounterOpts{
-		Namespace: "customer",
-		Name:      "request_count",
-		Help:      "Number of requests received.",
-	}, []string{"method", "endpoint", "status_code"}),
-		gokitprometheus.NewHistogramFrom(prometheus.HistogramOpts{
-			Namespace: "customer",
-			Name:      "request_latency_seconds",
-			Help:      "Total duration of request in seconds.",
-			Buckets:   prometheus.DefBuckets,
-		}, []string{"method", "endpoint"}))
-
-	mux := http.NewServeMux()
-
-	mux.Handle("/api/v1/", usertransport.MakeHandler("/api/v1/customers", endpoints, errorLogger, metrics))
-	mux.Handle("/ready", probes.MakeReadyHandler())
-	mux.Handle("/live", probes.MakeLiveHandler())
-	mux.Handle("/metrics", promhttp.Handler())
-
-	srv := startServer(serverAddr, mux, logger)
-
-	waitForShutdown(srv)
-	logger.Info("shutting down")
+	os.Exit(cmd.run(logger, args))
 }
 
-func startServer(serverAddr string, handler http.Handler, logger *logrus.Logger) *http.Server {
-	srv := &http.Server{Addr: serverAddr, Handler: handler}
-
-	go func() {
-		logger.WithFields(logrus.Fields{"url": serverAddr}).Info("starting the server")
-		logger.Fatal(srv.ListenAndServe())
-	}()
-
-	return srv
-}
-
-func waitForShutdown(srv *http.Server) {
-	killSignalChan := make(chan os.Signal, 1)
-	signal.Notify(killSignalChan, os.Kill, os.Interrupt, syscall.SIGTERM)
-
-	<-killSignalChan
-	_ = srv.Shutdown(context.Background())
+func usage() {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintf(os.Stderr, "Usage: %s <command> [arguments]\n\nCommands:\n", os.Args[0])
+	for _, name := range names {
+		fmt.Fprintf(os.Stderr, "  %-14s %s\n", name, commands[name].description)
+	}
 }
 
 func envString(env, fallback string) string {
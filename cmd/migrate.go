@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/jackc/pgx"
+	"github.com/sirupsen/logrus"
+
+	postgresadapter "github.com/jnikolaeva/eshop-common/postgres"
+
+	"github.com/jnikolaeva/customerservice/data/migrations"
+	"github.com/jnikolaeva/customerservice/internal/migration"
+)
+
+const migrateUsage = "Usage: migrate status | up | down [steps] | goto <version> | force <version>"
+
+func runMigrate(logger *logrus.Logger, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+
+	connConfig, err := postgresadapter.ParseEnvConfig(appName)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	connPool, err := postgresadapter.NewConnectionPool(connConfig)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer connPool.Close()
+	runner, err := newMigrationRunner(connPool, logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+
+	ctx := context.Background()
+	switch {
+	case args[0] == "status" && len(args) == 1:
+		err = printMigrationStatus(ctx, runner)
+	case args[0] == "up" && len(args) == 1:
+		err = runner.Up(ctx)
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, migrateUsage)
+				return exitUsage
+			}
+		}
+		err = runner.Down(ctx, steps)
+	case (args[0] == "goto" || args[0] == "force") && len(args) == 2:
+		version, parseErr := strconv.ParseInt(args[1], 10, 64)
+		if parseErr != nil {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return exitUsage
+		}
+		if args[0] == "goto" {
+			err = runner.Goto(ctx, version)
+		} else {
+			err = runner.Force(ctx, version)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return exitUsage
+	}
+	if err != nil {
+		logger.WithError(err).Error("migration failed")
+		return exitFailure
+	}
+	return exitOK
+}
+
+func newMigrationRunner(connPool *pgx.ConnPool, logger *logrus.Logger) (*migration.Runner, error) {
+	loaded, err := migration.Load(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	return migration.NewRunner(connPool, loaded, logger), nil
+}
+
+func printMigrationStatus(ctx context.Context, runner *migration.Runner) error {
+	status, err := runner.Status(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version: %d\ndirty: %t\nlatest: %d\n", status.Version, status.Dirty, status.Latest)
+	for _, m := range status.Pending {
+		fmt.Printf("pending: %d_%s\n", m.Version, m.Name)
+	}
+	return nil
+}
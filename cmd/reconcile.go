@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	gokitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/lifecycle"
+)
+
+func runReconcileIdP(logger *logrus.Logger, args []string) int {
+	flags := flag.NewFlagSet("reconcile-idp", flag.ContinueOnError)
+	dryRun := flags.Bool("dry-run", false, "only report mismatches, implied without a repair flag")
+	deleteOrphans := flags.Bool("delete-orphan-identities", false, "delete identities without a customer")
+	flagMissing := flags.Bool("flag-missing-identities", false, "flag customers without an identity")
+	pageSize := flags.Int("page-size", 500, "number of records read per request")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+	repair := *deleteOrphans || *flagMissing
+	if *dryRun && repair {
+		fmt.Fprintln(os.Stderr, "-dry-run cannot be combined with -delete-orphan-identities or -flag-missing-identities")
+		return exitUsage
+	}
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer a.close()
+
+	reconciler, err := a.newReconciler()
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	report, err := reconciler.Run(application.WithAdmin(context.Background()), application.ReconciliationOptions{
+		DryRun:                 !repair,
+		DeleteOrphanIdentities: *deleteOrphans,
+		FlagMissingIdentities:  *flagMissing,
+		PageSize:               *pageSize,
+	})
+	if err != nil {
+		logger.WithError(err).Error("reconciliation failed")
+		return exitFailure
+	}
+	if err := writeJSON(os.Stdout, report); err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	if len(report.Errors) > 0 {
+		return exitFailure
+	}
+	return exitOK
+}
+
+// newReconcileWorker periodically reconciles in dry-run mode to keep the mismatch gauges up to date,
+// repairs are left to the reconcile-idp command.
+func newReconcileWorker(reconciler *application.Reconciler, interval time.Duration, logger logrus.FieldLogger) lifecycle.WorkerFunc {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+			report, err := reconciler.Run(application.WithAdmin(ctx), application.ReconciliationOptions{DryRun: true})
+			if err != nil {
+				logger.WithError(err).Warn("identity reconciliation failed")
+				continue
+			}
+			logger.WithFields(logrus.Fields{
+				"identitiesScanned":        report.IdentitiesScanned,
+				"customersScanned":         report.CustomersScanned,
+				"orphanIdentities":         len(report.OrphanIdentities),
+				"customersWithoutIdentity": len(report.CustomersWithoutIdentity),
+			}).Info("identity reconciliation finished")
+		}
+	}
+}
+
+func (a *app) newReconciler() (*application.Reconciler, error) {
+	lister, ok := a.identityProvider.(application.IdentityLister)
+	if !ok {
+		return nil, errors.New("identity provider does not support listing identities")
+	}
+	return application.NewReconciler(a.repository, a.identityProvider, lister, newReconciliationMetrics()), nil
+}
+
+func newReconciliationMetrics() *application.ReconciliationMetrics {
+	gauge := func(name, help string) *gokitprometheus.Gauge {
+		return gokitprometheus.NewGaugeFrom(prometheus.GaugeOpts{
+			Namespace: "customer",
+			Subsystem: "reconciliation",
+			Name:      name,
+			Help:      help,
+		}, nil)
+	}
+	return &application.ReconciliationMetrics{
+		OrphanIdentities:  gauge("orphan_identities", "Number of identities without a customer found by the last reconciliation."),
+		MissingIdentities: gauge("customers_without_identity", "Number of customers without an identity found by the last reconciliation."),
+		Repairs: gokitprometheus.NewCounterFrom(prometheus.CounterOpts{
+			Namespace: "customer",
+			Subsystem: "reconciliation",
+			Name:      "repairs_total",
+			Help:      "Number of reconciliation repairs by action and outcome.",
+		}, []string{"action", "outcome"}),
+		LastRun: gauge("last_run_timestamp_seconds", "Unix time of the last completed reconciliation."),
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+var (
+	seedFirstNames = []string{"John", "Julia", "Ivan", "Maria", "Alex", "Olga"}
+	seedLastNames  = []string{"Doe", "Smith", "Petrov", "Ivanova", "Brown", "Sokolova"}
+)
+
+func runSeed(logger *logrus.Logger, args []string) int {
+	flags := flag.NewFlagSet("seed", flag.ContinueOnError)
+	count := flags.Int("count", 10, "number of customers to create")
+	withIdentity := flags.Bool("with-identity", false, "register identities with password 'password123'")
+	if err := flags.Parse(args); err != nil {
+		return exitUsage
+	}
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer a.close()
+	ctx := application.WithAdmin(context.Background())
+
+	for i := 0; i < *count; i++ {
+		suffix := uuid.Generate().String()[:8]
+		firstName := seedFirstNames[i%len(seedFirstNames)]
+		lastName := seedLastNames[(i/len(seedFirstNames))%len(seedLastNames)]
+		email := fmt.Sprintf("seed-%s@example.com", suffix)
+		phone := fmt.Sprintf("+7900%07d", i)
+
+		var id application.CustomerID
+		if *withIdentity {
+			id, err = a.service.Register(ctx, "seed-"+suffix, "password123", firstName, lastName, email, phone)
+		} else {
+			id, err = a.service.Create(ctx, uuid.Generate(), firstName, lastName, email, phone)
+		}
+		if err != nil {
+			logger.WithError(err).Error("failed to create customer")
+			return exitFailure
+		}
+		fmt.Println(id.String())
+	}
+	return exitOK
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/lifecycle"
+)
+
+func runSegments(logger *logrus.Logger, args []string) int {
+	if len(args) != 1 || args[0] != "rebuild" {
+		fmt.Fprintln(os.Stderr, "Usage: segments rebuild")
+		return exitUsage
+	}
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		return exitFailure
+	}
+	defer a.close()
+
+	// rebuild repairs the members after changes whose events were lost, e.g. when the service stopped mid-request
+	evaluated, err := a.segments.Rebuild(application.WithAdmin(context.Background()))
+	logger.WithField("evaluated", evaluated).Info("segment rebuild finished")
+	if err != nil {
+		logger.WithError(err).Error("command failed")
+		return exitFailure
+	}
+	return exitOK
+}
+
+// newSegmentRebuildWorker rebuilds the members of the segments whose rule changed, at start and then every interval.
+func newSegmentRebuildWorker(segments *application.Segments, interval time.Duration, logger logrus.FieldLogger) lifecycle.WorkerFunc {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			rebuilt, err := segments.RebuildRequested(ctx)
+			if err != nil && ctx.Err() == nil {
+				logger.WithError(err).Warn("failed to rebuild segments")
+			} else if rebuilt > 0 {
+				logger.WithFields(logrus.Fields{"segments": rebuilt}).Info("rebuilt segments")
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	gokitprometheus "github.com/go-kit/kit/metrics/prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/eshop-common/httpkit"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/postgres"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/taxid"
+	usertransport "github.com/jnikolaeva/customerservice/internal/customer/infrastructure/transport"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/webhook"
+	"github.com/jnikolaeva/customerservice/internal/lifecycle"
+	"github.com/jnikolaeva/customerservice/internal/logging"
+	"github.com/jnikolaeva/customerservice/internal/probes"
+	"github.com/jnikolaeva/customerservice/internal/tracing"
+)
+
+const (
+	// changeFeedPollInterval bounds the delay of a change whose notification was lost.
+	changeFeedPollInterval = 5 * time.Second
+	// changePruneInterval is the pause between two prunings of the change log.
+	changePruneInterval = time.Hour
+)
+
+func runServe(logger *logrus.Logger, _ []string) int {
+	serverAddr := ":" + envString("APP_PORT", defaultPort)
+
+	lifecycleConfig, err := lifecycle.ParseEnvConfig(appName)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	webhookConfig, err := webhook.ParseEnvConfig(appName)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	taxIDConfig, err := taxid.ParseEnvConfig(appName)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	tracingConfig, err := tracing.ParseEnvConfig(appName)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	shutdownTracing, err := tracing.Init(tracingConfig, appName)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+
+	a, err := newApp(logger)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	changeNotifier := application.NewChangeNotifier()
+	changeFeed := application.NewChangeFeed(postgres.NewChangeLog(a.connPool), changeNotifier, changeFeedPollInterval)
+	consents := application.NewConsents(postgres.NewConsentRepository(a.connPool), a.repository, a.events)
+	taxIDs := application.NewTaxIDs(postgres.NewTaxIDRepository(a.connPool), taxid.NewVerifier(taxIDConfig), a.repository,
+		postgres.NewOrganizationRepository(a.connPool))
+	endpoints := usertransport.MakeEndpoints(a.service, changeFeed, consents, a.preferences, taxIDs, a.attributes)
+
+	migrationRunner, err := newMigrationRunner(a.connPool, logger)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	if envString("DB_MIGRATE_ON_START", "false") == "true" {
+		if err := migrationRunner.Up(context.Background()); err != nil {
+			logger.Fatal(err.Error())
+		}
+	}
+	if err := migrationRunner.Check(context.Background()); err != nil {
+		logger.WithError(err).Fatal("refusing to serve with an outdated schema, run migrate up")
+	}
+
+	readinessConfig, err := probes.ParseEnvConfig(appName)
+	if err != nil {
+		logger.Fatal(err.Error())
+	}
+	healthChecker := postgres.NewHealthChecker(a.connPool)
+	readiness := probes.NewReadiness(readinessConfig)
+	readiness.Register("postgres", healthChecker.Ping)
+	readiness.Register("migrations", migrationRunner.Check)
+	if pinger, ok := a.identityProvider.(interface{ Ping(context.Context) error }); ok {
+		readiness.Register("identity_provider", pinger.Ping)
+	}
+
+	metrics := httpkit.NewMetricsHolder(gokitprometheus.NewCounterFrom(prometheus.CounterOpts{
+		Namespace: "customer",
+		Name:      "request_count",
+		Help:      "Number of requests received.",
+	}, []string{"method", "endpoint", "status_code"}),
+		gokitprometheus.NewHistogramFrom(prometheus.HistogramOpts{
+			Namespace: "customer",
+			Name:      "request_latency_seconds",
+			Help:      "Total duration of request in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "endpoint"}))
+
+	mux := http.NewServeMux()
+
+	adminEndpoints := usertransport.MakeAdminEndpoints(a.service, application.NewImporter(a.service), a.exporter, a.webhooks, consents, a.duplicates,
+		a.attributes, a.tags, a.segments)
+	mux.Handle("/api/v1/", usertransport.MakeHandler("/api/v1/customers", endpoints, logger, metrics))
+	organizationHandler := usertransport.MakeOrganizationHandler("/api/v1/organizations",
+		usertransport.MakeOrganizationEndpoints(a.organizations, taxIDs), logger, metrics)
+	mux.Handle("/api/v1/organizations", organizationHandler)
+	mux.Handle("/api/v1/organizations/", organizationHandler)
+	mux.Handle("/api/v1/admin/", usertransport.MakeAdminHandler("/api/v1/admin", adminEndpoints, logger, metrics))
+	mux.Handle("/ready", probes.MakeReadyHandler(readiness))
+	mux.Handle("/live", probes.MakeLiveHandler())
+	mux.Handle("/metrics", promhttp.Handler())
+
+	handler := logging.RequestIDMiddleware(logging.AccessLogMiddleware(mux, logger, "/ready", "/live", "/metrics"))
+	manager := lifecycle.NewManager(lifecycleConfig, serverAddr, handler, logger)
+	manager.OnShutdown(readiness.Shutdown)
+	manager.OnShutdown(changeFeed.Shutdown)
+	manager.AddWorker("change_listener", postgres.NewChangeListener(a.connPool, changeNotifier, logger).Run)
+	manager.AddWorker("webhook_dispatcher", webhook.NewDispatcher(postgres.NewWebhookRepository(a.connPool), webhookConfig,
+		gokitprometheus.NewCounterFrom(prometheus.CounterOpts{
+			Namespace: "customer",
+			Subsystem: "webhook",
+			Name:      "delivery_attempts_total",
+			Help:      "Number of webhook delivery attempts by resulting delivery status.",
+		}, []string{"outcome"}), logger).Run)
+	if retention, err := time.ParseDuration(envString("CHANGES_RETENTION", "720h")); err != nil {
+		logger.Fatal(err.Error())
+	} else if retention > 0 {
+		manager.AddWorker("change_pruner", newChangePruneWorker(changeFeed, retention, logger))
+	}
+	if interval, err := time.ParseDuration(envString("SEGMENT_REBUILD_INTERVAL", "10s")); err != nil {
+		logger.Fatal(err.Error())
+	} else if interval > 0 {
+		manager.AddWorker("segment_rebuilder", newSegmentRebuildWorker(a.segments, interval, logger))
+	}
+	if interval, err := time.ParseDuration(envString("IDP_RECONCILE_INTERVAL", "0")); err != nil {
+		logger.Fatal(err.Error())
+	} else if interval > 0 {
+		reconciler, err := a.newReconciler()
+		if err != nil {
+			logger.Fatal(err.Error())
+		}
+		manager.AddWorker("idp_reconciliation", newReconcileWorker(reconciler, interval, logger))
+	}
+	manager.AddCloser("tracing", func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			logger.WithError(err).Error("failed to flush traces")
+		}
+	})
+	manager.AddCloser("app", a.close)
+
+	return manager.Run()
+}
+
+// newChangePruneWorker deletes the changes older than the retention from the change log, at start and then hourly.
+func newChangePruneWorker(feed *application.ChangeFeed, retention time.Duration, logger logrus.FieldLogger) lifecycle.WorkerFunc {
+	return func(ctx context.Context) error {
+		ticker := time.NewTicker(changePruneInterval)
+		defer ticker.Stop()
+		for {
+			pruned, err := feed.Prune(ctx, retention)
+			if err != nil && ctx.Err() == nil {
+				logger.WithError(err).Warn("failed to prune change log")
+			} else if pruned > 0 {
+				logger.WithFields(logrus.Fields{"pruned": pruned}).Info("pruned change log")
+			}
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-ticker.C:
+			}
+		}
+	}
+}
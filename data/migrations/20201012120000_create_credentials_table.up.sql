@@ -0,0 +1,5 @@
+CREATE TABLE IF NOT EXISTS credentials (
+    user_id UUID NOT NULL PRIMARY KEY,
+    username VARCHAR(256) NOT NULL UNIQUE,
+    password_hash VARCHAR(256) NOT NULL
+);
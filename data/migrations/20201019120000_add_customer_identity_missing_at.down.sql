@@ -0,0 +1 @@
+ALTER TABLE customers DROP COLUMN IF EXISTS identity_missing_at;
@@ -0,0 +1 @@
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS identity_missing_at TIMESTAMPTZ NULL;
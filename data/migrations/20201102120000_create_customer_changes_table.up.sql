@@ -0,0 +1,7 @@
+CREATE TABLE IF NOT EXISTS customer_changes (
+    sequence BIGSERIAL NOT NULL PRIMARY KEY,
+    customer_id UUID NOT NULL,
+    event_type VARCHAR(64) NOT NULL,
+    customer JSONB NULL,
+    occurred_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
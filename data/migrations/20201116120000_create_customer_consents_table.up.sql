@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS customer_consents (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    customer_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    purpose VARCHAR(64) NOT NULL,
+    channel VARCHAR(64) NOT NULL,
+    granted BOOLEAN NOT NULL,
+    source VARCHAR(64) NOT NULL,
+    policy_version VARCHAR(64) NOT NULL DEFAULT '',
+    recorded_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS customer_consents_customer_idx ON customer_consents (customer_id, purpose, channel, id);
+CREATE INDEX IF NOT EXISTS customer_consents_purpose_idx ON customer_consents (purpose, channel, customer_id);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS customer_preferences (
+    customer_id UUID NOT NULL PRIMARY KEY REFERENCES customers (id) ON DELETE CASCADE,
+    locale VARCHAR(64) NOT NULL,
+    timezone VARCHAR(64) NOT NULL,
+    currency CHAR(3) NOT NULL,
+    notifications JSONB NOT NULL DEFAULT '{}',
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS customer_status_changes;
+ALTER TABLE customers DROP COLUMN IF EXISTS status;
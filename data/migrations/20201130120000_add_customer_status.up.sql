@@ -0,0 +1,14 @@
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS status VARCHAR(32) NOT NULL DEFAULT 'active';
+
+CREATE TABLE IF NOT EXISTS customer_status_changes (
+    id BIGSERIAL NOT NULL PRIMARY KEY,
+    customer_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    from_status VARCHAR(32) NOT NULL,
+    to_status VARCHAR(32) NOT NULL,
+    reason VARCHAR(64) NOT NULL,
+    note TEXT NOT NULL DEFAULT '',
+    actor VARCHAR(64) NOT NULL,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS customer_status_changes_customer_idx ON customer_status_changes (customer_id, id);
@@ -0,0 +1,37 @@
+CREATE TABLE IF NOT EXISTS organizations (
+    id UUID NOT NULL PRIMARY KEY,
+    legal_name VARCHAR(256) NOT NULL,
+    address_line1 VARCHAR(256) NOT NULL DEFAULT '',
+    address_line2 VARCHAR(256) NOT NULL DEFAULT '',
+    city VARCHAR(256) NOT NULL DEFAULT '',
+    postal_code VARCHAR(32) NOT NULL DEFAULT '',
+    region VARCHAR(256) NOT NULL DEFAULT '',
+    country CHAR(2) NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS organization_members (
+    organization_id UUID NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    customer_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    role VARCHAR(16) NOT NULL,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (organization_id, customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS organization_members_customer_idx ON organization_members (customer_id);
+
+CREATE TABLE IF NOT EXISTS organization_invitations (
+    id UUID NOT NULL PRIMARY KEY,
+    organization_id UUID NOT NULL REFERENCES organizations (id) ON DELETE CASCADE,
+    email VARCHAR(256) NOT NULL,
+    role VARCHAR(16) NOT NULL,
+    token_hash CHAR(64) NOT NULL UNIQUE,
+    invited_by UUID NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    expires_at TIMESTAMPTZ NOT NULL,
+    accepted_at TIMESTAMPTZ NULL,
+    accepted_by UUID NULL
+);
+
+CREATE INDEX IF NOT EXISTS organization_invitations_organization_idx ON organization_invitations (organization_id);
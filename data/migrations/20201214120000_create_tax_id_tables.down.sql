@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS organization_tax_ids;
+DROP TABLE IF EXISTS customer_tax_ids;
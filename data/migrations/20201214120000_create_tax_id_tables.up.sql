@@ -0,0 +1,19 @@
+CREATE TABLE IF NOT EXISTS customer_tax_ids (
+    customer_id UUID NOT NULL PRIMARY KEY REFERENCES customers (id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL,
+    value VARCHAR(64) NOT NULL,
+    country CHAR(2) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    checked_at TIMESTAMPTZ NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS organization_tax_ids (
+    organization_id UUID NOT NULL PRIMARY KEY REFERENCES organizations (id) ON DELETE CASCADE,
+    type VARCHAR(16) NOT NULL,
+    value VARCHAR(64) NOT NULL,
+    country CHAR(2) NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    checked_at TIMESTAMPTZ NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,9 @@
+-- IDs of customers merged into another customer, see the admin merge
+CREATE TABLE IF NOT EXISTS customer_aliases (
+    alias_id UUID NOT NULL PRIMARY KEY,
+    customer_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    merged_by VARCHAR(64) NOT NULL,
+    merged_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS customer_aliases_customer_id_idx ON customer_aliases (customer_id);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS customer_duplicates;
+DROP TABLE IF EXISTS customer_match_keys;
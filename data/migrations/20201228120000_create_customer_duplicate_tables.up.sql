@@ -0,0 +1,27 @@
+-- normalized fields compared to find duplicate customers, see the duplicate detection
+CREATE TABLE IF NOT EXISTS customer_match_keys (
+    customer_id UUID NOT NULL PRIMARY KEY REFERENCES customers (id) ON DELETE CASCADE,
+    email VARCHAR(256) NOT NULL,
+    phone VARCHAR(16) NOT NULL,
+    name TEXT NOT NULL,
+    name_words TEXT[] NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS customer_match_keys_email_idx ON customer_match_keys (email) WHERE email <> '';
+CREATE INDEX IF NOT EXISTS customer_match_keys_phone_idx ON customer_match_keys (phone) WHERE phone <> '';
+CREATE INDEX IF NOT EXISTS customer_match_keys_name_words_idx ON customer_match_keys USING GIN (name_words);
+
+-- every pair is kept once, with the lower ID first
+CREATE TABLE IF NOT EXISTS customer_duplicates (
+    customer_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    candidate_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    score DOUBLE PRECISION NOT NULL,
+    reasons TEXT[] NOT NULL,
+    detected_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (customer_id, candidate_id),
+    CHECK (customer_id < candidate_id)
+);
+
+CREATE INDEX IF NOT EXISTS customer_duplicates_candidate_id_idx ON customer_duplicates (candidate_id);
+CREATE INDEX IF NOT EXISTS customer_duplicates_score_idx ON customer_duplicates (score);
@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS attribute_definitions;
+
+DROP INDEX IF EXISTS customers_attributes_idx;
+
+ALTER TABLE customers DROP COLUMN IF EXISTS attributes;
@@ -0,0 +1,15 @@
+ALTER TABLE customers ADD COLUMN IF NOT EXISTS attributes JSONB NOT NULL DEFAULT '{}';
+
+-- serves the containment filters of the customer listing
+CREATE INDEX IF NOT EXISTS customers_attributes_idx ON customers USING GIN (attributes jsonb_path_ops);
+
+CREATE TABLE IF NOT EXISTS attribute_definitions (
+    name VARCHAR(64) NOT NULL PRIMARY KEY,
+    type VARCHAR(16) NOT NULL,
+    description TEXT NOT NULL DEFAULT '',
+    visibility VARCHAR(16) NOT NULL,
+    searchable BOOLEAN NOT NULL DEFAULT false,
+    validation JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS customer_tags (
+    customer_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    tag VARCHAR(64) NOT NULL,
+    tagged_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (customer_id, tag)
+);
+
+CREATE INDEX IF NOT EXISTS customer_tags_tag_idx ON customer_tags (tag);
+
+CREATE TABLE IF NOT EXISTS segments (
+    name VARCHAR(64) NOT NULL PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT '',
+    rule TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+-- kept up to date by the service, see the segment evaluation
+CREATE TABLE IF NOT EXISTS segment_members (
+    segment_name VARCHAR(64) NOT NULL REFERENCES segments (name) ON DELETE CASCADE,
+    customer_id UUID NOT NULL REFERENCES customers (id) ON DELETE CASCADE,
+    joined_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (segment_name, customer_id)
+);
+
+CREATE INDEX IF NOT EXISTS segment_members_customer_id_idx ON segment_members (customer_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS customer_consents_customer_idx;
+
+CREATE INDEX IF NOT EXISTS customer_consents_customer_idx ON customer_consents (customer_id, purpose, channel, id);
@@ -0,0 +1,4 @@
+-- the latest decision is the one recorded last, merged customers bring consents with older IDs
+DROP INDEX IF EXISTS customer_consents_customer_idx;
+
+CREATE INDEX IF NOT EXISTS customer_consents_customer_idx ON customer_consents (customer_id, purpose, channel, recorded_at, id);
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS customer_match_keys_name_trgm_idx;
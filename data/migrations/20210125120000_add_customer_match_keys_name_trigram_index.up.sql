@@ -0,0 +1,4 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- candidates sharing only the name are found and ranked by trigram similarity
+CREATE INDEX IF NOT EXISTS customer_match_keys_name_trgm_idx ON customer_match_keys USING GIN (name gin_trgm_ops);
@@ -0,0 +1 @@
+ALTER TABLE segments DROP COLUMN IF EXISTS rebuild_requested_at;
@@ -0,0 +1,2 @@
+-- set when the rule of a segment changes, cleared once the members were rebuilt by serve
+ALTER TABLE segments ADD COLUMN IF NOT EXISTS rebuild_requested_at TIMESTAMPTZ;
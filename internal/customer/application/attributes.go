@@ -0,0 +1,275 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+// Types of custom attributes, see normalizeAttributeValue for their JSON values.
+const (
+	AttributeTypeString  = "string"
+	AttributeTypeInteger = "integer"
+	AttributeTypeNumber  = "number"
+	AttributeTypeBoolean = "boolean"
+	// AttributeTypeDate is a calendar date like "1990-05-17".
+	AttributeTypeDate = "date"
+	// AttributeTypeEnum is one of the strings of AttributeValidation.Values.
+	AttributeTypeEnum = "enum"
+)
+
+// Visibilities of custom attributes.
+const (
+	// AttributeVisibilityOwner attributes are read and written by the customer and by admins.
+	AttributeVisibilityOwner = "owner"
+	// AttributeVisibilityAdmin attributes are read and written by admins only.
+	AttributeVisibilityAdmin = "admin"
+	// AttributeVisibilityInternal attributes are written by admins and the services acting as admins and are left
+	// out of the customer representation, admins read them from the attributes of the customer.
+	AttributeVisibilityInternal = "internal"
+)
+
+const (
+	defaultAttributeSearchLimit = 100
+	maxAttributeSearchLimit     = 1000
+)
+
+var (
+	ErrInvalidAttribute  = errors.New("invalid attribute")
+	ErrAttributeNotFound = errors.New("attribute not found")
+)
+
+var attributeNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// AttributeDefinition describes a custom attribute of customers, e.g. a loyalty tier or a birthday.
+type AttributeDefinition struct {
+	Name        string
+	Type        string
+	Description string
+	Visibility  string
+	// Searchable attributes filter the admin listing of customers.
+	Searchable bool
+	Validation AttributeValidation
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// AttributeValidation restricts the values of an attribute, the bounds apply to the types they are named after.
+type AttributeValidation struct {
+	// Pattern is a regular expression a string must match, e.g. "^[A-Z]{2}$".
+	Pattern   string
+	MinLength *int
+	MaxLength *int
+	// Min and Max bound integers and numbers.
+	Min *float64
+	Max *float64
+	// Values are the values of an enum.
+	Values []string
+}
+
+// AttributeRegistry holds the definitions of the custom attributes.
+type AttributeRegistry interface {
+	Definitions(ctx context.Context) ([]AttributeDefinition, error)
+}
+
+type AttributeRepository interface {
+	AttributeRegistry
+	// FindDefinition returns ErrAttributeNotFound when the attribute is not defined.
+	FindDefinition(ctx context.Context, name string) (*AttributeDefinition, error)
+	SaveDefinition(ctx context.Context, definition AttributeDefinition) error
+	// DeleteDefinition removes the attribute from the registry and from every customer.
+	// It returns ErrAttributeNotFound when the attribute is not defined.
+	DeleteDefinition(ctx context.Context, name string) error
+}
+
+// Attributes manages the registry of custom attributes and their values. Customers change the attributes of
+// owner visibility, admins all of them.
+type Attributes struct {
+	repo      AttributeRepository
+	customers Repository
+	events    EventHandler
+}
+
+func NewAttributes(repo AttributeRepository, customers Repository, events EventHandler) *Attributes {
+	return &Attributes{
+		repo:      repo,
+		customers: customers,
+		events:    events,
+	}
+}
+
+// Definitions returns the definitions the caller may see: all of them to admins, the ones of owner visibility to customers.
+func (a *Attributes) Definitions(ctx context.Context) ([]AttributeDefinition, error) {
+	definitions, err := a.repo.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if IsAdmin(ctx) {
+		return definitions, nil
+	}
+	visible := make([]AttributeDefinition, 0, len(definitions))
+	for _, definition := range definitions {
+		if definition.Visibility == AttributeVisibilityOwner {
+			visible = append(visible, definition)
+		}
+	}
+	return visible, nil
+}
+
+// Define adds an attribute to the registry or changes its definition. The type of an attribute stays,
+// since the saved values would not match another one.
+func (a *Attributes) Define(ctx context.Context, definition AttributeDefinition) (*AttributeDefinition, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if err := validateAttributeDefinition(definition); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	definition.CreatedAt, definition.UpdatedAt = now, now
+	saved, err := a.repo.FindDefinition(ctx, definition.Name)
+	switch {
+	case errors.Is(err, ErrAttributeNotFound):
+	case err != nil:
+		return nil, err
+	case saved.Type != definition.Type:
+		return nil, fmt.Errorf("%w: the type of %q is %s, delete the attribute to change it", ErrInvalidAttribute, saved.Name, saved.Type)
+	default:
+		definition.CreatedAt = saved.CreatedAt
+	}
+	if err := a.repo.SaveDefinition(ctx, definition); err != nil {
+		return nil, err
+	}
+	return &definition, nil
+}
+
+func (a *Attributes) DeleteDefinition(ctx context.Context, name string) error {
+	if !IsAdmin(ctx) {
+		return ErrNotAuthorized
+	}
+	return a.repo.DeleteDefinition(ctx, name)
+}
+
+// Get returns the attributes of the customer the caller may see, including the internal ones for admins.
+func (a *Attributes) Get(ctx context.Context, id uuid.UUID) (map[string]interface{}, error) {
+	customer, err := findOwnedCustomer(ctx, a.customers, id)
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := a.repo.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return visibleAttributes(ctx, definitions, customer.Attributes, true), nil
+}
+
+// Update sets the values of the attributes, a nil value removes the attribute. Every value is validated
+// against the definition of its attribute.
+func (a *Attributes) Update(ctx context.Context, id uuid.UUID, values map[string]interface{}) (map[string]interface{}, error) {
+	customer, err := findOwnedCustomer(ctx, a.customers, id)
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := a.repo.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := attributeDefinitionsByName(definitions)
+	// only the given attributes are written, the others may change concurrently
+	attributes := make(map[string]interface{}, len(values))
+	var removed []string
+	for name, value := range values {
+		definition, ok := byName[name]
+		if !ok {
+			return nil, fmt.Errorf("%w: %q is not defined", ErrInvalidAttribute, name)
+		}
+		if !IsAdmin(ctx) && definition.Visibility != AttributeVisibilityOwner {
+			return nil, ErrNotAuthorized
+		}
+		if value == nil {
+			removed = append(removed, name)
+			continue
+		}
+		if attributes[name], err = normalizeAttributeValue(definition, value); err != nil {
+			return nil, err
+		}
+	}
+	customer, err = a.customers.UpdateAttributes(ctx, customer.ID, attributes, removed, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	a.events.Handle(ctx, NewCustomerUpdated(*customer))
+	return visibleAttributes(ctx, definitions, customer.Attributes, true), nil
+}
+
+// Search lists the customers whose searchable attributes have the values of the filters, which are parsed by
+// the type of their attribute, e.g. "true" for a boolean. Customers are ordered by ID, after is the last ID of the previous page.
+func (a *Attributes) Search(ctx context.Context, filters map[string]string, after CustomerID, limit int) ([]Customer, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	definitions, err := a.repo.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	byName := attributeDefinitionsByName(definitions)
+	values := make(map[string]interface{}, len(filters))
+	for name, filter := range filters {
+		definition, ok := byName[name]
+		if !ok || !definition.Searchable {
+			return nil, fmt.Errorf("%w: %q is not a searchable attribute", ErrInvalidAttribute, name)
+		}
+		if values[name], err = parseAttributeValue(definition, filter); err != nil {
+			return nil, err
+		}
+	}
+	if limit <= 0 {
+		limit = defaultAttributeSearchLimit
+	}
+	if limit > maxAttributeSearchLimit {
+		limit = maxAttributeSearchLimit
+	}
+	customers, err := a.customers.FindByAttributes(ctx, values, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	for i := range customers {
+		customers[i].Attributes = visibleAttributes(ctx, definitions, customers[i].Attributes, false)
+	}
+	return customers, nil
+}
+
+// visibleAttributes returns the defined attributes the caller may see. The internal ones are left out
+// of the customer representation, but returned to admins who ask for the attributes of a customer.
+func visibleAttributes(ctx context.Context, definitions []AttributeDefinition, attributes map[string]interface{}, internal bool) map[string]interface{} {
+	visible := map[string]interface{}{}
+	for _, definition := range definitions {
+		value, ok := attributes[definition.Name]
+		if !ok {
+			continue
+		}
+		switch definition.Visibility {
+		case AttributeVisibilityOwner:
+		case AttributeVisibilityAdmin:
+			ok = IsAdmin(ctx)
+		default:
+			ok = IsAdmin(ctx) && internal
+		}
+		if ok {
+			visible[definition.Name] = value
+		}
+	}
+	return visible
+}
+
+func attributeDefinitionsByName(definitions []AttributeDefinition) map[string]AttributeDefinition {
+	byName := make(map[string]AttributeDefinition, len(definitions))
+	for _, definition := range definitions {
+		byName[definition.Name] = definition
+	}
+	return byName
+}
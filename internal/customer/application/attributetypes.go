@@ -0,0 +1,142 @@
+package application
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+const attributeDateLayout = "2006-01-02"
+
+func validateAttributeDefinition(d AttributeDefinition) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidAttribute, fmt.Sprintf(format, args...))
+	}
+	if !attributeNamePattern.MatchString(d.Name) {
+		return invalid("name %q must be lowercase letters, digits and underscores starting with a letter, at most 64", d.Name)
+	}
+	switch d.Visibility {
+	case AttributeVisibilityOwner, AttributeVisibilityAdmin, AttributeVisibilityInternal:
+	default:
+		return invalid("unknown visibility %q", d.Visibility)
+	}
+	v := d.Validation
+	switch d.Type {
+	case AttributeTypeString:
+	case AttributeTypeInteger, AttributeTypeNumber:
+	case AttributeTypeBoolean, AttributeTypeDate:
+	case AttributeTypeEnum:
+		if len(v.Values) == 0 {
+			return invalid("an enum needs values")
+		}
+	default:
+		return invalid("unknown type %q", d.Type)
+	}
+	if (v.Pattern != "" || v.MinLength != nil || v.MaxLength != nil) && d.Type != AttributeTypeString {
+		return invalid("pattern and length apply to strings only")
+	}
+	if (v.Min != nil || v.Max != nil) && d.Type != AttributeTypeInteger && d.Type != AttributeTypeNumber {
+		return invalid("min and max apply to integers and numbers only")
+	}
+	if len(v.Values) > 0 && d.Type != AttributeTypeEnum {
+		return invalid("values apply to enums only")
+	}
+	if v.Pattern != "" {
+		if _, err := regexp.Compile(v.Pattern); err != nil {
+			return invalid("pattern: %s", err)
+		}
+	}
+	if (v.MinLength != nil && *v.MinLength < 0) || (v.MinLength != nil && v.MaxLength != nil && *v.MinLength > *v.MaxLength) {
+		return invalid("the length bounds are not in order")
+	}
+	if v.Min != nil && v.Max != nil && *v.Min > *v.Max {
+		return invalid("min is greater than max")
+	}
+	return nil
+}
+
+// normalizeAttributeValue validates a JSON value of the attribute: a string for strings, enums and dates,
+// a number for integers and numbers, and a boolean.
+func normalizeAttributeValue(d AttributeDefinition, value interface{}) (interface{}, error) {
+	invalid := func(reason string) (interface{}, error) {
+		return nil, fmt.Errorf("%w: %q %s", ErrInvalidAttribute, d.Name, reason)
+	}
+	v := d.Validation
+	switch d.Type {
+	case AttributeTypeString:
+		s, ok := value.(string)
+		if !ok {
+			return invalid("must be a string")
+		}
+		length := utf8.RuneCountInString(s)
+		if (v.MinLength != nil && length < *v.MinLength) || (v.MaxLength != nil && length > *v.MaxLength) {
+			return invalid("has an invalid length")
+		}
+		if v.Pattern != "" && !regexp.MustCompile(v.Pattern).MatchString(s) {
+			return invalid("does not match " + v.Pattern)
+		}
+		return s, nil
+	case AttributeTypeInteger, AttributeTypeNumber:
+		n, ok := value.(float64)
+		if !ok {
+			return invalid("must be a number")
+		}
+		if d.Type == AttributeTypeInteger && n != math.Trunc(n) {
+			return invalid("must be an integer")
+		}
+		if (v.Min != nil && n < *v.Min) || (v.Max != nil && n > *v.Max) {
+			return invalid("is out of range")
+		}
+		return n, nil
+	case AttributeTypeBoolean:
+		b, ok := value.(bool)
+		if !ok {
+			return invalid("must be a boolean")
+		}
+		return b, nil
+	case AttributeTypeDate:
+		s, ok := value.(string)
+		if !ok {
+			return invalid("must be a date like 1990-05-17")
+		}
+		if _, err := time.Parse(attributeDateLayout, s); err != nil {
+			return invalid("must be a date like 1990-05-17")
+		}
+		return s, nil
+	case AttributeTypeEnum:
+		s, ok := value.(string)
+		if ok {
+			for _, allowed := range v.Values {
+				if s == allowed {
+					return s, nil
+				}
+			}
+		}
+		return invalid("must be one of the values of the enum")
+	default:
+		return invalid("has an unknown type")
+	}
+}
+
+// parseAttributeValue parses a value of the attribute given as text, e.g. in a query parameter.
+func parseAttributeValue(d AttributeDefinition, text string) (interface{}, error) {
+	var value interface{} = text
+	switch d.Type {
+	case AttributeTypeInteger, AttributeTypeNumber:
+		n, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q must be a number", ErrInvalidAttribute, d.Name)
+		}
+		value = n
+	case AttributeTypeBoolean:
+		b, err := strconv.ParseBool(text)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q must be a boolean", ErrInvalidAttribute, d.Name)
+		}
+		value = b
+	}
+	return normalizeAttributeValue(d, value)
+}
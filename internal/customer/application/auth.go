@@ -10,34 +10,189 @@ import (
 var ErrNotAuthorized = errors.New("operation not allowed")
 
 type auth struct {
-	service Service
+	service       Service
+	customers     Repository
+	organizations OrganizationAccess
+	attributes    AttributeRegistry
 }
 
-func NewAuthService(service Service) Service {
+// NewAuthService lets customers act on their own profile and operators on any. Owners and admins
+// of an organization may also view the profiles of its members. Customers are returned with the
+// custom attributes the caller may see.
+func NewAuthService(service Service, customers Repository, organizations OrganizationAccess, attributes AttributeRegistry) Service {
 	return &auth{
-		service: service,
+		service:       service,
+		customers:     customers,
+		organizations: organizations,
+		attributes:    attributes,
 	}
 }
 
+func (a auth) Register(ctx context.Context, username, password, firstName, lastName, email, phone string) (CustomerID, error) {
+	return a.service.Register(ctx, username, password, firstName, lastName, email, phone)
+}
+
 func (a auth) Create(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (CustomerID, error) {
 	return a.service.Create(ctx, id, firstName, lastName, email, phone)
 }
 
 func (a auth) FindByID(ctx context.Context, id uuid.UUID) (*Customer, error) {
 	if !isResourceOwner(ctx, id) {
-		return nil, ErrNotAuthorized
+		return a.findMember(ctx, id)
+	}
+	customer, err := a.service.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
 	}
-	return a.service.FindByID(ctx, id)
+	if err := checkActive(ctx, a.customers, customer.ID); err != nil {
+		return nil, err
+	}
+	return a.withVisibleAttributes(ctx, customer)
 }
 
 func (a auth) Update(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (*Customer, error) {
-	if !isResourceOwner(ctx, id) {
+	if err := a.authorizeOwner(ctx, id); err != nil {
+		return nil, err
+	}
+	customer, err := a.service.Update(ctx, id, firstName, lastName, email, phone)
+	if err != nil {
+		return nil, err
+	}
+	return a.withVisibleAttributes(ctx, customer)
+}
+
+func (a auth) FindByEmail(ctx context.Context, email string) ([]Customer, error) {
+	if !IsAdmin(ctx) {
 		return nil, ErrNotAuthorized
 	}
-	return a.service.Update(ctx, id, firstName, lastName, email, phone)
+	customers, err := a.service.FindByEmail(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	definitions, err := a.attributes.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for i := range customers {
+		customers[i].Attributes = visibleAttributes(ctx, definitions, customers[i].Attributes, false)
+	}
+	return customers, nil
+}
+
+func (a auth) Close(ctx context.Context, id uuid.UUID) error {
+	if err := a.authorizeOwner(ctx, id); err != nil {
+		return err
+	}
+	return a.service.Close(ctx, id)
 }
 
+func (a auth) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason, note string) (*Customer, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	customer, err := a.service.ChangeStatus(ctx, id, status, reason, note)
+	if err != nil {
+		return nil, err
+	}
+	return a.withVisibleAttributes(ctx, customer)
+}
+
+func (a auth) StatusHistory(ctx context.Context, id uuid.UUID) ([]StatusChange, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	return a.service.StatusHistory(ctx, id)
+}
+
+func (a auth) Merge(ctx context.Context, survivorID, mergedID uuid.UUID) (*Customer, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	customer, err := a.service.Merge(ctx, survivorID, mergedID)
+	if err != nil {
+		return nil, err
+	}
+	return a.withVisibleAttributes(ctx, customer)
+}
+
+// findMember returns the profile of a member of an organization the subject manages.
+// The account of the subject must be active, the one of the member may be in any status.
+func (a auth) findMember(ctx context.Context, id uuid.UUID) (*Customer, error) {
+	subjectID := GetUserID(ctx)
+	if subjectID == nil {
+		return nil, ErrNotAuthorized
+	}
+	manages, err := a.organizations.ManagesMember(ctx, CustomerID(*subjectID), CustomerID(id))
+	if err != nil {
+		return nil, err
+	}
+	if !manages {
+		return nil, ErrNotAuthorized
+	}
+	if err := a.authorizeOwner(ctx, *subjectID); err != nil {
+		return nil, err
+	}
+	customer, err := a.service.FindByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return a.withVisibleAttributes(ctx, customer)
+}
+
+// withVisibleAttributes drops the custom attributes the caller may not see.
+func (a auth) withVisibleAttributes(ctx context.Context, customer *Customer) (*Customer, error) {
+	definitions, err := a.attributes.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	customer.Attributes = visibleAttributes(ctx, definitions, customer.Attributes, false)
+	return customer, nil
+}
+
+// authorizeOwner refuses the subject who may not access the customer or whose account is not active.
+func (a auth) authorizeOwner(ctx context.Context, id uuid.UUID) error {
+	if !isResourceOwner(ctx, id) {
+		return ErrNotAuthorized
+	}
+	return checkActive(ctx, a.customers, CustomerID(id))
+}
+
+// isResourceOwner reports whether the subject may access the customer; operators may access anyone.
 func isResourceOwner(ctx context.Context, resourceID uuid.UUID) bool {
+	if IsAdmin(ctx) {
+		return true
+	}
 	subjectID := GetUserID(ctx)
 	return subjectID != nil && resourceID == *subjectID
-}
\ No newline at end of file
+}
+
+// checkActive refuses a customer acting on an account which is not active; operators are not refused.
+// The status is read with Repository.Status, a cached one may be stale when another instance changed it.
+func checkActive(ctx context.Context, repo Repository, id CustomerID) error {
+	if IsAdmin(ctx) {
+		return nil
+	}
+	status, err := repo.Status(ctx, id)
+	if err != nil {
+		return err
+	}
+	if status != StatusActive {
+		return ErrAccountNotActive
+	}
+	return nil
+}
+
+// findOwnedCustomer returns the customer the subject may act on, see authorizeOwner.
+func findOwnedCustomer(ctx context.Context, repo Repository, id uuid.UUID) (*Customer, error) {
+	if !isResourceOwner(ctx, id) {
+		return nil, ErrNotAuthorized
+	}
+	customer, err := repo.FindByID(ctx, CustomerID(id))
+	if err != nil {
+		return nil, err
+	}
+	if err := checkActive(ctx, repo, customer.ID); err != nil {
+		return nil, err
+	}
+	return customer, nil
+}
@@ -0,0 +1,129 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	defaultChangesLimit = 100
+	maxChangesLimit     = 1000
+	maxChangesWait      = 60 * time.Second
+)
+
+// ErrChangeFeedClosed ends the waits of the readers when the service shuts down.
+var ErrChangeFeedClosed = errors.New("change feed is closed")
+
+// Change is a record of the change log. Customer is the state after the change, nil when it was closed.
+// For a merge CustomerID is the merged customer and Customer the survivor.
+type Change struct {
+	Sequence   int64
+	EventType  string
+	CustomerID CustomerID
+	Customer   *Customer
+	OccurredAt time.Time
+}
+
+// ChangeLog is written in the transaction of every customer write.
+// Sequences become visible in increasing order, so a reader never skips a change behind its cursor.
+type ChangeLog interface {
+	ChangesAfter(ctx context.Context, after int64, limit int) ([]Change, error)
+	// Prune deletes the changes which occurred before the given time and returns their number.
+	Prune(ctx context.Context, before time.Time) (int64, error)
+}
+
+// ChangeNotifier wakes up the readers waiting for new changes.
+type ChangeNotifier struct {
+	mu     sync.Mutex
+	waiter chan struct{}
+}
+
+func NewChangeNotifier() *ChangeNotifier {
+	return &ChangeNotifier{waiter: make(chan struct{})}
+}
+
+func (n *ChangeNotifier) Notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.waiter)
+	n.waiter = make(chan struct{})
+}
+
+// Wait returns a channel closed by the next Notify.
+func (n *ChangeNotifier) Wait() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.waiter
+}
+
+// ChangeFeed reads the change log with long polling. Readers are woken up by the notifier
+// and poll anyway at the given interval, in case a notification is lost.
+type ChangeFeed struct {
+	log          ChangeLog
+	notifier     *ChangeNotifier
+	pollInterval time.Duration
+	closeOnce    sync.Once
+	closed       chan struct{}
+}
+
+func NewChangeFeed(log ChangeLog, notifier *ChangeNotifier, pollInterval time.Duration) *ChangeFeed {
+	return &ChangeFeed{
+		log:          log,
+		notifier:     notifier,
+		pollInterval: pollInterval,
+		closed:       make(chan struct{}),
+	}
+}
+
+// Shutdown ends all waits, so that long polls and streams do not hold up the server shutdown.
+func (f *ChangeFeed) Shutdown() {
+	f.closeOnce.Do(func() { close(f.closed) })
+}
+
+// Prune deletes the changes older than the retention. Readers further behind miss them.
+func (f *ChangeFeed) Prune(ctx context.Context, retention time.Duration) (int64, error) {
+	return f.log.Prune(ctx, time.Now().UTC().Add(-retention))
+}
+
+// Changes returns the changes after the given sequence, waiting up to wait for the first one.
+func (f *ChangeFeed) Changes(ctx context.Context, after int64, limit int, wait time.Duration) ([]Change, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if limit <= 0 {
+		limit = defaultChangesLimit
+	}
+	if limit > maxChangesLimit {
+		limit = maxChangesLimit
+	}
+	if wait > maxChangesWait {
+		wait = maxChangesWait
+	}
+	deadline := time.NewTimer(wait)
+	defer deadline.Stop()
+	for {
+		// subscribe before reading, so that a change committed meanwhile is not missed
+		notified := f.notifier.Wait()
+		changes, err := f.log.ChangesAfter(ctx, after, limit)
+		if err != nil || len(changes) > 0 || wait <= 0 {
+			return changes, err
+		}
+		poll := time.NewTimer(f.pollInterval)
+		select {
+		case <-f.closed:
+			poll.Stop()
+			return nil, ErrChangeFeedClosed
+		case <-notified:
+		case <-poll.C:
+		case <-deadline.C:
+			poll.Stop()
+			return nil, nil
+		case <-ctx.Done():
+			poll.Stop()
+			return nil, ctx.Err()
+		}
+		poll.Stop()
+	}
+}
@@ -0,0 +1,224 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+const (
+	ConsentPurposeMarketing       = "marketing"
+	ConsentPurposePersonalizedAds = "personalized_ads"
+)
+
+const (
+	ConsentChannelEmail = "email"
+	ConsentChannelSMS   = "sms"
+	ConsentChannelPush  = "push"
+	ConsentChannelWeb   = "web"
+)
+
+const (
+	defaultConsentingLimit = 100
+	maxConsentingLimit     = 1000
+	maxConsentFieldLength  = 64
+)
+
+var ErrInvalidConsent = errors.New("invalid consent")
+
+// Consent is a decision of the customer about a purpose on a channel, e.g. marketing by email.
+// Consents are never changed, a later decision is recorded next to the earlier ones.
+type Consent struct {
+	CustomerID CustomerID
+	Purpose    string
+	Channel    string
+	Granted    bool
+	// Source tells where the decision was made, e.g. "signup_form" or "support".
+	Source string
+	// PolicyVersion is the version of the privacy policy the customer agreed to.
+	PolicyVersion string
+	RecordedAt    time.Time
+}
+
+type ConsentRepository interface {
+	AppendConsents(ctx context.Context, consents []Consent) error
+	// ConsentHistory returns the consents of the customer in the order they were recorded.
+	ConsentHistory(ctx context.Context, id CustomerID) ([]Consent, error)
+	// ConsentingCustomers returns up to limit customers ordered by ID, starting after the given one,
+	// whose account is active and whose latest consent for the purpose on the channel is granted.
+	ConsentingCustomers(ctx context.Context, purpose, channel string, after CustomerID, limit int) ([]Customer, error)
+}
+
+// CurrentConsents derives the current state from the history: the latest consent
+// of every purpose and channel, ordered by purpose and channel.
+func CurrentConsents(history []Consent) []Consent {
+	type key struct{ purpose, channel string }
+	latest := make(map[key]Consent)
+	for _, consent := range history {
+		latest[key{consent.Purpose, consent.Channel}] = consent
+	}
+	current := make([]Consent, 0, len(latest))
+	for _, consent := range latest {
+		current = append(current, consent)
+	}
+	sort.Slice(current, func(i, j int) bool {
+		if current[i].Purpose != current[j].Purpose {
+			return current[i].Purpose < current[j].Purpose
+		}
+		return current[i].Channel < current[j].Channel
+	})
+	return current
+}
+
+// Consents records the consent decisions of customers and answers whom they allow to contact.
+type Consents struct {
+	repo      ConsentRepository
+	customers Repository
+	events    EventHandler
+}
+
+func NewConsents(repo ConsentRepository, customers Repository, events EventHandler) *Consents {
+	return &Consents{
+		repo:      repo,
+		customers: customers,
+		events:    events,
+	}
+}
+
+// Current returns the current consents of the customer. A purpose and channel without a decision is not granted.
+func (c *Consents) Current(ctx context.Context, id uuid.UUID) ([]Consent, error) {
+	history, err := c.History(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return CurrentConsents(history), nil
+}
+
+func (c *Consents) History(ctx context.Context, id uuid.UUID) ([]Consent, error) {
+	if _, err := findOwnedCustomer(ctx, c.customers, id); err != nil {
+		return nil, err
+	}
+	return c.repo.ConsentHistory(ctx, CustomerID(id))
+}
+
+// Record appends the decisions which change the current state, emits an event for each of them
+// and returns the current consents.
+func (c *Consents) Record(ctx context.Context, id uuid.UUID, decisions []Consent) ([]Consent, error) {
+	if !isResourceOwner(ctx, id) {
+		return nil, ErrNotAuthorized
+	}
+	if len(decisions) == 0 {
+		return nil, fmt.Errorf("%w: at least one consent is required", ErrInvalidConsent)
+	}
+	for _, decision := range decisions {
+		if err := validateConsent(decision); err != nil {
+			return nil, err
+		}
+	}
+	current, err := c.Current(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	var changes []Consent
+	for _, decision := range decisions {
+		decision.CustomerID = CustomerID(id)
+		decision.RecordedAt = now
+		if !changesConsent(current, decision) {
+			continue
+		}
+		changes = append(changes, decision)
+		current = CurrentConsents(append(current, decision))
+	}
+	if len(changes) == 0 {
+		return current, nil
+	}
+	if err := c.repo.AppendConsents(ctx, changes); err != nil {
+		return nil, err
+	}
+	for _, change := range changes {
+		c.events.Handle(ctx, NewCustomerConsentChanged(change))
+	}
+	return current, nil
+}
+
+// ConsentingCustomers answers e.g. whom we may email: the customers who granted the purpose on the channel.
+func (c *Consents) ConsentingCustomers(ctx context.Context, purpose, channel string, after CustomerID, limit int) ([]Customer, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if !isConsentPurpose(purpose) {
+		return nil, fmt.Errorf("%w: unknown purpose %q", ErrInvalidConsent, purpose)
+	}
+	if !isConsentChannel(channel) {
+		return nil, fmt.Errorf("%w: unknown channel %q", ErrInvalidConsent, channel)
+	}
+	if limit <= 0 {
+		limit = defaultConsentingLimit
+	}
+	if limit > maxConsentingLimit {
+		limit = maxConsentingLimit
+	}
+	customers, err := c.repo.ConsentingCustomers(ctx, purpose, channel, after, limit)
+	if err != nil {
+		return nil, err
+	}
+	// the custom attributes are listed by Attributes.Search, which knows their visibility
+	for i := range customers {
+		customers[i].Attributes = nil
+	}
+	return customers, nil
+}
+
+// changesConsent reports whether the decision differs from the current consent of its purpose and channel.
+// Granting again under a new policy version is a change.
+func changesConsent(current []Consent, decision Consent) bool {
+	for _, consent := range current {
+		if consent.Purpose == decision.Purpose && consent.Channel == decision.Channel {
+			return consent.Granted != decision.Granted || (decision.Granted && consent.PolicyVersion != decision.PolicyVersion)
+		}
+	}
+	return true
+}
+
+func validateConsent(consent Consent) error {
+	if !isConsentPurpose(consent.Purpose) {
+		return fmt.Errorf("%w: unknown purpose %q", ErrInvalidConsent, consent.Purpose)
+	}
+	if !isConsentChannel(consent.Channel) {
+		return fmt.Errorf("%w: unknown channel %q", ErrInvalidConsent, consent.Channel)
+	}
+	if consent.Source == "" {
+		return fmt.Errorf("%w: source is required", ErrInvalidConsent)
+	}
+	if consent.Granted && consent.PolicyVersion == "" {
+		return fmt.Errorf("%w: policy version is required to grant a consent", ErrInvalidConsent)
+	}
+	if len(consent.Source) > maxConsentFieldLength || len(consent.PolicyVersion) > maxConsentFieldLength {
+		return fmt.Errorf("%w: source and policy version must be at most %d characters long", ErrInvalidConsent, maxConsentFieldLength)
+	}
+	return nil
+}
+
+func isConsentPurpose(purpose string) bool {
+	switch purpose {
+	case ConsentPurposeMarketing, ConsentPurposePersonalizedAds:
+		return true
+	default:
+		return false
+	}
+}
+
+func isConsentChannel(channel string) bool {
+	switch channel {
+	case ConsentChannelEmail, ConsentChannelSMS, ConsentChannelPush, ConsentChannelWeb:
+		return true
+	default:
+		return false
+	}
+}
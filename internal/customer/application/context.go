@@ -8,7 +8,12 @@ import (
 
 type userIDContextKeyType string
 
-const userIDContextKey userIDContextKeyType = "userID"
+const (
+	userIDContextKey userIDContextKeyType = "userID"
+	adminContextKey  userIDContextKeyType = "admin"
+
+	acceptLanguageContextKey userIDContextKeyType = "acceptLanguage"
+)
 
 func WithUserID(ctx context.Context, userID uuid.UUID) context.Context {
 	return context.WithValue(ctx, userIDContextKey, userID)
@@ -22,3 +27,23 @@ func GetUserID(ctx context.Context) *uuid.UUID {
 
 	return &userID
 }
+
+// WithAdmin marks the operations as performed by an operator, who may access any customer.
+func WithAdmin(ctx context.Context) context.Context {
+	return context.WithValue(ctx, adminContextKey, true)
+}
+
+func IsAdmin(ctx context.Context) bool {
+	admin, _ := ctx.Value(adminContextKey).(bool)
+	return admin
+}
+
+// WithAcceptLanguage keeps the Accept-Language header of a registration, the preferences of the new customer are derived from it.
+func WithAcceptLanguage(ctx context.Context, acceptLanguage string) context.Context {
+	return context.WithValue(ctx, acceptLanguageContextKey, acceptLanguage)
+}
+
+func GetAcceptLanguage(ctx context.Context) string {
+	acceptLanguage, _ := ctx.Value(acceptLanguageContextKey).(string)
+	return acceptLanguage
+}
@@ -0,0 +1,138 @@
+package application
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Weights of the signals of a duplicate, combined as independent evidence: 1 - (1-w1)(1-w2)...
+// A single signal stays below the default flag threshold, two reach it unless the names only resemble each other.
+const (
+	duplicateEmailWeight = 0.7
+	duplicatePhoneWeight = 0.6
+	duplicateNameWeight  = 0.6
+	// minNameSimilarity is the trigram similarity from which names count as a signal.
+	minNameSimilarity = 0.5
+)
+
+// gmailDomains ignore the dots of the local part.
+var gmailDomains = map[string]bool{"gmail.com": true, "googlemail.com": true}
+
+// newMatchKeys normalizes the fields of the customer which are compared to find its duplicates.
+func newMatchKeys(customer Customer, phoneCountryCode string) MatchKeys {
+	return MatchKeys{
+		CustomerID: customer.ID,
+		Email:      normalizeEmail(customer.Email),
+		Phone:      normalizePhone(customer.Phone, phoneCountryCode),
+		Name:       normalizeName(customer.FirstName + " " + customer.LastName),
+	}
+}
+
+// normalizeEmail lowercases the address and drops the subaddress, e.g. "John.Doe+shop@GoogleMail.com"
+// is "johndoe@gmail.com".
+func normalizeEmail(email string) string {
+	email = strings.ToLower(strings.TrimSpace(email))
+	at := strings.LastIndex(email, "@")
+	if at <= 0 {
+		return email
+	}
+	local, domain := email[:at], email[at+1:]
+	if plus := strings.Index(local, "+"); plus > 0 {
+		local = local[:plus]
+	}
+	if gmailDomains[domain] {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+	return local + "@" + domain
+}
+
+// normalizePhone returns the number in E.164 form, e.g. "+4930123456". Numbers without a country code get
+// countryCode in place of their trunk prefix 0; without countryCode, and for numbers which are not valid
+// E.164 numbers, it returns "".
+func normalizePhone(phone, countryCode string) string {
+	phone = strings.TrimSpace(phone)
+	international := strings.HasPrefix(phone, "+")
+	digits := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		return -1
+	}, phone)
+	switch {
+	case international:
+	case strings.HasPrefix(digits, "00"):
+		digits = digits[2:]
+	case countryCode != "":
+		digits = countryCode + strings.TrimPrefix(digits, "0")
+	default:
+		return ""
+	}
+	if len(digits) < 8 || len(digits) > 15 || digits[0] == '0' {
+		return ""
+	}
+	return "+" + digits
+}
+
+// normalizeName lowercases the name, removes diacritics and punctuation and collapses spaces,
+// e.g. "  Jürgen  O'Neil" is "jurgen o neil".
+func normalizeName(name string) string {
+	decomposed, _, err := transform.String(transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC), name)
+	if err == nil {
+		name = decomposed
+	}
+	return strings.Join(strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	}), " ")
+}
+
+// trigrams returns the trigrams of the words like pg_trgm: every word is padded with two spaces in front
+// and one behind, so "jon" has "  j", " jo", "jon" and "on ".
+func trigrams(name string) map[string]bool {
+	set := map[string]bool{}
+	for _, word := range strings.Fields(name) {
+		padded := []rune("  " + word + " ")
+		for i := 0; i+3 <= len(padded); i++ {
+			set[string(padded[i:i+3])] = true
+		}
+	}
+	return set
+}
+
+// nameSimilarity is the share of the trigrams of both names that they have in common, from 0 to 1.
+func nameSimilarity(a, b string) float64 {
+	trigramsA, trigramsB := trigrams(a), trigrams(b)
+	if len(trigramsA) == 0 || len(trigramsB) == 0 {
+		return 0
+	}
+	common := 0
+	for trigram := range trigramsA {
+		if trigramsB[trigram] {
+			common++
+		}
+	}
+	return float64(common) / float64(len(trigramsA)+len(trigramsB)-common)
+}
+
+// scoreDuplicate returns the likelihood that the customers of the keys are the same person and the signals it is based on.
+func scoreDuplicate(a, b MatchKeys) (float64, []string) {
+	var reasons []string
+	unlikely := 1.0
+	if a.Email != "" && a.Email == b.Email {
+		unlikely *= 1 - duplicateEmailWeight
+		reasons = append(reasons, DuplicateReasonEmail)
+	}
+	if a.Phone != "" && a.Phone == b.Phone {
+		unlikely *= 1 - duplicatePhoneWeight
+		reasons = append(reasons, DuplicateReasonPhone)
+	}
+	if similarity := nameSimilarity(a.Name, b.Name); similarity >= minNameSimilarity {
+		unlikely *= 1 - duplicateNameWeight*similarity
+		reasons = append(reasons, DuplicateReasonName)
+	}
+	return 1 - unlikely, reasons
+}
@@ -0,0 +1,220 @@
+package application
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// Signals of a duplicate, see scoreDuplicate.
+const (
+	DuplicateReasonEmail = "email"
+	DuplicateReasonPhone = "phone"
+	DuplicateReasonName  = "name"
+)
+
+type DuplicateSettings struct {
+	// FlagThreshold is the score from which a candidate is flagged as a likely duplicate.
+	FlagThreshold float64
+	// ReportThreshold is the lowest score of a candidate that is kept for the report.
+	ReportThreshold float64
+	// PhoneCountryCode is the calling code of phone numbers entered without one, e.g. "49".
+	// Without it, only numbers with a country code are compared.
+	PhoneCountryCode string
+	// MaxCandidates bounds the customers scored against one customer.
+	MaxCandidates int
+}
+
+// MatchKeys are the normalized fields of a customer which are compared to find duplicates.
+type MatchKeys struct {
+	CustomerID CustomerID
+	Email      string
+	// Phone is in E.164 form, empty when the number could not be normalized.
+	Phone string
+	Name  string
+}
+
+// DuplicatePair is a pair of customers which are likely the same person.
+type DuplicatePair struct {
+	CustomerID  CustomerID
+	CandidateID CustomerID
+	// Score is the likelihood of a duplicate from 0 to 1.
+	Score      float64
+	Reasons    []string
+	DetectedAt time.Time
+}
+
+// DuplicateCluster is a group of customers connected by duplicate pairs.
+type DuplicateCluster struct {
+	CustomerIDs []CustomerID
+	Pairs       []DuplicatePair
+}
+
+type DuplicateRepository interface {
+	// SaveMatchKeys replaces the keys of the customer.
+	SaveMatchKeys(ctx context.Context, keys MatchKeys) error
+	// FindMatchCandidates returns the keys of up to limit other customers with the same email or phone,
+	// or a similar name, the most similar names first.
+	FindMatchCandidates(ctx context.Context, keys MatchKeys, limit int) ([]MatchKeys, error)
+	// SaveDuplicates replaces the pairs of the customer, each pair has the customer as its CustomerID.
+	SaveDuplicates(ctx context.Context, id CustomerID, pairs []DuplicatePair) error
+	// DuplicatesOf returns the pairs of the customer with at least minScore, the customer is their CustomerID.
+	DuplicatesOf(ctx context.Context, id CustomerID, minScore float64) ([]DuplicatePair, error)
+	// DuplicatePairs passes every pair with at least minScore to handle, an error of handle stops it.
+	DuplicatePairs(ctx context.Context, minScore float64, handle func(pair DuplicatePair) error) error
+}
+
+// Duplicates scores customers against the ones they share an email, a phone or a name with.
+// Customers are checked when they register or change their profile; Scan checks everyone.
+type Duplicates struct {
+	repo      DuplicateRepository
+	customers Repository
+	settings  DuplicateSettings
+}
+
+func NewDuplicates(repo DuplicateRepository, customers Repository, settings DuplicateSettings) *Duplicates {
+	return &Duplicates{
+		repo:      repo,
+		customers: customers,
+		settings:  settings,
+	}
+}
+
+// Check saves the duplicate pairs of the customer which reach the report threshold.
+func (d *Duplicates) Check(ctx context.Context, customer Customer) ([]DuplicatePair, error) {
+	keys := newMatchKeys(customer, d.settings.PhoneCountryCode)
+	if err := d.repo.SaveMatchKeys(ctx, keys); err != nil {
+		return nil, err
+	}
+	candidates, err := d.repo.FindMatchCandidates(ctx, keys, d.settings.MaxCandidates)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	var pairs []DuplicatePair
+	for _, candidate := range candidates {
+		score, reasons := scoreDuplicate(keys, candidate)
+		if score < d.settings.ReportThreshold {
+			continue
+		}
+		pairs = append(pairs, DuplicatePair{
+			CustomerID:  customer.ID,
+			CandidateID: candidate.CustomerID,
+			Score:       score,
+			Reasons:     reasons,
+			DetectedAt:  now,
+		})
+	}
+	sortDuplicatePairs(pairs)
+	if err := d.repo.SaveDuplicates(ctx, customer.ID, pairs); err != nil {
+		return nil, err
+	}
+	return pairs, nil
+}
+
+// Flagged tells whether the pair is a likely duplicate.
+func (d *Duplicates) Flagged(pair DuplicatePair) bool {
+	return pair.Score >= d.settings.FlagThreshold
+}
+
+// Scan checks every customer, e.g. after the thresholds were changed, and returns the number of customers checked.
+func (d *Duplicates) Scan(ctx context.Context, handle func(customer Customer, pairs []DuplicatePair)) (int, error) {
+	if !IsAdmin(ctx) {
+		return 0, ErrNotAuthorized
+	}
+	checked := 0
+	err := d.customers.Stream(ctx, CustomerFilter{}, func(customer Customer) error {
+		pairs, err := d.Check(ctx, customer)
+		if err != nil {
+			return err
+		}
+		checked++
+		handle(customer, pairs)
+		return nil
+	})
+	return checked, err
+}
+
+// DuplicatesOf returns the candidates of the customer, the likeliest first.
+func (d *Duplicates) DuplicatesOf(ctx context.Context, id CustomerID) ([]DuplicatePair, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if _, err := d.customers.FindByID(ctx, id); err != nil {
+		return nil, err
+	}
+	pairs, err := d.repo.DuplicatesOf(ctx, id, d.settings.ReportThreshold)
+	if err != nil {
+		return nil, err
+	}
+	sortDuplicatePairs(pairs)
+	return pairs, nil
+}
+
+// Clusters groups the customers connected by pairs with at least minScore, the flag threshold when it is 0.
+// Pairs below the report threshold are not kept. The largest clusters come first.
+func (d *Duplicates) Clusters(ctx context.Context, minScore float64) ([]DuplicateCluster, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if minScore == 0 {
+		minScore = d.settings.FlagThreshold
+	}
+	parents := map[CustomerID]CustomerID{}
+	var find func(id CustomerID) CustomerID
+	find = func(id CustomerID) CustomerID {
+		parent, ok := parents[id]
+		if !ok || parent == id {
+			parents[id] = id
+			return id
+		}
+		root := find(parent)
+		parents[id] = root
+		return root
+	}
+	var pairs []DuplicatePair
+	err := d.repo.DuplicatePairs(ctx, minScore, func(pair DuplicatePair) error {
+		pairs = append(pairs, pair)
+		parents[find(pair.CustomerID)] = find(pair.CandidateID)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	byRoot := map[CustomerID]*DuplicateCluster{}
+	var clusters []*DuplicateCluster
+	for _, pair := range pairs {
+		root := find(pair.CustomerID)
+		cluster, ok := byRoot[root]
+		if !ok {
+			cluster = &DuplicateCluster{}
+			byRoot[root] = cluster
+			clusters = append(clusters, cluster)
+		}
+		cluster.Pairs = append(cluster.Pairs, pair)
+	}
+	result := make([]DuplicateCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		seen := map[CustomerID]bool{}
+		for _, pair := range cluster.Pairs {
+			for _, id := range []CustomerID{pair.CustomerID, pair.CandidateID} {
+				if !seen[id] {
+					seen[id] = true
+					cluster.CustomerIDs = append(cluster.CustomerIDs, id)
+				}
+			}
+		}
+		sort.Slice(cluster.CustomerIDs, func(i, j int) bool {
+			return cluster.CustomerIDs[i].String() < cluster.CustomerIDs[j].String()
+		})
+		sortDuplicatePairs(cluster.Pairs)
+		result = append(result, *cluster)
+	}
+	sort.SliceStable(result, func(i, j int) bool { return len(result[i].CustomerIDs) > len(result[j].CustomerIDs) })
+	return result, nil
+}
+
+func sortDuplicatePairs(pairs []DuplicatePair) {
+	sort.SliceStable(pairs, func(i, j int) bool { return pairs[i].Score > pairs[j].Score })
+}
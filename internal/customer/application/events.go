@@ -0,0 +1,164 @@
+package application
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const (
+	EventTypeCustomerRegistered = "customer.registered"
+	EventTypeCustomerUpdated    = "customer.updated"
+	EventTypeCustomerClosed     = "customer.closed"
+	EventTypeConsentChanged     = "customer.consent_changed"
+	EventTypeStatusChanged      = "customer.status_changed"
+	EventTypeCustomersMerged    = "customer.merged"
+	// EventTypeCustomerTagsChanged is internal to the service, it is not delivered as a webhook.
+	EventTypeCustomerTagsChanged = "customer.tags_changed"
+)
+
+// Event is a change of a customer, dispatched synchronously after it is persisted.
+type Event interface {
+	EventType() string
+	CustomerID() CustomerID
+	OccurredAt() time.Time
+}
+
+type customerEvent struct {
+	eventType  string
+	customerID CustomerID
+	occurredAt time.Time
+}
+
+func (e customerEvent) EventType() string {
+	return e.eventType
+}
+
+func (e customerEvent) CustomerID() CustomerID {
+	return e.customerID
+}
+
+func (e customerEvent) OccurredAt() time.Time {
+	return e.occurredAt
+}
+
+type CustomerRegistered struct {
+	customerEvent
+	Customer Customer
+}
+
+type CustomerUpdated struct {
+	customerEvent
+	Customer Customer
+}
+
+type CustomerClosed struct {
+	customerEvent
+}
+
+type CustomerStatusChanged struct {
+	customerEvent
+	Customer Customer
+	Change   StatusChange
+}
+
+// CustomersMerged is an event of the merged customer, which now is the survivor.
+type CustomersMerged struct {
+	customerEvent
+	Survivor Customer
+	Merge    Merge
+}
+
+type CustomerTagsChanged struct {
+	customerEvent
+	Tags []string
+}
+
+type CustomerConsentChanged struct {
+	customerEvent
+	Consent Consent
+}
+
+func NewCustomerRegistered(customer Customer) CustomerRegistered {
+	return CustomerRegistered{
+		customerEvent: customerEvent{eventType: EventTypeCustomerRegistered, customerID: customer.ID, occurredAt: time.Now().UTC()},
+		Customer:      customer,
+	}
+}
+
+func NewCustomerUpdated(customer Customer) CustomerUpdated {
+	return CustomerUpdated{
+		customerEvent: customerEvent{eventType: EventTypeCustomerUpdated, customerID: customer.ID, occurredAt: time.Now().UTC()},
+		Customer:      customer,
+	}
+}
+
+func NewCustomerClosed(id CustomerID) CustomerClosed {
+	return CustomerClosed{
+		customerEvent: customerEvent{eventType: EventTypeCustomerClosed, customerID: id, occurredAt: time.Now().UTC()},
+	}
+}
+
+func NewCustomerStatusChanged(customer Customer, change StatusChange) CustomerStatusChanged {
+	return CustomerStatusChanged{
+		customerEvent: customerEvent{eventType: EventTypeStatusChanged, customerID: customer.ID, occurredAt: change.ChangedAt},
+		Customer:      customer,
+		Change:        change,
+	}
+}
+
+func NewCustomersMerged(survivor Customer, merge Merge) CustomersMerged {
+	return CustomersMerged{
+		customerEvent: customerEvent{eventType: EventTypeCustomersMerged, customerID: merge.MergedID, occurredAt: merge.MergedAt},
+		Survivor:      survivor,
+		Merge:         merge,
+	}
+}
+
+func NewCustomerTagsChanged(id CustomerID, tags []string) CustomerTagsChanged {
+	return CustomerTagsChanged{
+		customerEvent: customerEvent{eventType: EventTypeCustomerTagsChanged, customerID: id, occurredAt: time.Now().UTC()},
+		Tags:          tags,
+	}
+}
+
+func NewCustomerConsentChanged(consent Consent) CustomerConsentChanged {
+	return CustomerConsentChanged{
+		customerEvent: customerEvent{eventType: EventTypeConsentChanged, customerID: consent.CustomerID, occurredAt: consent.RecordedAt},
+		Consent:       consent,
+	}
+}
+
+type EventHandler interface {
+	Handle(ctx context.Context, event Event)
+}
+
+type EventHandlerFunc func(ctx context.Context, event Event)
+
+func (f EventHandlerFunc) Handle(ctx context.Context, event Event) {
+	f(ctx, event)
+}
+
+// EventDispatcher passes every event to all subscribed handlers in subscription order.
+type EventDispatcher struct {
+	mu       sync.RWMutex
+	handlers []EventHandler
+}
+
+func NewEventDispatcher() *EventDispatcher {
+	return &EventDispatcher{}
+}
+
+func (d *EventDispatcher) Subscribe(handler EventHandler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.handlers = append(d.handlers, handler)
+}
+
+func (d *EventDispatcher) Handle(ctx context.Context, event Event) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	for _, handler := range d.handlers {
+		handler.Handle(ctx, event)
+	}
+}
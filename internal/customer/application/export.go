@@ -0,0 +1,139 @@
+package application
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Columns of a customer which may be redacted in an export.
+const (
+	ColumnFirstName = "firstName"
+	ColumnLastName  = "lastName"
+	ColumnEmail     = "email"
+	ColumnPhone     = "phone"
+)
+
+const (
+	// RedactDrop empties the column.
+	RedactDrop = "drop"
+	// RedactHash replaces the column with the HMAC-SHA256 of its normalized value, so that the consumers
+	// may still join on it but cannot recover it by hashing guesses such as known email addresses.
+	RedactHash = "hash"
+)
+
+var ErrHashKeyMissing = errors.New("hash redaction needs a configured key")
+
+// CustomerWriter encodes exported customers, Close completes the output.
+type CustomerWriter interface {
+	Write(customer Customer) error
+	Close() error
+}
+
+type ExportOptions struct {
+	Filter CustomerFilter
+	// Redact maps a column to a redaction mode.
+	Redact map[string]string
+}
+
+// Exporter streams customers to a writer without holding them in memory.
+type Exporter struct {
+	repo    Repository
+	hashKey []byte
+}
+
+// NewExporter returns an exporter which hashes with the key, an empty key disables RedactHash.
+func NewExporter(repo Repository, hashKey []byte) *Exporter {
+	return &Exporter{
+		repo:    repo,
+		hashKey: hashKey,
+	}
+}
+
+// Export returns the number of written customers. The writer is not closed when the export fails,
+// so that the output is not mistaken for a complete one.
+func (e *Exporter) Export(ctx context.Context, writer CustomerWriter, options ExportOptions) (int, error) {
+	if !IsAdmin(ctx) {
+		return 0, ErrNotAuthorized
+	}
+	if err := ValidateRedaction(options.Redact); err != nil {
+		return 0, err
+	}
+	if len(e.hashKey) == 0 {
+		for _, mode := range options.Redact {
+			if mode == RedactHash {
+				return 0, ErrHashKeyMissing
+			}
+		}
+	}
+	count := 0
+	err := e.repo.Stream(ctx, options.Filter, func(customer Customer) error {
+		if err := writer.Write(e.redact(customer, options.Redact)); err != nil {
+			return err
+		}
+		count++
+		return nil
+	})
+	if err != nil {
+		return count, err
+	}
+	return count, writer.Close()
+}
+
+// ParseRedaction parses a comma separated list of column:mode pairs, e.g. "email:hash,phone:drop".
+func ParseRedaction(value string) (map[string]string, error) {
+	redaction := make(map[string]string)
+	if value == "" {
+		return redaction, nil
+	}
+	for _, pair := range strings.Split(value, ",") {
+		column, mode, ok := strings.Cut(strings.TrimSpace(pair), ":")
+		if !ok {
+			mode = RedactDrop
+		}
+		redaction[column] = mode
+	}
+	return redaction, ValidateRedaction(redaction)
+}
+
+func ValidateRedaction(redaction map[string]string) error {
+	for column, mode := range redaction {
+		switch column {
+		case ColumnFirstName, ColumnLastName, ColumnEmail, ColumnPhone:
+		default:
+			return fmt.Errorf("column %q cannot be redacted", column)
+		}
+		if mode != RedactDrop && mode != RedactHash {
+			return fmt.Errorf("unknown redaction mode %q", mode)
+		}
+	}
+	return nil
+}
+
+func (e *Exporter) redact(customer Customer, redaction map[string]string) Customer {
+	for column, mode := range redaction {
+		var field *string
+		switch column {
+		case ColumnFirstName:
+			field = &customer.FirstName
+		case ColumnLastName:
+			field = &customer.LastName
+		case ColumnEmail:
+			field = &customer.Email
+		case ColumnPhone:
+			field = &customer.Phone
+		}
+		if mode == RedactHash && *field != "" {
+			mac := hmac.New(sha256.New, e.hashKey)
+			mac.Write([]byte(strings.ToLower(strings.TrimSpace(*field))))
+			*field = hex.EncodeToString(mac.Sum(nil))
+		} else {
+			*field = ""
+		}
+	}
+	return customer
+}
@@ -0,0 +1,23 @@
+package application
+
+import (
+	"context"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+// IdentityProvider manages customer credentials. Registration spans the identity provider
+// and the customers repository, so a failed customer creation is compensated with Delete.
+type IdentityProvider interface {
+	Register(ctx context.Context, username, password string) (uuid.UUID, error)
+	Delete(ctx context.Context, userID uuid.UUID) error
+}
+
+// IdentityLister pages through all identities of the identity provider.
+type IdentityLister interface {
+	// ListIdentities returns up to limit identities after the cursor, which is opaque: an empty one starts
+	// at the beginning, an empty next one follows the last page. An identity may be listed more than once.
+	ListIdentities(ctx context.Context, cursor string, limit int) (ids []uuid.UUID, next string, err error)
+	// IdentityExists reports whether the identity provider has the identity.
+	IdentityExists(ctx context.Context, userID uuid.UUID) (bool, error)
+}
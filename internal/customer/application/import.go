@@ -0,0 +1,298 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"regexp"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+const (
+	defaultImportBatchSize   = 100
+	defaultImportConcurrency = 4
+	maxImportConcurrency     = 32
+	// maxImportErrors bounds the report of a large import with mostly broken rows.
+	maxImportErrors = 1000
+	// maxFieldLength matches the column sizes of the customers table.
+	maxFieldLength = 256
+)
+
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9\-\s()]{3,30}$`)
+
+// ErrDuplicateEmail reports a row whose email belongs to a customer already, or to an earlier row of the import.
+var ErrDuplicateEmail = errors.New("customer with such email already exists")
+
+// ImportRecord is a row of an import file. Err is set when the row could not be parsed.
+type ImportRecord struct {
+	Line      int
+	ID        string
+	Username  string
+	Password  string
+	FirstName string
+	LastName  string
+	Email     string
+	Phone     string
+	Err       error
+}
+
+// ImportSource yields the records of an import file until io.EOF.
+// Any other error aborts the import.
+type ImportSource interface {
+	Read() (ImportRecord, error)
+}
+
+type ImportOptions struct {
+	// DryRun validates and dedupes the records without creating anything.
+	DryRun bool
+	// ProvisionIdentities registers an identity for every record, username and password become required.
+	ProvisionIdentities bool
+	BatchSize           int
+	Concurrency         int
+	// ResumeAfter skips the records up to this line, the checkpoint of an interrupted import.
+	ResumeAfter int
+	// OnBatch is called with the report after every completed batch.
+	OnBatch func(report ImportReport)
+}
+
+type ImportRowError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type ImportReport struct {
+	DryRun          bool             `json:"dryRun"`
+	Read            int              `json:"read"`
+	Skipped         int              `json:"skipped"`
+	Imported        int              `json:"imported"`
+	Duplicates      int              `json:"duplicates"`
+	Invalid         int              `json:"invalid"`
+	Failed          int              `json:"failed"`
+	Checkpoint      int              `json:"checkpoint"`
+	Errors          []ImportRowError `json:"errors"`
+	ErrorsTruncated bool             `json:"errorsTruncated,omitempty"`
+}
+
+// Importer creates customers from import files in batches. Records are deduped by email
+// against the existing customers and against each other, so a repeated import creates nothing twice.
+// A batch is completed before the next one is read, the line of its last record is the checkpoint.
+type Importer struct {
+	service Service
+}
+
+func NewImporter(service Service) *Importer {
+	return &Importer{
+		service: service,
+	}
+}
+
+type importRun struct {
+	options ImportOptions
+	mu      sync.Mutex
+	report  ImportReport
+	emails  map[string]bool
+}
+
+func (i *Importer) Import(ctx context.Context, source ImportSource, options ImportOptions) (*ImportReport, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if options.BatchSize <= 0 {
+		options.BatchSize = defaultImportBatchSize
+	}
+	if options.Concurrency <= 0 {
+		options.Concurrency = defaultImportConcurrency
+	}
+	if options.Concurrency > maxImportConcurrency {
+		options.Concurrency = maxImportConcurrency
+	}
+	run := &importRun{
+		options: options,
+		report:  ImportReport{DryRun: options.DryRun, Checkpoint: options.ResumeAfter, Errors: []ImportRowError{}},
+		emails:  make(map[string]bool),
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return run.snapshot(), err
+		}
+		batch, err := run.readBatch(source)
+		if err != nil {
+			return run.snapshot(), err
+		}
+		if len(batch) > 0 {
+			i.importBatch(ctx, run, batch)
+			if err := ctx.Err(); err != nil {
+				// the batch may be incomplete, so the checkpoint stays before it
+				return run.snapshot(), err
+			}
+			run.report.Checkpoint = batch[len(batch)-1].Line
+			if options.OnBatch != nil {
+				options.OnBatch(*run.snapshot())
+			}
+		}
+		if len(batch) < options.BatchSize {
+			return run.snapshot(), nil
+		}
+	}
+}
+
+func (r *importRun) readBatch(source ImportSource) ([]ImportRecord, error) {
+	var batch []ImportRecord
+	for len(batch) < r.options.BatchSize {
+		record, err := source.Read()
+		if errors.Is(err, io.EOF) {
+			return batch, nil
+		}
+		if err != nil {
+			return batch, fmt.Errorf("failed to read import file: %w", err)
+		}
+		if record.Line <= r.options.ResumeAfter {
+			r.report.Skipped++
+			continue
+		}
+		r.report.Read++
+		batch = append(batch, record)
+	}
+	return batch, nil
+}
+
+func (i *Importer) importBatch(ctx context.Context, run *importRun, batch []ImportRecord) {
+	semaphore := make(chan struct{}, run.options.Concurrency)
+	var wg sync.WaitGroup
+	for _, record := range batch {
+		if err := validateImportRecord(record, run.options.ProvisionIdentities); err != nil {
+			run.fail(record.Line, &run.report.Invalid, err)
+			continue
+		}
+		if !run.claimEmail(record.Email) {
+			run.fail(record.Line, &run.report.Duplicates, ErrDuplicateEmail)
+			continue
+		}
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(record ImportRecord) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			i.importRecord(ctx, run, record)
+		}(record)
+	}
+	wg.Wait()
+}
+
+func (i *Importer) importRecord(ctx context.Context, run *importRun, record ImportRecord) {
+	existing, err := i.service.FindByEmail(ctx, record.Email)
+	if err != nil {
+		run.fail(record.Line, &run.report.Failed, err)
+		return
+	}
+	if len(existing) > 0 {
+		run.fail(record.Line, &run.report.Duplicates, ErrDuplicateEmail)
+		return
+	}
+	if run.options.DryRun {
+		run.succeed()
+		return
+	}
+
+	if run.options.ProvisionIdentities {
+		_, err = i.service.Register(ctx, record.Username, record.Password, record.FirstName, record.LastName, record.Email, record.Phone)
+	} else {
+		id := uuid.Generate()
+		if record.ID != "" {
+			id, _ = uuid.FromString(record.ID)
+		}
+		_, err = i.service.Create(ctx, id, record.FirstName, record.LastName, record.Email, record.Phone)
+	}
+	switch {
+	case errors.Is(err, ErrDuplicateUser):
+		run.fail(record.Line, &run.report.Duplicates, err)
+	case errors.Is(err, ErrUsernameTaken), errors.Is(err, ErrWeakPassword):
+		run.fail(record.Line, &run.report.Invalid, err)
+	case err != nil:
+		run.fail(record.Line, &run.report.Failed, err)
+	default:
+		run.succeed()
+	}
+}
+
+// claimEmail reports whether the email was not seen earlier in the import.
+func (r *importRun) claimEmail(email string) bool {
+	key := strings.ToLower(email)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.emails[key] {
+		return false
+	}
+	r.emails[key] = true
+	return true
+}
+
+func (r *importRun) succeed() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.report.Imported++
+}
+
+func (r *importRun) fail(line int, counter *int, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	*counter++
+	if len(r.report.Errors) >= maxImportErrors {
+		r.report.ErrorsTruncated = true
+		return
+	}
+	r.report.Errors = append(r.report.Errors, ImportRowError{Line: line, Error: err.Error()})
+}
+
+func (r *importRun) snapshot() *ImportReport {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	report := r.report
+	report.Errors = append(make([]ImportRowError, 0, len(r.report.Errors)), r.report.Errors...)
+	return &report
+}
+
+func validateImportRecord(record ImportRecord, provisionIdentities bool) error {
+	if record.Err != nil {
+		return record.Err
+	}
+	if record.Email == "" {
+		return errors.New("email is required")
+	}
+	if address, err := mail.ParseAddress(record.Email); err != nil || address.Address != record.Email {
+		return fmt.Errorf("invalid email %q", record.Email)
+	}
+	if record.Phone != "" && !phonePattern.MatchString(record.Phone) {
+		return fmt.Errorf("invalid phone %q", record.Phone)
+	}
+	fields := []struct{ name, value string }{
+		{"firstName", record.FirstName},
+		{"lastName", record.LastName},
+		{"email", record.Email},
+		{"phone", record.Phone},
+	}
+	for _, field := range fields {
+		if utf8.RuneCountInString(field.value) > maxFieldLength {
+			return fmt.Errorf("%s is longer than %d characters", field.name, maxFieldLength)
+		}
+	}
+	if provisionIdentities {
+		if record.Username == "" || record.Password == "" {
+			return errors.New("username and password are required to provision an identity")
+		}
+	} else if record.ID != "" {
+		if _, err := uuid.FromString(record.ID); err != nil {
+			return fmt.Errorf("invalid id %q", record.ID)
+		}
+	}
+	return nil
+}
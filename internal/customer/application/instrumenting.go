@@ -0,0 +1,165 @@
+package application
+
+import (
+	"context"
+	"errors"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+// Steps of the registration funnel, in order.
+const (
+	FunnelStepStarted         = "started"
+	FunnelStepIdentityCreated = "identity_created"
+	FunnelStepProfileCreated  = "profile_created"
+)
+
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+)
+
+type Metrics struct {
+	Registrations metrics.Counter // labels: outcome
+	Updates       metrics.Counter // labels: outcome
+	Failures      metrics.Counter // labels: operation, error
+	Compensations metrics.Counter // labels: outcome
+	IdPFailures   metrics.Counter // labels: error
+	FunnelSteps   metrics.Counter // labels: step
+	StatusChanges metrics.Counter // labels: status, outcome
+}
+
+type instrumenting struct {
+	service Service
+	metrics *Metrics
+}
+
+func NewInstrumentingService(service Service, metrics *Metrics) Service {
+	return &instrumenting{
+		service: service,
+		metrics: metrics,
+	}
+}
+
+func (s instrumenting) Register(ctx context.Context, username, password, firstName, lastName, email, phone string) (CustomerID, error) {
+	s.metrics.FunnelSteps.With("step", FunnelStepStarted).Add(1)
+	id, err := s.service.Register(ctx, username, password, firstName, lastName, email, phone)
+	if err == nil {
+		s.metrics.FunnelSteps.With("step", FunnelStepIdentityCreated).Add(1)
+		s.metrics.FunnelSteps.With("step", FunnelStepProfileCreated).Add(1)
+		s.metrics.Registrations.With("outcome", outcomeSuccess).Add(1)
+		return id, nil
+	}
+
+	s.metrics.Registrations.With("outcome", outcomeFailure).Add(1)
+	s.recordFailure("Register", err)
+	var registrationErr *RegistrationError
+	if errors.As(err, &registrationErr) {
+		switch registrationErr.Step {
+		case RegistrationStepIdentity:
+			s.metrics.IdPFailures.With("error", errorType(err)).Add(1)
+		case RegistrationStepProfile:
+			s.metrics.FunnelSteps.With("step", FunnelStepIdentityCreated).Add(1)
+			if registrationErr.CompensationErr != nil {
+				s.metrics.Compensations.With("outcome", outcomeFailure).Add(1)
+				s.metrics.IdPFailures.With("error", errorType(registrationErr.CompensationErr)).Add(1)
+			} else {
+				s.metrics.Compensations.With("outcome", outcomeSuccess).Add(1)
+			}
+		}
+	}
+	return id, err
+}
+
+func (s instrumenting) Create(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (CustomerID, error) {
+	customerID, err := s.service.Create(ctx, id, firstName, lastName, email, phone)
+	s.recordFailure("Create", err)
+	return customerID, err
+}
+
+func (s instrumenting) FindByID(ctx context.Context, id uuid.UUID) (*Customer, error) {
+	customer, err := s.service.FindByID(ctx, id)
+	s.recordFailure("FindByID", err)
+	return customer, err
+}
+
+func (s instrumenting) Update(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (*Customer, error) {
+	customer, err := s.service.Update(ctx, id, firstName, lastName, email, phone)
+	if err != nil {
+		s.metrics.Updates.With("outcome", outcomeFailure).Add(1)
+		s.recordFailure("Update", err)
+	} else {
+		s.metrics.Updates.With("outcome", outcomeSuccess).Add(1)
+	}
+	return customer, err
+}
+
+func (s instrumenting) FindByEmail(ctx context.Context, email string) ([]Customer, error) {
+	customers, err := s.service.FindByEmail(ctx, email)
+	s.recordFailure("FindByEmail", err)
+	return customers, err
+}
+
+func (s instrumenting) Close(ctx context.Context, id uuid.UUID) error {
+	err := s.service.Close(ctx, id)
+	s.recordFailure("Close", err)
+	return err
+}
+
+func (s instrumenting) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason, note string) (*Customer, error) {
+	customer, err := s.service.ChangeStatus(ctx, id, status, reason, note)
+	if err != nil {
+		s.metrics.StatusChanges.With("status", status, "outcome", outcomeFailure).Add(1)
+		s.recordFailure("ChangeStatus", err)
+	} else {
+		s.metrics.StatusChanges.With("status", status, "outcome", outcomeSuccess).Add(1)
+	}
+	return customer, err
+}
+
+func (s instrumenting) StatusHistory(ctx context.Context, id uuid.UUID) ([]StatusChange, error) {
+	history, err := s.service.StatusHistory(ctx, id)
+	s.recordFailure("StatusHistory", err)
+	return history, err
+}
+
+func (s instrumenting) Merge(ctx context.Context, survivorID, mergedID uuid.UUID) (*Customer, error) {
+	customer, err := s.service.Merge(ctx, survivorID, mergedID)
+	s.recordFailure("Merge", err)
+	return customer, err
+}
+
+func (s instrumenting) recordFailure(operation string, err error) {
+	if err != nil {
+		s.metrics.Failures.With("operation", operation, "error", errorType(err)).Add(1)
+	}
+}
+
+// errorType maps an error to a label value of bounded cardinality.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, ErrCustomerNotFound):
+		return "not_found"
+	case errors.Is(err, ErrDuplicateUser):
+		return "duplicate"
+	case errors.Is(err, ErrNotAuthorized):
+		return "not_authorized"
+	case errors.Is(err, ErrUsernameTaken):
+		return "username_taken"
+	case errors.Is(err, ErrWeakPassword):
+		return "weak_password"
+	case errors.Is(err, ErrIdentityProviderUnavailable):
+		return "idp_unavailable"
+	case errors.Is(err, ErrAccountNotActive):
+		return "account_not_active"
+	case errors.Is(err, ErrInvalidStatusChange), errors.Is(err, ErrStatusTransitionNotAllowed):
+		return "invalid_status_change"
+	case errors.Is(err, ErrCustomerMerged):
+		return "merged"
+	case errors.Is(err, ErrInvalidMerge):
+		return "invalid_merge"
+	default:
+		return "internal"
+	}
+}
@@ -0,0 +1,56 @@
+package application
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrInvalidMerge = errors.New("invalid merge")
+	// ErrCustomerMerged is returned for the ID of a customer merged into another, see MergedError.
+	ErrCustomerMerged = errors.New("customer was merged into another")
+)
+
+// MergedError tells which customer an ID was merged into.
+type MergedError struct {
+	SurvivorID CustomerID
+}
+
+func (e *MergedError) Error() string {
+	return ErrCustomerMerged.Error() + ": " + e.SurvivorID.String()
+}
+
+func (e *MergedError) Unwrap() error {
+	return ErrCustomerMerged
+}
+
+// Merge describes the merge of a duplicate customer into the surviving one.
+type Merge struct {
+	SurvivorID CustomerID
+	MergedID   CustomerID
+	// Actor is the ID of the operator who merged the customers, or "system".
+	Actor    string
+	MergedAt time.Time
+}
+
+// MergeInto returns the survivor with the custom attributes of the merged customer it has no value of.
+// A closed account cannot survive a merge, and a suspended or blocked one cannot be merged away, since
+// the survivor would lift the restriction.
+func MergeInto(survivor, merged Customer, merge Merge) (Customer, error) {
+	if survivor.Status == StatusClosed {
+		return Customer{}, fmt.Errorf("%w: the surviving account is closed", ErrInvalidMerge)
+	}
+	if merged.Status == StatusSuspended || merged.Status == StatusBlocked {
+		return Customer{}, fmt.Errorf("%w: the merged account is %s", ErrInvalidMerge, merged.Status)
+	}
+	attributes := make(map[string]interface{}, len(merged.Attributes)+len(survivor.Attributes))
+	for _, source := range []map[string]interface{}{merged.Attributes, survivor.Attributes} {
+		for name, value := range source {
+			attributes[name] = value
+		}
+	}
+	survivor.Attributes = attributes
+	survivor.UpdatedAt = merge.MergedAt
+	return survivor, nil
+}
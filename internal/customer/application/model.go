@@ -1,6 +1,11 @@
 package application
 
-import "github.com/jnikolaeva/eshop-common/uuid"
+import (
+	"context"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
 
 type CustomerID uuid.UUID
 
@@ -14,10 +19,53 @@ type Customer struct {
 	LastName  string
 	Email     string
 	Phone     string
+	Status    string
+	// Attributes are the values of the custom attributes by their name, see AttributeDefinition.
+	Attributes map[string]interface{}
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	// IdentityMissingAt is when the reconciliation found no identity of the customer in the identity provider,
+	// nil while it has one.
+	IdentityMissingAt *time.Time
+}
+
+// CustomerFilter selects customers by the time of their last change, zero bounds are open.
+type CustomerFilter struct {
+	UpdatedSince  time.Time
+	UpdatedBefore time.Time
 }
 
 type Repository interface {
-	Add(user Customer) error
-	FindByID(id CustomerID) (*Customer, error)
-	Update(user Customer) error
+	Add(ctx context.Context, user Customer) error
+	FindByID(ctx context.Context, id CustomerID) (*Customer, error)
+	Update(ctx context.Context, user Customer) error
+	FindByEmail(ctx context.Context, email string) ([]Customer, error)
+	// List returns up to limit customers ordered by ID, starting after the given one.
+	List(ctx context.Context, after CustomerID, limit int) ([]Customer, error)
+	// FlagMissingIdentity marks the customer as having no identity in the identity provider.
+	FlagMissingIdentity(ctx context.Context, id CustomerID) error
+	// ClearMissingIdentity removes the mark of FlagMissingIdentity once the identity is found again.
+	ClearMissingIdentity(ctx context.Context, id CustomerID) error
+	// Stream passes the matching customers ordered by update time to handle, reading them with
+	// a server-side cursor from a consistent snapshot. An error of handle stops the stream.
+	Stream(ctx context.Context, filter CustomerFilter, handle func(customer Customer) error) error
+	// UpdateStatus saves the status of the customer and appends the change to its history.
+	// It returns ErrStatusTransitionNotAllowed when the customer is no longer in the status change.From.
+	UpdateStatus(ctx context.Context, customer Customer, change StatusChange) error
+	// Status returns the account status of the customer as stored, never from a cache, so that a status
+	// changed on another instance is seen at once. Authorization relies on it.
+	Status(ctx context.Context, id CustomerID) (string, error)
+	// StatusHistory returns the status changes of the customer in the order they were made.
+	StatusHistory(ctx context.Context, id CustomerID) ([]StatusChange, error)
+	// Merge locks both customers and merges them with MergeInto, then moves the consents, preferences, tax ID,
+	// organization memberships and tags of the merged customer to the survivor where the survivor has none.
+	// It deletes the merged customer, keeps its ID as an alias and returns the survivor.
+	Merge(ctx context.Context, merge Merge) (*Customer, error)
+	// UpdateAttributes sets the values of the custom attributes and removes the removed ones, leaving the other
+	// attributes of the customer as they are, and returns the customer afterwards.
+	UpdateAttributes(ctx context.Context, id CustomerID, values map[string]interface{}, removed []string, updatedAt time.Time) (*Customer, error)
+	// FindByAttributes returns up to limit customers with an ID greater than after whose attributes have the values, ordered by ID.
+	FindByAttributes(ctx context.Context, values map[string]interface{}, after CustomerID, limit int) ([]Customer, error)
+	// MergedInto returns the customer the ID was merged into, nil when it is not the ID of a merged customer.
+	MergedInto(ctx context.Context, id CustomerID) (*CustomerID, error)
 }
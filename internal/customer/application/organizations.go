@@ -0,0 +1,445 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"golang.org/x/text/language"
+)
+
+// Roles of the members of an organization, from the most to the least privileged.
+const (
+	// RoleOwner manages the organization and its owners.
+	RoleOwner = "owner"
+	// RoleAdmin manages the organization and its members except the owners, and views their profiles.
+	RoleAdmin = "admin"
+	// RoleBuyer places orders on behalf of the organization.
+	RoleBuyer = "buyer"
+	// RoleViewer only sees the organization.
+	RoleViewer = "viewer"
+)
+
+const (
+	invitationTTL         = 7 * 24 * time.Hour
+	maxOrganizationField  = 256
+	maxPostalCodeLength   = 32
+	invitationTokenLength = 32
+)
+
+var (
+	ErrOrganizationNotFound = errors.New("organization not found")
+	ErrInvalidOrganization  = errors.New("invalid organization")
+	ErrMemberNotFound       = errors.New("organization member not found")
+	// ErrInvitationNotFound is returned for unknown, expired and already accepted invitations alike.
+	ErrInvitationNotFound = errors.New("invitation not found or expired")
+	// ErrLastOwner refuses to leave an organization without an owner.
+	ErrLastOwner = errors.New("organization must keep at least one owner")
+)
+
+type Address struct {
+	Line1      string
+	Line2      string
+	City       string
+	PostalCode string
+	Region     string
+	// Country is an ISO 3166-1 alpha-2 code, e.g. "DE".
+	Country string
+}
+
+// Organization is a company whose employees share one account.
+type Organization struct {
+	ID             uuid.UUID
+	LegalName      string
+	BillingAddress Address
+	CreatedAt      time.Time
+	UpdatedAt      time.Time
+}
+
+type Membership struct {
+	OrganizationID uuid.UUID
+	CustomerID     CustomerID
+	Role           string
+	JoinedAt       time.Time
+}
+
+// Invitation lets the holder of the token join the organization. Only the hash of the token is stored.
+type Invitation struct {
+	ID             uuid.UUID
+	OrganizationID uuid.UUID
+	Email          string
+	Role           string
+	TokenHash      string
+	InvitedBy      CustomerID
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+}
+
+// OrganizationAccess answers whether a customer manages another through an organization they share.
+type OrganizationAccess interface {
+	// ManagesMember reports whether the manager is an owner or admin of an organization the member belongs to.
+	ManagesMember(ctx context.Context, managerID, memberID CustomerID) (bool, error)
+}
+
+type OrganizationRepository interface {
+	OrganizationAccess
+	// AddOrganization saves the organization together with its first owner.
+	AddOrganization(ctx context.Context, organization Organization, owner Membership) error
+	FindOrganization(ctx context.Context, id uuid.UUID) (*Organization, error)
+	UpdateOrganization(ctx context.Context, organization Organization) error
+	// Members returns the memberships of the organization in the order the customers joined.
+	Members(ctx context.Context, organizationID uuid.UUID) ([]Membership, error)
+	// MembershipsOf returns the memberships of the customer in the order they joined.
+	MembershipsOf(ctx context.Context, id CustomerID) ([]Membership, error)
+	// FindMembership returns ErrMemberNotFound when the customer is not a member.
+	FindMembership(ctx context.Context, organizationID uuid.UUID, id CustomerID) (*Membership, error)
+	UpdateMemberRole(ctx context.Context, organizationID uuid.UUID, id CustomerID, role string) error
+	RemoveMember(ctx context.Context, organizationID uuid.UUID, id CustomerID) error
+	AddInvitation(ctx context.Context, invitation Invitation) error
+	// FindInvitation returns ErrInvitationNotFound for an unknown token hash.
+	FindInvitation(ctx context.Context, tokenHash string) (*Invitation, error)
+	// AcceptInvitation marks the invitation accepted and adds the membership. It returns
+	// ErrInvitationNotFound when the invitation has already been accepted.
+	AcceptInvitation(ctx context.Context, invitation Invitation, membership Membership) error
+}
+
+// Organizations manages organizations, their members and invitations. Owners and admins manage
+// an organization, every member may view it. Operators may do anything.
+type Organizations struct {
+	repo      OrganizationRepository
+	customers Repository
+}
+
+func NewOrganizations(repo OrganizationRepository, customers Repository) *Organizations {
+	return &Organizations{
+		repo:      repo,
+		customers: customers,
+	}
+}
+
+// Create saves a new organization owned by the subject.
+func (o *Organizations) Create(ctx context.Context, organization Organization) (*Organization, error) {
+	subject, err := o.activeSubject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if err := canonicalizeOrganization(&organization); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	organization.ID = uuid.Generate()
+	organization.CreatedAt = now
+	organization.UpdatedAt = now
+	owner := Membership{
+		OrganizationID: organization.ID,
+		CustomerID:     subject,
+		Role:           RoleOwner,
+		JoinedAt:       now,
+	}
+	if err := o.repo.AddOrganization(ctx, organization, owner); err != nil {
+		return nil, err
+	}
+	return &organization, nil
+}
+
+func (o *Organizations) Get(ctx context.Context, id uuid.UUID) (*Organization, error) {
+	if err := o.authorize(ctx, id, RoleOwner, RoleAdmin, RoleBuyer, RoleViewer); err != nil {
+		return nil, err
+	}
+	return o.repo.FindOrganization(ctx, id)
+}
+
+// Update replaces the legal name and billing address.
+func (o *Organizations) Update(ctx context.Context, id uuid.UUID, organization Organization) (*Organization, error) {
+	if err := canonicalizeOrganization(&organization); err != nil {
+		return nil, err
+	}
+	if err := o.authorize(ctx, id, RoleOwner, RoleAdmin); err != nil {
+		return nil, err
+	}
+	saved, err := o.repo.FindOrganization(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	saved.LegalName = organization.LegalName
+	saved.BillingAddress = organization.BillingAddress
+	saved.UpdatedAt = time.Now().UTC()
+	if err := o.repo.UpdateOrganization(ctx, *saved); err != nil {
+		return nil, err
+	}
+	return saved, nil
+}
+
+// MembershipsOf returns the organizations the customer belongs to.
+func (o *Organizations) MembershipsOf(ctx context.Context, id uuid.UUID) ([]Membership, error) {
+	if _, err := findOwnedCustomer(ctx, o.customers, id); err != nil {
+		return nil, err
+	}
+	return o.repo.MembershipsOf(ctx, CustomerID(id))
+}
+
+func (o *Organizations) Members(ctx context.Context, id uuid.UUID) ([]Membership, error) {
+	if err := o.authorize(ctx, id, RoleOwner, RoleAdmin, RoleBuyer, RoleViewer); err != nil {
+		return nil, err
+	}
+	return o.repo.Members(ctx, id)
+}
+
+// ChangeRole sets the role of a member. Only owners grant or revoke the owner role.
+func (o *Organizations) ChangeRole(ctx context.Context, id uuid.UUID, memberID uuid.UUID, role string) (*Membership, error) {
+	if !isOrganizationRole(role) {
+		return nil, fmt.Errorf("%w: unknown role %q", ErrInvalidOrganization, role)
+	}
+	if err := o.authorize(ctx, id, RoleOwner, RoleAdmin); err != nil {
+		return nil, err
+	}
+	member, err := o.repo.FindMembership(ctx, id, CustomerID(memberID))
+	if err != nil {
+		return nil, err
+	}
+	if member.Role == role {
+		return member, nil
+	}
+	if member.Role == RoleOwner || role == RoleOwner {
+		if err := o.authorize(ctx, id, RoleOwner); err != nil {
+			return nil, err
+		}
+	}
+	if member.Role == RoleOwner {
+		if err := o.checkOtherOwner(ctx, id, member.CustomerID); err != nil {
+			return nil, err
+		}
+	}
+	if err := o.repo.UpdateMemberRole(ctx, id, member.CustomerID, role); err != nil {
+		return nil, err
+	}
+	member.Role = role
+	return member, nil
+}
+
+// RemoveMember removes a member from the organization. Members may leave on their own,
+// only owners remove other owners.
+func (o *Organizations) RemoveMember(ctx context.Context, id uuid.UUID, memberID uuid.UUID) error {
+	subjectID := GetUserID(ctx)
+	leaving := subjectID != nil && *subjectID == memberID
+	if leaving {
+		if _, err := o.activeSubject(ctx); err != nil {
+			return err
+		}
+	} else if err := o.authorize(ctx, id, RoleOwner, RoleAdmin); err != nil {
+		return err
+	}
+	member, err := o.repo.FindMembership(ctx, id, CustomerID(memberID))
+	if err != nil {
+		return err
+	}
+	if member.Role == RoleOwner {
+		if !leaving {
+			if err := o.authorize(ctx, id, RoleOwner); err != nil {
+				return err
+			}
+		}
+		if err := o.checkOtherOwner(ctx, id, member.CustomerID); err != nil {
+			return err
+		}
+	}
+	return o.repo.RemoveMember(ctx, id, member.CustomerID)
+}
+
+// Invite creates an invitation to join the organization with the role and returns it with its token.
+// The token is not stored and must be delivered to the invitee, e.g. in a link sent by email.
+func (o *Organizations) Invite(ctx context.Context, id uuid.UUID, email, role string) (*Invitation, string, error) {
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email {
+		return nil, "", fmt.Errorf("%w: %q is not an email address", ErrInvalidOrganization, email)
+	}
+	if !isOrganizationRole(role) {
+		return nil, "", fmt.Errorf("%w: unknown role %q", ErrInvalidOrganization, role)
+	}
+	allowed := []string{RoleOwner, RoleAdmin}
+	if role == RoleOwner {
+		allowed = []string{RoleOwner}
+	}
+	if err := o.authorize(ctx, id, allowed...); err != nil {
+		return nil, "", err
+	}
+	if _, err := o.repo.FindOrganization(ctx, id); err != nil {
+		return nil, "", err
+	}
+	token, err := generateInvitationToken()
+	if err != nil {
+		return nil, "", err
+	}
+	now := time.Now().UTC()
+	invitation := Invitation{
+		ID:             uuid.Generate(),
+		OrganizationID: id,
+		Email:          strings.ToLower(email),
+		Role:           role,
+		TokenHash:      hashInvitationToken(token),
+		CreatedAt:      now,
+		ExpiresAt:      now.Add(invitationTTL),
+	}
+	if subjectID := GetUserID(ctx); subjectID != nil {
+		invitation.InvitedBy = CustomerID(*subjectID)
+	}
+	if err := o.repo.AddInvitation(ctx, invitation); err != nil {
+		return nil, "", err
+	}
+	return &invitation, token, nil
+}
+
+// AcceptInvitation makes the subject a member of the organization of the invitation. The invitation
+// is accepted only by the customer with the invited email; a member keeps the role they have.
+func (o *Organizations) AcceptInvitation(ctx context.Context, token string) (*Membership, error) {
+	subject, err := o.activeSubject(ctx)
+	if err != nil {
+		return nil, err
+	}
+	invitation, err := o.repo.FindInvitation(ctx, hashInvitationToken(token))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	if invitation.AcceptedAt != nil || now.After(invitation.ExpiresAt) {
+		return nil, ErrInvitationNotFound
+	}
+	customer, err := o.customers.FindByID(ctx, subject)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.EqualFold(customer.Email, invitation.Email) {
+		return nil, ErrInvitationNotFound
+	}
+	if member, err := o.repo.FindMembership(ctx, invitation.OrganizationID, subject); err == nil {
+		return member, nil
+	} else if !errors.Is(err, ErrMemberNotFound) {
+		return nil, err
+	}
+	invitation.AcceptedAt = &now
+	membership := Membership{
+		OrganizationID: invitation.OrganizationID,
+		CustomerID:     subject,
+		Role:           invitation.Role,
+		JoinedAt:       now,
+	}
+	if err := o.repo.AcceptInvitation(ctx, *invitation, membership); err != nil {
+		return nil, err
+	}
+	return &membership, nil
+}
+
+// authorize refuses the subject who is not a member of the organization with one of the roles
+// or whose account is not active.
+func (o *Organizations) authorize(ctx context.Context, id uuid.UUID, roles ...string) error {
+	return authorizeMember(ctx, o.repo, o.customers, id, roles...)
+}
+
+// activeSubject returns the authenticated customer if their account is active.
+func (o *Organizations) activeSubject(ctx context.Context) (CustomerID, error) {
+	return activeSubject(ctx, o.customers)
+}
+
+func (o *Organizations) checkOtherOwner(ctx context.Context, id uuid.UUID, ownerID CustomerID) error {
+	members, err := o.repo.Members(ctx, id)
+	if err != nil {
+		return err
+	}
+	for _, member := range members {
+		if member.Role == RoleOwner && member.CustomerID != ownerID {
+			return nil
+		}
+	}
+	return ErrLastOwner
+}
+
+// authorizeMember refuses the subject who is not a member of the organization with one of the roles
+// or whose account is not active; operators are not refused.
+func authorizeMember(ctx context.Context, repo OrganizationRepository, customers Repository, id uuid.UUID, roles ...string) error {
+	if IsAdmin(ctx) {
+		return nil
+	}
+	subject, err := activeSubject(ctx, customers)
+	if err != nil {
+		return err
+	}
+	member, err := repo.FindMembership(ctx, id, subject)
+	if errors.Is(err, ErrMemberNotFound) {
+		return ErrNotAuthorized
+	}
+	if err != nil {
+		return err
+	}
+	for _, role := range roles {
+		if member.Role == role {
+			return nil
+		}
+	}
+	return ErrNotAuthorized
+}
+
+func activeSubject(ctx context.Context, customers Repository) (CustomerID, error) {
+	subjectID := GetUserID(ctx)
+	if subjectID == nil {
+		return CustomerID{}, ErrNotAuthorized
+	}
+	if _, err := findOwnedCustomer(ctx, customers, *subjectID); err != nil {
+		return CustomerID{}, err
+	}
+	return CustomerID(*subjectID), nil
+}
+
+func canonicalizeOrganization(organization *Organization) error {
+	organization.LegalName = strings.TrimSpace(organization.LegalName)
+	address := &organization.BillingAddress
+	if organization.LegalName == "" {
+		return fmt.Errorf("%w: legal name is required", ErrInvalidOrganization)
+	}
+	for _, field := range []string{organization.LegalName, address.Line1, address.Line2, address.City, address.Region} {
+		if len(field) > maxOrganizationField {
+			return fmt.Errorf("%w: names and address lines must be at most %d characters long", ErrInvalidOrganization, maxOrganizationField)
+		}
+	}
+	if len(address.PostalCode) > maxPostalCodeLength {
+		return fmt.Errorf("%w: postal code must be at most %d characters long", ErrInvalidOrganization, maxPostalCodeLength)
+	}
+	if address.Line1 == "" || address.City == "" {
+		return fmt.Errorf("%w: billing address requires a line and a city", ErrInvalidOrganization)
+	}
+	region, err := language.ParseRegion(address.Country)
+	if err != nil || len(address.Country) != 2 || !region.IsCountry() {
+		return fmt.Errorf("%w: country %q is not an ISO 3166-1 alpha-2 code", ErrInvalidOrganization, address.Country)
+	}
+	address.Country = region.String()
+	return nil
+}
+
+func isOrganizationRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleAdmin, RoleBuyer, RoleViewer:
+		return true
+	default:
+		return false
+	}
+}
+
+func generateInvitationToken() (string, error) {
+	token := make([]byte, invitationTokenLength)
+	if _, err := rand.Read(token); err != nil {
+		return "", fmt.Errorf("failed to generate invitation token: %w", err)
+	}
+	return hex.EncodeToString(token), nil
+}
+
+func hashInvitationToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,186 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+)
+
+// Categories of notifications, the customer chooses the channels of each.
+const (
+	NotificationCategoryAccount    = "account"
+	NotificationCategoryOrders     = "orders"
+	NotificationCategoryPromotions = "promotions"
+)
+
+const (
+	defaultLocale   = "en"
+	defaultTimezone = "UTC"
+	defaultCurrency = "USD"
+)
+
+var ErrInvalidPreferences = errors.New("invalid preferences")
+
+type Preferences struct {
+	// Locale is a canonical BCP 47 tag, e.g. "de-CH".
+	Locale string
+	// Timezone is an IANA time zone name, e.g. "Europe/Zurich".
+	Timezone string
+	// Currency is an ISO 4217 code, e.g. "CHF".
+	Currency string
+	// Notifications maps a category to the channels its notifications are sent to, none disables it.
+	// Promotions are sent only on channels with a granted marketing consent.
+	Notifications map[string][]string
+	UpdatedAt     time.Time
+}
+
+type PreferencesRepository interface {
+	// FindPreferences returns nil when the customer has not got preferences yet.
+	FindPreferences(ctx context.Context, id CustomerID) (*Preferences, error)
+	SavePreferences(ctx context.Context, id CustomerID, preferences Preferences) error
+}
+
+// DefaultPreferences derives the preferences of a new customer from an Accept-Language header:
+// the preferred language and the currency of its region. The header may be empty.
+func DefaultPreferences(acceptLanguage string) Preferences {
+	preferences := Preferences{
+		Locale:   defaultLocale,
+		Timezone: defaultTimezone,
+		Currency: defaultCurrency,
+		Notifications: map[string][]string{
+			NotificationCategoryAccount:    {ConsentChannelEmail},
+			NotificationCategoryOrders:     {ConsentChannelEmail},
+			NotificationCategoryPromotions: {},
+		},
+	}
+	tags, _, _ := language.ParseAcceptLanguage(acceptLanguage)
+	for _, tag := range tags {
+		// the wildcard is parsed as "mul", multiple languages
+		if base, _ := tag.Base(); tag == language.Und || base.String() == "mul" {
+			continue
+		}
+		preferences.Locale = tag.String()
+		if region, confidence := tag.Region(); confidence != language.No {
+			if unit, ok := currency.FromRegion(region); ok {
+				preferences.Currency = unit.String()
+			}
+		}
+		break
+	}
+	return preferences
+}
+
+// PreferencesService keeps the locale and notification settings of customers.
+type PreferencesService struct {
+	repo      PreferencesRepository
+	customers Repository
+}
+
+func NewPreferencesService(repo PreferencesRepository, customers Repository) *PreferencesService {
+	return &PreferencesService{
+		repo:      repo,
+		customers: customers,
+	}
+}
+
+// Get returns the saved preferences, or the defaults when the customer has not got any.
+func (p *PreferencesService) Get(ctx context.Context, id uuid.UUID) (*Preferences, error) {
+	if _, err := findOwnedCustomer(ctx, p.customers, id); err != nil {
+		return nil, err
+	}
+	preferences, err := p.repo.FindPreferences(ctx, CustomerID(id))
+	if err != nil || preferences != nil {
+		return preferences, err
+	}
+	defaults := DefaultPreferences("")
+	return &defaults, nil
+}
+
+// Update validates and saves the preferences, returning them in canonical form.
+func (p *PreferencesService) Update(ctx context.Context, id uuid.UUID, preferences Preferences) (*Preferences, error) {
+	if err := canonicalizePreferences(&preferences); err != nil {
+		return nil, err
+	}
+	if _, err := findOwnedCustomer(ctx, p.customers, id); err != nil {
+		return nil, err
+	}
+	preferences.UpdatedAt = time.Now().UTC()
+	if err := p.repo.SavePreferences(ctx, CustomerID(id), preferences); err != nil {
+		return nil, err
+	}
+	return &preferences, nil
+}
+
+// InitializeDefaults saves the defaults of a newly registered customer, see DefaultPreferences.
+func (p *PreferencesService) InitializeDefaults(ctx context.Context, id CustomerID, acceptLanguage string) error {
+	preferences := DefaultPreferences(acceptLanguage)
+	preferences.UpdatedAt = time.Now().UTC()
+	return p.repo.SavePreferences(ctx, id, preferences)
+}
+
+func canonicalizePreferences(preferences *Preferences) error {
+	tag, err := language.Parse(preferences.Locale)
+	if err != nil || tag == language.Und {
+		return fmt.Errorf("%w: locale %q is not a BCP 47 language tag", ErrInvalidPreferences, preferences.Locale)
+	}
+	preferences.Locale = tag.String()
+
+	// Local is the zone of the server, it is not a zone a customer can be in
+	if _, err := time.LoadLocation(preferences.Timezone); err != nil || preferences.Timezone == "" || preferences.Timezone == "Local" {
+		return fmt.Errorf("%w: timezone %q is not an IANA time zone", ErrInvalidPreferences, preferences.Timezone)
+	}
+
+	unit, err := currency.ParseISO(preferences.Currency)
+	if err != nil {
+		return fmt.Errorf("%w: currency %q is not an ISO 4217 code", ErrInvalidPreferences, preferences.Currency)
+	}
+	preferences.Currency = unit.String()
+
+	notifications := make(map[string][]string, len(preferences.Notifications))
+	for category, channels := range preferences.Notifications {
+		if !isNotificationCategory(category) {
+			return fmt.Errorf("%w: unknown notification category %q", ErrInvalidPreferences, category)
+		}
+		seen := make(map[string]bool)
+		unique := make([]string, 0, len(channels))
+		for _, channel := range channels {
+			channel = strings.ToLower(channel)
+			if !isNotificationChannel(channel) {
+				return fmt.Errorf("%w: unknown notification channel %q", ErrInvalidPreferences, channel)
+			}
+			if !seen[channel] {
+				seen[channel] = true
+				unique = append(unique, channel)
+			}
+		}
+		sort.Strings(unique)
+		notifications[category] = unique
+	}
+	preferences.Notifications = notifications
+	return nil
+}
+
+func isNotificationCategory(category string) bool {
+	switch category {
+	case NotificationCategoryAccount, NotificationCategoryOrders, NotificationCategoryPromotions:
+		return true
+	default:
+		return false
+	}
+}
+
+func isNotificationChannel(channel string) bool {
+	switch channel {
+	case ConsentChannelEmail, ConsentChannelSMS, ConsentChannelPush:
+		return true
+	default:
+		return false
+	}
+}
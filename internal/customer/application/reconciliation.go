@@ -0,0 +1,194 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+const defaultReconciliationPageSize = 500
+
+type ReconciliationOptions struct {
+	// DryRun only reports mismatches, the repair options are ignored.
+	DryRun bool
+	// DeleteOrphanIdentities deletes identities without a customer.
+	DeleteOrphanIdentities bool
+	// FlagMissingIdentities marks customers without an identity, and unmarks those whose identity was found again.
+	FlagMissingIdentities bool
+	PageSize              int
+}
+
+type ReconciliationReport struct {
+	StartedAt                time.Time `json:"startedAt"`
+	FinishedAt               time.Time `json:"finishedAt"`
+	DryRun                   bool      `json:"dryRun"`
+	IdentitiesScanned        int       `json:"identitiesScanned"`
+	CustomersScanned         int       `json:"customersScanned"`
+	OrphanIdentities         []string  `json:"orphanIdentities"`
+	CustomersWithoutIdentity []string  `json:"customersWithoutIdentity"`
+	DeletedIdentities        int       `json:"deletedIdentities"`
+	FlaggedCustomers         int       `json:"flaggedCustomers"`
+	UnflaggedCustomers       int       `json:"unflaggedCustomers"`
+	Errors                   []string  `json:"errors,omitempty"`
+}
+
+type ReconciliationMetrics struct {
+	OrphanIdentities  metrics.Gauge   // identities without a customer found by the last run
+	MissingIdentities metrics.Gauge   // customers without an identity found by the last run
+	Repairs           metrics.Counter // labels: action, outcome
+	LastRun           metrics.Gauge   // unix time of the last completed run
+}
+
+// Reconciler finds customers and identities of the identity provider which lost their counterpart,
+// e.g. when a failed registration or close could not be compensated.
+// The identity IDs are held in memory, 16 bytes per identity plus the map overhead.
+type Reconciler struct {
+	repo             Repository
+	identityProvider IdentityProvider
+	identities       IdentityLister
+	metrics          *ReconciliationMetrics
+}
+
+func NewReconciler(repo Repository, identityProvider IdentityProvider, identities IdentityLister, metrics *ReconciliationMetrics) *Reconciler {
+	return &Reconciler{
+		repo:             repo,
+		identityProvider: identityProvider,
+		identities:       identities,
+		metrics:          metrics,
+	}
+}
+
+// Run compares both sides and optionally repairs them. Failed repairs are recorded in the report,
+// an error is returned only when a side could not be read.
+func (r *Reconciler) Run(ctx context.Context, options ReconciliationOptions) (*ReconciliationReport, error) {
+	if options.PageSize <= 0 {
+		options.PageSize = defaultReconciliationPageSize
+	}
+	report := &ReconciliationReport{
+		StartedAt:                time.Now().UTC(),
+		DryRun:                   options.DryRun,
+		OrphanIdentities:         []string{},
+		CustomersWithoutIdentity: []string{},
+	}
+
+	// a registration in flight may be seen on one side only: its identity as an orphan when the customer
+	// was created after the customers were read, or its customer without identity when the identity was
+	// created after the identities were read; both are checked again before they are reported
+	identities := make(map[uuid.UUID]bool)
+	for cursor := ""; ; {
+		page, next, err := r.identities.ListIdentities(ctx, cursor, options.PageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list identities: %w", err)
+		}
+		for _, id := range page {
+			identities[id] = false
+		}
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+	report.IdentitiesScanned = len(identities)
+
+	var after CustomerID
+	for {
+		customers, err := r.repo.List(ctx, after, options.PageSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list customers: %w", err)
+		}
+		for _, customer := range customers {
+			id := uuid.UUID(customer.ID)
+			if _, ok := identities[id]; ok {
+				identities[id] = true
+				if customer.IdentityMissingAt != nil {
+					r.identityFound(ctx, customer.ID, options, report)
+				}
+			} else {
+				r.customerWithoutIdentity(ctx, customer.ID, options, report)
+			}
+		}
+		report.CustomersScanned += len(customers)
+		if len(customers) < options.PageSize {
+			break
+		}
+		after = customers[len(customers)-1].ID
+	}
+
+	for id, matched := range identities {
+		if !matched {
+			r.orphanIdentity(ctx, id, options, report)
+		}
+	}
+
+	report.FinishedAt = time.Now().UTC()
+	r.metrics.OrphanIdentities.Set(float64(len(report.OrphanIdentities)))
+	r.metrics.MissingIdentities.Set(float64(len(report.CustomersWithoutIdentity)))
+	r.metrics.LastRun.Set(float64(report.FinishedAt.Unix()))
+	return report, nil
+}
+
+func (r *Reconciler) customerWithoutIdentity(ctx context.Context, id CustomerID, options ReconciliationOptions, report *ReconciliationReport) {
+	// the identity may have been created after the identities were read
+	exists, err := r.identities.IdentityExists(ctx, uuid.UUID(id))
+	if err != nil {
+		r.repairFailed(report, "flag_customer", fmt.Errorf("failed to check identity %s: %w", id, err))
+		return
+	}
+	if exists {
+		return
+	}
+	report.CustomersWithoutIdentity = append(report.CustomersWithoutIdentity, id.String())
+	if options.DryRun || !options.FlagMissingIdentities {
+		return
+	}
+	if err := r.repo.FlagMissingIdentity(ctx, id); err != nil {
+		r.repairFailed(report, "flag_customer", fmt.Errorf("failed to flag customer %s: %w", id, err))
+		return
+	}
+	r.metrics.Repairs.With("action", "flag_customer", "outcome", outcomeSuccess).Add(1)
+	report.FlaggedCustomers++
+}
+
+// identityFound unflags a customer whose identity is back, e.g. after it was restored in the identity provider.
+func (r *Reconciler) identityFound(ctx context.Context, id CustomerID, options ReconciliationOptions, report *ReconciliationReport) {
+	if options.DryRun || !options.FlagMissingIdentities {
+		return
+	}
+	if err := r.repo.ClearMissingIdentity(ctx, id); err != nil {
+		r.repairFailed(report, "unflag_customer", fmt.Errorf("failed to unflag customer %s: %w", id, err))
+		return
+	}
+	r.metrics.Repairs.With("action", "unflag_customer", "outcome", outcomeSuccess).Add(1)
+	report.UnflaggedCustomers++
+}
+
+func (r *Reconciler) orphanIdentity(ctx context.Context, id uuid.UUID, options ReconciliationOptions, report *ReconciliationReport) {
+	// the customer may have been created after the customers were read
+	_, err := r.repo.FindByID(ctx, CustomerID(id))
+	if err == nil {
+		return
+	}
+	if !errors.Is(err, ErrCustomerNotFound) {
+		r.repairFailed(report, "delete_identity", fmt.Errorf("failed to check customer %s: %w", id, err))
+		return
+	}
+	report.OrphanIdentities = append(report.OrphanIdentities, id.String())
+	if options.DryRun || !options.DeleteOrphanIdentities {
+		return
+	}
+	if err := r.identityProvider.Delete(ctx, id); err != nil {
+		r.repairFailed(report, "delete_identity", fmt.Errorf("failed to delete identity %s: %w", id, err))
+		return
+	}
+	r.metrics.Repairs.With("action", "delete_identity", "outcome", outcomeSuccess).Add(1)
+	report.DeletedIdentities++
+}
+
+func (r *Reconciler) repairFailed(report *ReconciliationReport, action string, err error) {
+	r.metrics.Repairs.With("action", action, "outcome", outcomeFailure).Add(1)
+	report.Errors = append(report.Errors, err.Error())
+}
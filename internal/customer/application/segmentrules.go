@@ -0,0 +1,560 @@
+package application
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxSegmentRuleLength = 4096
+	// maxSegmentRuleDepth bounds the nesting of parentheses and negations.
+	maxSegmentRuleDepth = 32
+
+	segmentFieldTags            = "tags"
+	segmentAttributeFieldPrefix = "attributes."
+)
+
+// segmentProfileFields are the fields of the profile a rule compares, the timestamps are compared as times.
+var segmentProfileFields = map[string]func(c Customer) interface{}{
+	"first_name": func(c Customer) interface{} { return c.FirstName },
+	"last_name":  func(c Customer) interface{} { return c.LastName },
+	"email":      func(c Customer) interface{} { return c.Email },
+	"phone":      func(c Customer) interface{} { return c.Phone },
+	"status":     func(c Customer) interface{} { return c.Status },
+	"created_at": func(c Customer) interface{} { return c.CreatedAt },
+	"updated_at": func(c Customer) interface{} { return c.UpdatedAt },
+}
+
+// segmentRule is a parsed rule of a segment, see parseSegmentRule.
+type segmentRule interface {
+	matches(s segmentSubject) bool
+}
+
+// segmentSubject is a customer with its tags, which a rule is evaluated on.
+type segmentSubject struct {
+	customer Customer
+	tags     []string
+}
+
+// value returns the value of the field, false when the customer has no such attribute.
+func (s segmentSubject) value(field string) (interface{}, bool) {
+	if get, ok := segmentProfileFields[field]; ok {
+		return get(s.customer), true
+	}
+	value, ok := s.customer.Attributes[strings.TrimPrefix(field, segmentAttributeFieldPrefix)]
+	return value, ok
+}
+
+type allRule struct {
+	left, right segmentRule
+}
+
+func (r allRule) matches(s segmentSubject) bool {
+	return r.left.matches(s) && r.right.matches(s)
+}
+
+type anyRule struct {
+	left, right segmentRule
+}
+
+func (r anyRule) matches(s segmentSubject) bool {
+	return r.left.matches(s) || r.right.matches(s)
+}
+
+type notRule struct {
+	rule segmentRule
+}
+
+func (r notRule) matches(s segmentSubject) bool {
+	return !r.rule.matches(s)
+}
+
+type existsRule struct {
+	field string
+}
+
+func (r existsRule) matches(s segmentSubject) bool {
+	value, ok := s.value(r.field)
+	if !ok {
+		return false
+	}
+	if text, isText := value.(string); isText {
+		return text != ""
+	}
+	return true
+}
+
+// comparisonRule compares a field with literals, a comparison of a missing attribute or of values of
+// different types is false.
+type comparisonRule struct {
+	field  string
+	op     string
+	values []interface{}
+}
+
+func (r comparisonRule) matches(s segmentSubject) bool {
+	if r.field == segmentFieldTags {
+		for _, tag := range s.tags {
+			if tag == r.values[0] {
+				return true
+			}
+		}
+		return false
+	}
+	value, ok := s.value(r.field)
+	if !ok {
+		return false
+	}
+	switch r.op {
+	case "in":
+		for _, literal := range r.values {
+			if c, ok := compareSegmentValues(value, literal); ok && c == 0 {
+				return true
+			}
+		}
+		return false
+	case "contains", "starts_with", "ends_with":
+		text, ok := value.(string)
+		if !ok {
+			return false
+		}
+		text, literal := strings.ToLower(text), strings.ToLower(r.values[0].(string))
+		switch r.op {
+		case "contains":
+			return strings.Contains(text, literal)
+		case "starts_with":
+			return strings.HasPrefix(text, literal)
+		default:
+			return strings.HasSuffix(text, literal)
+		}
+	}
+	c, ok := compareSegmentValues(value, r.values[0])
+	if !ok {
+		return false
+	}
+	switch r.op {
+	case "==":
+		return c == 0
+	case "!=":
+		return c != 0
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	default:
+		return c >= 0
+	}
+}
+
+// compareSegmentValues orders values of the same type, false is before true.
+func compareSegmentValues(a, b interface{}) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		b, ok := b.(string)
+		return strings.Compare(a, b), ok
+	case float64:
+		b, ok := b.(float64)
+		switch {
+		case !ok:
+			return 0, false
+		case a < b:
+			return -1, true
+		case a > b:
+			return 1, true
+		}
+		return 0, true
+	case bool:
+		b, ok := b.(bool)
+		switch {
+		case !ok:
+			return 0, false
+		case a == b:
+			return 0, true
+		case b:
+			return -1, true
+		}
+		return 1, true
+	case time.Time:
+		b, ok := b.(time.Time)
+		switch {
+		case !ok:
+			return 0, false
+		case a.Before(b):
+			return -1, true
+		case a.After(b):
+			return 1, true
+		}
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+// parseSegmentRule parses a rule like
+//
+//	tags contains "vip" and (attributes.tier in ["gold", "platinum"] or created_at < "2020-01-01")
+//
+// Rules combine comparisons with and, or, not and parentheses. A comparison is a field, an operator and
+// a literal: a string in double quotes, a number, true or false. Fields are the profile fields first_name,
+// last_name, email, phone, status, created_at and updated_at, attributes.<name> and tags. The operators are
+// ==, !=, <, <=, >, >=, contains, starts_with and ends_with, which ignore the case, and in with a list
+// of literals; tags support contains only. exists <field> is true when the field has a value.
+// The timestamps are compared with dates like "2020-01-01" or RFC 3339 times.
+//
+// When definitions are given, the attributes must be defined and compared with literals of their type.
+func parseSegmentRule(text string, definitions map[string]AttributeDefinition) (segmentRule, error) {
+	if len(text) > maxSegmentRuleLength {
+		return nil, fmt.Errorf("%w: the rule is longer than %d characters", ErrInvalidSegment, maxSegmentRuleLength)
+	}
+	tokens, err := scanSegmentRule(text)
+	if err != nil {
+		return nil, err
+	}
+	p := &segmentRuleParser{tokens: tokens, definitions: definitions}
+	rule, err := p.parseAny()
+	if err != nil {
+		return nil, err
+	}
+	if token := p.peek(); token.kind != segmentTokenEnd {
+		return nil, p.errorf(token, "unexpected %q", token.text)
+	}
+	return rule, nil
+}
+
+type segmentTokenKind int
+
+const (
+	segmentTokenEnd segmentTokenKind = iota
+	segmentTokenWord
+	segmentTokenString
+	segmentTokenNumber
+	segmentTokenOperator
+	segmentTokenPunctuation
+)
+
+type segmentToken struct {
+	kind segmentTokenKind
+	text string
+	// value is the unquoted string or the number of a literal.
+	value interface{}
+	pos   int
+}
+
+func scanSegmentRule(text string) ([]segmentToken, error) {
+	var tokens []segmentToken
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		start := i
+		switch {
+		case unicode.IsSpace(r):
+			i++
+			continue
+		case unicode.IsLetter(r):
+			for i < len(runes) && (unicode.IsLetter(runes[i]) || unicode.IsDigit(runes[i]) || runes[i] == '_' || runes[i] == '.') {
+				i++
+			}
+			tokens = append(tokens, segmentToken{kind: segmentTokenWord, text: string(runes[start:i]), pos: start})
+		case unicode.IsDigit(r) || r == '-':
+			i++
+			for i < len(runes) && (unicode.IsDigit(runes[i]) || runes[i] == '.') {
+				i++
+			}
+			n, err := strconv.ParseFloat(string(runes[start:i]), 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: invalid number %q at %d", ErrInvalidSegment, string(runes[start:i]), start)
+			}
+			tokens = append(tokens, segmentToken{kind: segmentTokenNumber, text: string(runes[start:i]), value: n, pos: start})
+		case r == '"':
+			var value strings.Builder
+			for i++; ; i++ {
+				if i >= len(runes) {
+					return nil, fmt.Errorf("%w: unterminated string at %d", ErrInvalidSegment, start)
+				}
+				if runes[i] == '\\' && i+1 < len(runes) {
+					i++
+				} else if runes[i] == '"' {
+					break
+				}
+				value.WriteRune(runes[i])
+			}
+			i++
+			tokens = append(tokens, segmentToken{kind: segmentTokenString, text: string(runes[start:i]), value: value.String(), pos: start})
+		case strings.ContainsRune("=!<>", r):
+			i++
+			if i < len(runes) && runes[i] == '=' {
+				i++
+			}
+			operator := string(runes[start:i])
+			if operator == "=" || operator == "!" {
+				return nil, fmt.Errorf("%w: unknown operator %q at %d", ErrInvalidSegment, operator, start)
+			}
+			tokens = append(tokens, segmentToken{kind: segmentTokenOperator, text: operator, pos: start})
+		case strings.ContainsRune("()[],", r):
+			i++
+			tokens = append(tokens, segmentToken{kind: segmentTokenPunctuation, text: string(r), pos: start})
+		default:
+			return nil, fmt.Errorf("%w: unexpected %q at %d", ErrInvalidSegment, string(r), start)
+		}
+	}
+	return append(tokens, segmentToken{kind: segmentTokenEnd, text: "end of rule", pos: len(runes)}), nil
+}
+
+type segmentRuleParser struct {
+	tokens      []segmentToken
+	pos         int
+	depth       int
+	definitions map[string]AttributeDefinition
+}
+
+func (p *segmentRuleParser) peek() segmentToken {
+	return p.tokens[p.pos]
+}
+
+func (p *segmentRuleParser) next() segmentToken {
+	token := p.tokens[p.pos]
+	if token.kind != segmentTokenEnd {
+		p.pos++
+	}
+	return token
+}
+
+// keyword consumes the next token when it is the word.
+func (p *segmentRuleParser) keyword(word string) bool {
+	if token := p.peek(); token.kind == segmentTokenWord && token.text == word {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *segmentRuleParser) punctuation(text string) bool {
+	if token := p.peek(); token.kind == segmentTokenPunctuation && token.text == text {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *segmentRuleParser) errorf(token segmentToken, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s at %d", ErrInvalidSegment, fmt.Sprintf(format, args...), token.pos)
+}
+
+func (p *segmentRuleParser) parseAny() (segmentRule, error) {
+	rule, err := p.parseAll()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.parseAll()
+		if err != nil {
+			return nil, err
+		}
+		rule = anyRule{left: rule, right: right}
+	}
+	return rule, nil
+}
+
+func (p *segmentRuleParser) parseAll() (segmentRule, error) {
+	rule, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		rule = allRule{left: rule, right: right}
+	}
+	return rule, nil
+}
+
+func (p *segmentRuleParser) parseNot() (segmentRule, error) {
+	token := p.peek()
+	if !p.keyword("not") {
+		return p.parsePrimary()
+	}
+	if err := p.enter(token); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	rule, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	return notRule{rule: rule}, nil
+}
+
+func (p *segmentRuleParser) parsePrimary() (segmentRule, error) {
+	token := p.peek()
+	if p.punctuation("(") {
+		if err := p.enter(token); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		rule, err := p.parseAny()
+		if err != nil {
+			return nil, err
+		}
+		if !p.punctuation(")") {
+			return nil, p.errorf(p.peek(), "expected \")\"")
+		}
+		return rule, nil
+	}
+	if p.keyword("exists") {
+		field, _, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		if field == segmentFieldTags {
+			return nil, p.errorf(token, "tags support contains only")
+		}
+		return existsRule{field: field}, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *segmentRuleParser) enter(token segmentToken) error {
+	if p.depth++; p.depth > maxSegmentRuleDepth {
+		return p.errorf(token, "the rule is nested deeper than %d", maxSegmentRuleDepth)
+	}
+	return nil
+}
+
+func (p *segmentRuleParser) leave() {
+	p.depth--
+}
+
+// segmentValueKind is the type of the values of a field: "string", "number", "boolean", "time", or empty when unknown.
+type segmentValueKind string
+
+// parseField returns the field and the kind of its values.
+func (p *segmentRuleParser) parseField() (string, segmentValueKind, error) {
+	token := p.next()
+	if token.kind != segmentTokenWord {
+		return "", "", p.errorf(token, "expected a field, got %q", token.text)
+	}
+	field := token.text
+	switch {
+	case field == segmentFieldTags:
+		return field, "string", nil
+	case field == "created_at" || field == "updated_at":
+		return field, "time", nil
+	case segmentProfileFields[field] != nil:
+		return field, "string", nil
+	case strings.HasPrefix(field, segmentAttributeFieldPrefix):
+		name := strings.TrimPrefix(field, segmentAttributeFieldPrefix)
+		if !attributeNamePattern.MatchString(name) {
+			return "", "", p.errorf(token, "invalid attribute name %q", name)
+		}
+		if p.definitions == nil {
+			return field, "", nil
+		}
+		definition, ok := p.definitions[name]
+		if !ok {
+			return "", "", p.errorf(token, "attribute %q is not defined", name)
+		}
+		switch definition.Type {
+		case AttributeTypeInteger, AttributeTypeNumber:
+			return field, "number", nil
+		case AttributeTypeBoolean:
+			return field, "boolean", nil
+		default:
+			return field, "string", nil
+		}
+	default:
+		return "", "", p.errorf(token, "unknown field %q", field)
+	}
+}
+
+func (p *segmentRuleParser) parseComparison() (segmentRule, error) {
+	field, kind, err := p.parseField()
+	if err != nil {
+		return nil, err
+	}
+	token := p.next()
+	op := token.text
+	switch {
+	case token.kind == segmentTokenOperator:
+	case token.kind == segmentTokenWord && (op == "in" || op == "contains" || op == "starts_with" || op == "ends_with"):
+	default:
+		return nil, p.errorf(token, "expected an operator after %s, got %q", field, op)
+	}
+	switch {
+	case field == segmentFieldTags && op != "contains":
+		return nil, p.errorf(token, "tags support contains only")
+	case (op == "contains" || op == "starts_with" || op == "ends_with") && kind != "string" && kind != "":
+		return nil, p.errorf(token, "%s applies to strings only", op)
+	case op != "==" && op != "!=" && op != "in" && kind == "boolean":
+		return nil, p.errorf(token, "booleans support ==, != and in only")
+	}
+	if op == "contains" || op == "starts_with" || op == "ends_with" {
+		kind = "string"
+	}
+	rule := comparisonRule{field: field, op: op}
+	if op != "in" {
+		value, err := p.parseLiteral(kind)
+		if err != nil {
+			return nil, err
+		}
+		if field == segmentFieldTags {
+			value = strings.ToLower(value.(string))
+		}
+		rule.values = []interface{}{value}
+		return rule, nil
+	}
+	if !p.punctuation("[") {
+		return nil, p.errorf(p.peek(), "expected \"[\" after in")
+	}
+	for {
+		value, err := p.parseLiteral(kind)
+		if err != nil {
+			return nil, err
+		}
+		rule.values = append(rule.values, value)
+		if p.punctuation("]") {
+			return rule, nil
+		}
+		if !p.punctuation(",") {
+			return nil, p.errorf(p.peek(), "expected \",\" or \"]\"")
+		}
+	}
+}
+
+// parseLiteral parses a literal of the kind, any when the kind is unknown. Times are given as strings.
+func (p *segmentRuleParser) parseLiteral(kind segmentValueKind) (interface{}, error) {
+	token := p.next()
+	var (
+		value       interface{}
+		literalKind segmentValueKind
+	)
+	switch {
+	case token.kind == segmentTokenString:
+		value, literalKind = token.value, "string"
+	case token.kind == segmentTokenNumber:
+		value, literalKind = token.value, "number"
+	case token.kind == segmentTokenWord && (token.text == "true" || token.text == "false"):
+		value, literalKind = token.text == "true", "boolean"
+	default:
+		return nil, p.errorf(token, "expected a literal, got %q", token.text)
+	}
+	if kind == "time" && literalKind == "string" {
+		if t, err := time.Parse(attributeDateLayout, value.(string)); err == nil {
+			return t, nil
+		}
+		if t, err := time.Parse(time.RFC3339, value.(string)); err == nil {
+			return t, nil
+		}
+		return nil, p.errorf(token, "expected a date like \"2020-01-01\" or an RFC 3339 time, got %s", token.text)
+	}
+	if kind != "" && kind != literalKind {
+		return nil, p.errorf(token, "expected a %s, got %s", kind, token.text)
+	}
+	return value, nil
+}
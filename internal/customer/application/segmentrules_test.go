@@ -0,0 +1,130 @@
+package application
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testSegmentDefinitions = map[string]AttributeDefinition{
+	"tier":     {Name: "tier", Type: AttributeTypeEnum},
+	"orders":   {Name: "orders", Type: AttributeTypeInteger},
+	"verified": {Name: "verified", Type: AttributeTypeBoolean},
+}
+
+func testSegmentSubject() segmentSubject {
+	return segmentSubject{
+		customer: Customer{
+			FirstName: "Ada",
+			Email:     "Ada.Lovelace@Example.com",
+			Status:    StatusActive,
+			CreatedAt: time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC),
+			Attributes: map[string]interface{}{
+				"tier":     "gold",
+				"orders":   float64(12),
+				"verified": true,
+			},
+		},
+		tags: []string{"vip"},
+	}
+}
+
+func TestSegmentRuleMatches(t *testing.T) {
+	tests := []struct {
+		rule    string
+		matches bool
+	}{
+		// and binds tighter than or, not tighter than and
+		{`first_name == "Ada" or status == "blocked" and tags contains "none"`, true},
+		{`(first_name == "Ada" or status == "blocked") and tags contains "none"`, false},
+		{`not tags contains "none" and tags contains "vip"`, true},
+		{`not (tags contains "vip" and tags contains "none")`, true},
+		{`not not tags contains "vip"`, true},
+		// in compares with every literal, contains ignores the case
+		{`attributes.tier in ["silver", "gold"]`, true},
+		{`attributes.tier in ["silver", "platinum"]`, false},
+		{`attributes.orders in [1, 12]`, true},
+		{`email contains "lovelace@example"`, true},
+		{`email starts_with "ADA."`, true},
+		{`email ends_with ".org"`, false},
+		{`tags contains "VIP"`, true},
+		// comparisons of missing attributes or of values of different types are false
+		{`attributes.missing == "x"`, false},
+		{`attributes.tier == 1`, false},
+		{`exists attributes.tier and not exists attributes.missing`, true},
+		{`attributes.orders >= 12 and attributes.orders < 13`, true},
+		{`attributes.verified == true`, true},
+		{`created_at < "2020-01-01" and created_at >= "2019-06-01T00:00:00Z"`, true},
+	}
+	for _, test := range tests {
+		rule, err := parseSegmentRule(test.rule, nil)
+		if err != nil {
+			t.Errorf("parseSegmentRule(%s) failed: %v", test.rule, err)
+			continue
+		}
+		if matches := rule.matches(testSegmentSubject()); matches != test.matches {
+			t.Errorf("%s matches = %v, want %v", test.rule, matches, test.matches)
+		}
+	}
+}
+
+func TestSegmentRuleErrors(t *testing.T) {
+	tests := []struct {
+		rule  string
+		error string
+	}{
+		// types of the defined attributes
+		{`attributes.orders == "12"`, "expected a number"},
+		{`attributes.tier == 1`, "expected a string"},
+		{`attributes.orders contains "1"`, "contains applies to strings only"},
+		{`attributes.verified < true`, "booleans support ==, != and in only"},
+		{`attributes.orders in [1, "2"]`, "expected a number"},
+		{`created_at < "yesterday"`, "expected a date"},
+		{`attributes.unknown == 1`, "is not defined"},
+		// syntax
+		{`tags == "vip"`, "tags support contains only"},
+		{`exists tags`, "tags support contains only"},
+		{`attributes.tier in "gold"`, `expected "[" after in`},
+		{`attributes.tier in ["gold" "silver"]`, `expected "," or "]"`},
+		{`(first_name == "Ada"`, `expected ")"`},
+		{`first_name = "Ada"`, "unknown operator"},
+		{`first_name == "Ada" first_name`, "unexpected"},
+		{`nickname == "Ada"`, "unknown field"},
+		{`first_name == "Ada`, "unterminated string"},
+	}
+	for _, test := range tests {
+		_, err := parseSegmentRule(test.rule, testSegmentDefinitions)
+		if !errors.Is(err, ErrInvalidSegment) || !strings.Contains(err.Error(), test.error) {
+			t.Errorf("parseSegmentRule(%s) = %v, want an error with %q", test.rule, err, test.error)
+		}
+	}
+}
+
+func TestSegmentRuleDepth(t *testing.T) {
+	nested := func(depth int, open, close string) string {
+		return strings.Repeat(open, depth) + `tags contains "vip"` + strings.Repeat(close, depth)
+	}
+	for _, test := range []struct {
+		name        string
+		open, close string
+	}{
+		{"parentheses", "(", ")"},
+		{"negations", "not ", ""},
+		{"both", "not (", ")"},
+	} {
+		depth := maxSegmentRuleDepth
+		if test.name == "both" {
+			depth = maxSegmentRuleDepth / 2
+		}
+		if _, err := parseSegmentRule(nested(depth, test.open, test.close), nil); err != nil {
+			t.Errorf("%s nested %d deep failed: %v", test.name, depth, err)
+		}
+		if _, err := parseSegmentRule(nested(depth+1, test.open, test.close), nil); err == nil || !strings.Contains(err.Error(), "nested deeper") {
+			t.Errorf("%s nested %d deep = %v, want an error", test.name, depth+1, err)
+		}
+	}
+	if _, err := parseSegmentRule(strings.Repeat(" ", maxSegmentRuleLength)+"x", nil); !errors.Is(err, ErrInvalidSegment) {
+		t.Errorf("rule longer than %d = %v, want ErrInvalidSegment", maxSegmentRuleLength, err)
+	}
+}
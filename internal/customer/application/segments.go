@@ -0,0 +1,286 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	defaultSegmentMembersLimit = 100
+	maxSegmentMembersLimit     = 1000
+)
+
+var (
+	ErrInvalidSegment  = errors.New("invalid segment")
+	ErrSegmentNotFound = errors.New("segment not found")
+)
+
+var segmentNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// Segment is a group of customers matching a rule, see parseSegmentRule for its syntax.
+type Segment struct {
+	Name        string
+	Description string
+	Rule        string
+	// Members is the number of customers in the segment.
+	Members int
+	// RebuildRequestedAt is set while the members are rebuilt after a change of the rule.
+	RebuildRequestedAt *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+type SegmentMembership struct {
+	Segment    string
+	CustomerID CustomerID
+	JoinedAt   time.Time
+}
+
+type SegmentRepository interface {
+	// Segments returns the segments ordered by name.
+	Segments(ctx context.Context) ([]Segment, error)
+	// Rules returns the rule of every segment by its name, it does not count the members.
+	Rules(ctx context.Context) (map[string]string, error)
+	// FindSegment returns ErrSegmentNotFound when there is no segment of the name.
+	FindSegment(ctx context.Context, name string) (*Segment, error)
+	// SaveSegment adds or replaces the segment, its members are kept. A new segment and a change of the rule
+	// request a rebuild at the update time of the segment.
+	SaveSegment(ctx context.Context, segment Segment) error
+	// RequestedRebuilds returns the segments whose members are to be rebuilt.
+	RequestedRebuilds(ctx context.Context) ([]Segment, error)
+	// LockRebuilds runs rebuild holding a lock shared by all instances, so that only one of them rebuilds at a time.
+	// It returns false without running rebuild when another instance holds the lock.
+	LockRebuilds(ctx context.Context, rebuild func() error) (bool, error)
+	// FinishRebuild clears the rebuild requested at the time, a later request is kept.
+	FinishRebuild(ctx context.Context, name string, requestedAt time.Time) error
+	// DeleteSegment removes the segment with its members, or returns ErrSegmentNotFound.
+	DeleteSegment(ctx context.Context, name string) error
+	// SetMembership adds the customer to the segment or removes it, a member keeps the time it joined.
+	SetMembership(ctx context.Context, segment string, id CustomerID, member bool, at time.Time) error
+	// Members returns up to limit members of the segment ordered by ID, after the given one.
+	Members(ctx context.Context, segment string, after CustomerID, limit int) ([]SegmentMembership, error)
+	// SegmentsOf returns the memberships of the customer ordered by segment.
+	SegmentsOf(ctx context.Context, id CustomerID) ([]SegmentMembership, error)
+}
+
+// Segments keeps the members of the segments up to date: a customer is evaluated on every change
+// of its profile, attributes, status or tags, all customers when the rule of a segment changes.
+type Segments struct {
+	repo       SegmentRepository
+	customers  Repository
+	tags       TagRepository
+	attributes AttributeRegistry
+
+	mu sync.Mutex
+	// parsed holds the parsed rules of the segments by their text, so that a change of a customer does not parse them again.
+	parsed map[string]segmentRule
+}
+
+func NewSegments(repo SegmentRepository, customers Repository, tags TagRepository, attributes AttributeRegistry) *Segments {
+	return &Segments{
+		repo:       repo,
+		customers:  customers,
+		tags:       tags,
+		attributes: attributes,
+	}
+}
+
+func (s *Segments) Segments(ctx context.Context) ([]Segment, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	return s.repo.Segments(ctx)
+}
+
+func (s *Segments) Segment(ctx context.Context, name string) (*Segment, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	return s.repo.FindSegment(ctx, name)
+}
+
+// Define adds the segment or changes it. The members of a new rule are rebuilt in the background by RebuildRequested,
+// until then the segment reports the time of the request.
+func (s *Segments) Define(ctx context.Context, segment Segment) (*Segment, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if !segmentNamePattern.MatchString(segment.Name) {
+		return nil, fmt.Errorf("%w: name %q must be lowercase letters, digits, underscores and hyphens, at most 64", ErrInvalidSegment, segment.Name)
+	}
+	definitions, err := s.attributes.Definitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := parseSegmentRule(segment.Rule, attributeDefinitionsByName(definitions)); err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	segment.CreatedAt, segment.UpdatedAt = now, now
+	saved, err := s.repo.FindSegment(ctx, segment.Name)
+	switch {
+	case errors.Is(err, ErrSegmentNotFound):
+	case err != nil:
+		return nil, err
+	default:
+		segment.CreatedAt = saved.CreatedAt
+	}
+	if err := s.repo.SaveSegment(ctx, segment); err != nil {
+		return nil, err
+	}
+	return s.repo.FindSegment(ctx, segment.Name)
+}
+
+func (s *Segments) Delete(ctx context.Context, name string) error {
+	if !IsAdmin(ctx) {
+		return ErrNotAuthorized
+	}
+	return s.repo.DeleteSegment(ctx, name)
+}
+
+// Members lists the members of the segment ordered by ID, after is the last ID of the previous page.
+func (s *Segments) Members(ctx context.Context, name string, after CustomerID, limit int) ([]SegmentMembership, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if _, err := s.repo.FindSegment(ctx, name); err != nil {
+		return nil, err
+	}
+	if limit <= 0 {
+		limit = defaultSegmentMembersLimit
+	}
+	if limit > maxSegmentMembersLimit {
+		limit = maxSegmentMembersLimit
+	}
+	return s.repo.Members(ctx, name, after, limit)
+}
+
+func (s *Segments) SegmentsOf(ctx context.Context, id CustomerID) ([]SegmentMembership, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if _, err := s.customers.FindByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return s.repo.SegmentsOf(ctx, id)
+}
+
+// Evaluate updates the memberships of the customer after a change. A deleted customer has left its segments already.
+func (s *Segments) Evaluate(ctx context.Context, id CustomerID) error {
+	rules, err := s.rules(ctx)
+	if err != nil || len(rules) == 0 {
+		return err
+	}
+	customer, err := s.customers.FindByID(ctx, id)
+	if errors.Is(err, ErrCustomerNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return s.evaluate(ctx, *customer, rules)
+}
+
+// Rebuild evaluates every customer against all segments, e.g. after the events of changes were lost.
+// It returns the number of customers evaluated.
+func (s *Segments) Rebuild(ctx context.Context) (int, error) {
+	if !IsAdmin(ctx) {
+		return 0, ErrNotAuthorized
+	}
+	rules, err := s.rules(ctx)
+	if err != nil || len(rules) == 0 {
+		return 0, err
+	}
+	return s.rebuild(ctx, rules)
+}
+
+// RebuildRequested rebuilds the members of the segments whose rule changed and returns the number of segments rebuilt.
+// Nothing is rebuilt while another instance is rebuilding.
+func (s *Segments) RebuildRequested(ctx context.Context) (int, error) {
+	rebuilt := 0
+	_, err := s.repo.LockRebuilds(ctx, func() error {
+		segments, err := s.repo.RequestedRebuilds(ctx)
+		if err != nil {
+			return err
+		}
+		for _, segment := range segments {
+			rule, err := parseSegmentRule(segment.Rule, nil)
+			if err != nil {
+				return fmt.Errorf("segment %q: %w", segment.Name, err)
+			}
+			if _, err := s.rebuild(ctx, map[string]segmentRule{segment.Name: rule}); err != nil {
+				return err
+			}
+			if err := s.repo.FinishRebuild(ctx, segment.Name, *segment.RebuildRequestedAt); err != nil {
+				return err
+			}
+			rebuilt++
+		}
+		return nil
+	})
+	return rebuilt, err
+}
+
+// rebuild reads every customer again before it writes the memberships, so that a customer changed since the
+// stream started is not evaluated on its old state after the evaluation of the change. The customers must
+// therefore be read from the store, not from a cache.
+func (s *Segments) rebuild(ctx context.Context, rules map[string]segmentRule) (int, error) {
+	evaluated := 0
+	err := s.customers.Stream(ctx, CustomerFilter{}, func(streamed Customer) error {
+		customer, err := s.customers.FindByID(ctx, streamed.ID)
+		if errors.Is(err, ErrCustomerNotFound) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		evaluated++
+		return s.evaluate(ctx, *customer, rules)
+	})
+	return evaluated, err
+}
+
+// rules returns the parsed rules of all segments. An attribute a rule refers to may have been deleted
+// since, so the attributes are not checked against their definitions.
+func (s *Segments) rules(ctx context.Context) (map[string]segmentRule, error) {
+	texts, err := s.repo.Rules(ctx)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// the rules of deleted or changed segments are dropped
+	parsed := make(map[string]segmentRule, len(texts))
+	rules := make(map[string]segmentRule, len(texts))
+	for name, text := range texts {
+		rule, ok := s.parsed[text]
+		if !ok {
+			if rule, err = parseSegmentRule(text, nil); err != nil {
+				return nil, fmt.Errorf("segment %q: %w", name, err)
+			}
+		}
+		parsed[text] = rule
+		rules[name] = rule
+	}
+	s.parsed = parsed
+	return rules, nil
+}
+
+func (s *Segments) evaluate(ctx context.Context, customer Customer, rules map[string]segmentRule) error {
+	tags, err := s.tags.TagsOf(ctx, customer.ID)
+	if err != nil {
+		return err
+	}
+	subject := segmentSubject{customer: customer, tags: tags}
+	now := time.Now().UTC()
+	for name, rule := range rules {
+		if err := s.repo.SetMembership(ctx, name, customer.ID, rule.matches(subject), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,50 +3,132 @@ package application
 import (
 	"context"
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/jnikolaeva/eshop-common/uuid"
 )
 
 var (
 	ErrCustomerNotFound = errors.New("user not found")
-	// TODO: email is not really unique value
-	ErrDuplicateUser = errors.New("user with such email already exists")
+	// ErrDuplicateUser is returned for an ID that exists already. Emails are not unique, customers who registered
+	// twice are found by Duplicates.
+	ErrDuplicateUser               = errors.New("user with such id already exists")
+	ErrUsernameTaken               = errors.New("username is already taken")
+	ErrWeakPassword                = errors.New("password does not satisfy the password policy")
+	ErrIdentityProviderUnavailable = errors.New("identity provider is unavailable")
 )
 
+const (
+	RegistrationStepIdentity = "identity"
+	RegistrationStepProfile  = "profile"
+)
+
+// compensationTimeout bounds the deletion of the identity of a failed registration, which outlives the request.
+const compensationTimeout = 10 * time.Second
+
+// RegistrationError reports the step at which the registration failed.
+// A failed profile creation is compensated by deleting the identity.
+type RegistrationError struct {
+	Step            string
+	Err             error
+	CompensationErr error
+}
+
+func (e *RegistrationError) Error() string {
+	if e.CompensationErr != nil {
+		return e.CompensationErr.Error() + ": " + e.Err.Error()
+	}
+	return e.Err.Error()
+}
+
+func (e *RegistrationError) Unwrap() error {
+	return e.Err
+}
+
 type Service interface {
+	Register(ctx context.Context, username, password, firstName, lastName, email, phone string) (CustomerID, error)
 	Create(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (CustomerID, error)
 	FindByID(ctx context.Context, id uuid.UUID) (*Customer, error)
 	Update(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (*Customer, error)
+	FindByEmail(ctx context.Context, email string) ([]Customer, error)
+	// Close deletes the customer profile and the identity.
+	Close(ctx context.Context, id uuid.UUID) error
+	// ChangeStatus moves the customer to another status of the account lifecycle, see CanTransition.
+	ChangeStatus(ctx context.Context, id uuid.UUID, status, reason, note string) (*Customer, error)
+	StatusHistory(ctx context.Context, id uuid.UUID) ([]StatusChange, error)
+	// Merge combines the duplicate account of a customer into the surviving one. The ID of the duplicate keeps
+	// pointing to the survivor, see MergedError; its identity is deleted by the handler of the CustomersMerged event.
+	Merge(ctx context.Context, survivorID, mergedID uuid.UUID) (*Customer, error)
 }
 
-func NewService(repo Repository) Service {
+func NewService(repo Repository, identityProvider IdentityProvider, events EventHandler) Service {
 	return &service{
-		repo: repo,
+		repo:             repo,
+		identityProvider: identityProvider,
+		events:           events,
 	}
 }
 
 type service struct {
-	repo Repository
+	repo             Repository
+	identityProvider IdentityProvider
+	events           EventHandler
+}
+
+func (s service) Register(ctx context.Context, username, password, firstName, lastName, email, phone string) (CustomerID, error) {
+	id, err := s.identityProvider.Register(ctx, username, password)
+	if err != nil {
+		return CustomerID{}, &RegistrationError{Step: RegistrationStepIdentity, Err: err}
+	}
+
+	customerID, err := s.Create(ctx, id, firstName, lastName, email, phone)
+	if err != nil {
+		// the identity is deleted even when the client is gone, it would be left without a profile otherwise
+		compensationCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), compensationTimeout)
+		defer cancel()
+		return customerID, &RegistrationError{
+			Step:            RegistrationStepProfile,
+			Err:             err,
+			CompensationErr: s.identityProvider.Delete(compensationCtx, id),
+		}
+	}
+
+	return customerID, nil
 }
 
 func (s service) Create(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (CustomerID, error) {
+	now := time.Now().UTC()
 	user := Customer{
 		ID:        CustomerID(id),
 		FirstName: firstName,
 		LastName:  lastName,
 		Email:     email,
 		Phone:     phone,
+		Status:    StatusActive,
+		CreatedAt: now,
+		UpdatedAt: now,
 	}
 
-	if err := s.repo.Add(user); err != nil {
+	if err := s.repo.Add(ctx, user); err != nil {
 		return user.ID, err
 	}
+	s.events.Handle(ctx, NewCustomerRegistered(user))
 
 	return user.ID, nil
 }
 
 func (s service) FindByID(ctx context.Context, id uuid.UUID) (*Customer, error) {
-	user, err := s.repo.FindByID(CustomerID(id))
+	user, err := s.repo.FindByID(ctx, CustomerID(id))
+	if errors.Is(err, ErrCustomerNotFound) {
+		survivorID, aliasErr := s.repo.MergedInto(ctx, CustomerID(id))
+		if aliasErr != nil {
+			return nil, aliasErr
+		}
+		if survivorID != nil {
+			return nil, &MergedError{SurvivorID: *survivorID}
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -54,7 +136,7 @@ func (s service) FindByID(ctx context.Context, id uuid.UUID) (*Customer, error)
 }
 
 func (s service) Update(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (*Customer, error) {
-	user, err := s.repo.FindByID(CustomerID(id))
+	user, err := s.repo.FindByID(ctx, CustomerID(id))
 	if err != nil {
 		return nil, err
 	}
@@ -63,6 +145,80 @@ func (s service) Update(ctx context.Context, id uuid.UUID, firstName, lastName,
 	user.LastName = lastName
 	user.Email = email
 	user.Phone = phone
+	user.UpdatedAt = time.Now().UTC()
 
-	return user, s.repo.Update(*user)
+	if err := s.repo.Update(ctx, *user); err != nil {
+		return nil, err
+	}
+	s.events.Handle(ctx, NewCustomerUpdated(*user))
+
+	return user, nil
+}
+
+func (s service) FindByEmail(ctx context.Context, email string) ([]Customer, error) {
+	return s.repo.FindByEmail(ctx, email)
+}
+
+// Close moves the account to the final status closed at the request of the customer, the profile is kept.
+func (s service) Close(ctx context.Context, id uuid.UUID) error {
+	if _, err := s.ChangeStatus(ctx, id, StatusClosed, StatusReasonCustomerRequest, ""); err != nil {
+		return err
+	}
+	// an identity left behind is found by the reconciliation with the identity provider
+	return s.identityProvider.Delete(ctx, id)
+}
+
+func (s service) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason, note string) (*Customer, error) {
+	if err := validateStatusChange(status, reason, note); err != nil {
+		return nil, err
+	}
+	customer, err := s.repo.FindByID(ctx, CustomerID(id))
+	if err != nil {
+		return nil, err
+	}
+	if !CanTransition(customer.Status, status) {
+		return nil, fmt.Errorf("%w: from %s to %s", ErrStatusTransitionNotAllowed, customer.Status, status)
+	}
+
+	change := StatusChange{
+		CustomerID: customer.ID,
+		From:       customer.Status,
+		To:         status,
+		Reason:     reason,
+		Note:       note,
+		Actor:      statusActor(ctx),
+		ChangedAt:  time.Now().UTC(),
+	}
+	customer.Status = status
+	customer.UpdatedAt = change.ChangedAt
+	if err := s.repo.UpdateStatus(ctx, *customer, change); err != nil {
+		return nil, err
+	}
+	s.events.Handle(ctx, NewCustomerStatusChanged(*customer, change))
+	return customer, nil
+}
+
+func (s service) StatusHistory(ctx context.Context, id uuid.UUID) ([]StatusChange, error) {
+	if _, err := s.repo.FindByID(ctx, CustomerID(id)); err != nil {
+		return nil, err
+	}
+	return s.repo.StatusHistory(ctx, CustomerID(id))
+}
+
+func (s service) Merge(ctx context.Context, survivorID, mergedID uuid.UUID) (*Customer, error) {
+	if survivorID == mergedID {
+		return nil, fmt.Errorf("%w: a customer cannot be merged into itself", ErrInvalidMerge)
+	}
+	merge := Merge{
+		SurvivorID: CustomerID(survivorID),
+		MergedID:   CustomerID(mergedID),
+		Actor:      statusActor(ctx),
+		MergedAt:   time.Now().UTC(),
+	}
+	survivor, err := s.repo.Merge(ctx, merge)
+	if err != nil {
+		return nil, err
+	}
+	s.events.Handle(ctx, NewCustomersMerged(*survivor, merge))
+	return survivor, nil
 }
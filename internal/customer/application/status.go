@@ -0,0 +1,97 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Statuses of a customer account. Only active accounts may act on their own behalf.
+const (
+	StatusPendingVerification = "pending_verification"
+	StatusActive              = "active"
+	StatusSuspended           = "suspended"
+	StatusBlocked             = "blocked"
+	StatusClosed              = "closed"
+)
+
+// Reasons of a status change.
+const (
+	StatusReasonVerified        = "verified"
+	StatusReasonFraudSuspected  = "fraud_suspected"
+	StatusReasonChargebackAbuse = "chargeback_abuse"
+	StatusReasonPolicyViolation = "policy_violation"
+	StatusReasonCustomerRequest = "customer_request"
+	StatusReasonResolved        = "resolved"
+	StatusReasonOther           = "other"
+)
+
+// systemActor is recorded for the changes made without an authenticated subject, e.g. by the CLI.
+const systemActor = "system"
+
+const maxStatusNoteLength = 1024
+
+var (
+	// ErrAccountNotActive refuses the operations of a customer whose account is not active.
+	ErrAccountNotActive           = errors.New("customer account is not active")
+	ErrInvalidStatusChange        = errors.New("invalid status change")
+	ErrStatusTransitionNotAllowed = errors.New("status transition is not allowed")
+)
+
+// statusTransitions lists the statuses reachable from every status, closed is final.
+var statusTransitions = map[string][]string{
+	StatusPendingVerification: {StatusActive, StatusBlocked, StatusClosed},
+	StatusActive:              {StatusSuspended, StatusBlocked, StatusClosed},
+	StatusSuspended:           {StatusActive, StatusBlocked, StatusClosed},
+	StatusBlocked:             {StatusActive, StatusClosed},
+	StatusClosed:              {},
+}
+
+// StatusChange is a record of the status history of a customer.
+type StatusChange struct {
+	CustomerID CustomerID
+	From       string
+	To         string
+	Reason     string
+	Note       string
+	// Actor is the ID of the operator who made the change, or "system".
+	Actor     string
+	ChangedAt time.Time
+}
+
+// CanTransition reports whether a customer may move from one status to another.
+func CanTransition(from, to string) bool {
+	for _, status := range statusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+func validateStatusChange(to, reason, note string) error {
+	if _, ok := statusTransitions[to]; !ok {
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidStatusChange, to)
+	}
+	switch reason {
+	case StatusReasonVerified, StatusReasonFraudSuspected, StatusReasonChargebackAbuse, StatusReasonPolicyViolation,
+		StatusReasonCustomerRequest, StatusReasonResolved, StatusReasonOther:
+	default:
+		return fmt.Errorf("%w: unknown reason %q", ErrInvalidStatusChange, reason)
+	}
+	if reason == StatusReasonOther && note == "" {
+		return fmt.Errorf("%w: a note is required for the reason %q", ErrInvalidStatusChange, reason)
+	}
+	if len(note) > maxStatusNoteLength {
+		return fmt.Errorf("%w: note is longer than %d characters", ErrInvalidStatusChange, maxStatusNoteLength)
+	}
+	return nil
+}
+
+func statusActor(ctx context.Context) string {
+	if subjectID := GetUserID(ctx); subjectID != nil {
+		return subjectID.String()
+	}
+	return systemActor
+}
@@ -0,0 +1,119 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidTag  = errors.New("invalid tag")
+	ErrTagNotFound = errors.New("tag not found")
+)
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// TagCount is a tag with the number of customers tagged with it.
+type TagCount struct {
+	Tag       string
+	Customers int
+}
+
+type TagRepository interface {
+	// TagsOf returns the tags of the customer in alphabetical order.
+	TagsOf(ctx context.Context, id CustomerID) ([]string, error)
+	// AddTag reports whether the customer was not tagged with the tag before.
+	AddTag(ctx context.Context, id CustomerID, tag string, taggedAt time.Time) (bool, error)
+	// RemoveTag returns ErrTagNotFound when the customer is not tagged with the tag.
+	RemoveTag(ctx context.Context, id CustomerID, tag string) error
+	TagCounts(ctx context.Context) ([]TagCount, error)
+}
+
+// Tags are labels admins put on customers, e.g. "vip" or "wholesale", which segment rules refer to.
+type Tags struct {
+	repo      TagRepository
+	customers Repository
+	events    EventHandler
+}
+
+func NewTags(repo TagRepository, customers Repository, events EventHandler) *Tags {
+	return &Tags{
+		repo:      repo,
+		customers: customers,
+		events:    events,
+	}
+}
+
+// All returns the tags in use with the number of their customers.
+func (t *Tags) All(ctx context.Context) ([]TagCount, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	return t.repo.TagCounts(ctx)
+}
+
+func (t *Tags) TagsOf(ctx context.Context, id CustomerID) ([]string, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if _, err := t.customers.FindByID(ctx, id); err != nil {
+		return nil, err
+	}
+	return t.repo.TagsOf(ctx, id)
+}
+
+// Tag adds the tag to the customer and returns its tags. Tags are lowercase, tagging twice changes nothing.
+func (t *Tags) Tag(ctx context.Context, id CustomerID, tag string) ([]string, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := t.customers.FindByID(ctx, id); err != nil {
+		return nil, err
+	}
+	added, err := t.repo.AddTag(ctx, id, tag, time.Now().UTC())
+	if err != nil {
+		return nil, err
+	}
+	tags, err := t.repo.TagsOf(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if added {
+		t.events.Handle(ctx, NewCustomerTagsChanged(id, tags))
+	}
+	return tags, nil
+}
+
+func (t *Tags) Untag(ctx context.Context, id CustomerID, tag string) error {
+	if !IsAdmin(ctx) {
+		return ErrNotAuthorized
+	}
+	tag, err := normalizeTag(tag)
+	if err != nil {
+		return err
+	}
+	if err := t.repo.RemoveTag(ctx, id, tag); err != nil {
+		return err
+	}
+	tags, err := t.repo.TagsOf(ctx, id)
+	if err != nil {
+		return err
+	}
+	t.events.Handle(ctx, NewCustomerTagsChanged(id, tags))
+	return nil
+}
+
+func normalizeTag(tag string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(tag))
+	if !tagPattern.MatchString(normalized) {
+		return "", fmt.Errorf("%w: %q must be letters, digits, underscores and hyphens, at most 64", ErrInvalidTag, tag)
+	}
+	return normalized, nil
+}
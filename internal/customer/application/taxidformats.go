@@ -0,0 +1,322 @@
+package application
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// euVATFormats are the formats of the national part of EU VAT numbers by their prefix. Greece uses
+// the prefix EL and Northern Ireland XI.
+var euVATFormats = map[string]*regexp.Regexp{
+	"AT": regexp.MustCompile(`^U\d{8}$`),
+	"BE": regexp.MustCompile(`^[01]\d{9}$`),
+	"BG": regexp.MustCompile(`^\d{9,10}$`),
+	"CY": regexp.MustCompile(`^\d{8}[A-Z]$`),
+	"CZ": regexp.MustCompile(`^\d{8,10}$`),
+	"DE": regexp.MustCompile(`^\d{9}$`),
+	"DK": regexp.MustCompile(`^\d{8}$`),
+	"EE": regexp.MustCompile(`^\d{9}$`),
+	"EL": regexp.MustCompile(`^\d{9}$`),
+	"ES": regexp.MustCompile(`^[A-Z0-9]\d{7}[A-Z0-9]$`),
+	"FI": regexp.MustCompile(`^\d{8}$`),
+	"FR": regexp.MustCompile(`^[0-9A-HJ-NP-Z]{2}\d{9}$`),
+	"HR": regexp.MustCompile(`^\d{11}$`),
+	"HU": regexp.MustCompile(`^\d{8}$`),
+	"IE": regexp.MustCompile(`^(\d{7}[A-W][A-IW]?|\d[A-Z+*]\d{5}[A-W])$`),
+	"IT": regexp.MustCompile(`^\d{11}$`),
+	"LT": regexp.MustCompile(`^(\d{9}|\d{12})$`),
+	"LU": regexp.MustCompile(`^\d{8}$`),
+	"LV": regexp.MustCompile(`^\d{11}$`),
+	"MT": regexp.MustCompile(`^\d{8}$`),
+	"NL": regexp.MustCompile(`^\d{9}B\d{2}$`),
+	"PL": regexp.MustCompile(`^\d{10}$`),
+	"PT": regexp.MustCompile(`^\d{9}$`),
+	"RO": regexp.MustCompile(`^[1-9]\d{1,9}$`),
+	"SE": regexp.MustCompile(`^\d{10}01$`),
+	"SI": regexp.MustCompile(`^[1-9]\d{7}$`),
+	"SK": regexp.MustCompile(`^[1-9]\d{9}$`),
+	"XI": regexp.MustCompile(`^(\d{9}|\d{12}|GD[0-4]\d{2}|HA[5-9]\d{2})$`),
+}
+
+// euVATChecksums verify the check digits of the countries whose algorithm is published,
+// the others are checked by their format only.
+var euVATChecksums = map[string]func(number string) bool{
+	"AT": checkATVAT,
+	"BE": func(n string) bool { return 97-mod(n[:8], 97) == atoi(n[8:]) },
+	"DE": checkISO7064Mod11_10,
+	"DK": func(n string) bool { return weightedSum(n, 2, 7, 6, 5, 4, 3, 2, 1)%11 == 0 },
+	"EE": func(n string) bool { return (10-weightedSum(n, 3, 7, 1, 3, 7, 1, 3, 7)%10)%10 == digit(n, 8) },
+	"EL": func(n string) bool {
+		return weightedSum(n, 256, 128, 64, 32, 16, 8, 4, 2)%11%10 == digit(n, 8)
+	},
+	"FI": checkFIVAT,
+	"FR": checkFRVAT,
+	"HR": checkISO7064Mod11_10,
+	"HU": func(n string) bool { return (10-weightedSum(n, 9, 7, 3, 1, 9, 7, 3)%10)%10 == digit(n, 7) },
+	"IT": checkLuhn,
+	"LU": func(n string) bool { return mod(n[:6], 89) == atoi(n[6:]) },
+	"NL": checkNLVAT,
+	"PL": func(n string) bool { return weightedSum(n, 6, 5, 7, 2, 3, 4, 5, 6, 7)%11 == digit(n, 9) },
+	"PT": checkPTVAT,
+	"SE": func(n string) bool { return checkLuhn(n[:10]) },
+	"SI": checkSIVAT,
+	"SK": func(n string) bool { return mod(n, 11) == 0 },
+	"XI": checkGBVAT,
+}
+
+var (
+	gbVATFormat = regexp.MustCompile(`^(\d{9}|\d{12}|GD[0-4]\d{2}|HA[5-9]\d{2})$`)
+	chVATFormat = regexp.MustCompile(`^CHE(\d{9})(MWST|TVA|IVA)?$`)
+	noVATFormat = regexp.MustCompile(`^(\d{9})(MVA)?$`)
+	ruINNFormat = regexp.MustCompile(`^(\d{10}|\d{12})$`)
+	usEINFormat = regexp.MustCompile(`^\d{9}$`)
+	auABNFormat = regexp.MustCompile(`^\d{11}$`)
+)
+
+// usEINPrefixes are the campus prefixes the IRS assigns EINs under.
+var usEINPrefixes = map[string]bool{}
+
+func init() {
+	for _, prefix := range strings.Fields(`01 02 03 04 05 06 10 11 12 13 14 15 16 20 21 22 23 24 25 26 27
+		30 31 32 33 34 35 36 37 38 39 40 41 42 43 44 45 46 47 48 50 51 52 53 54 55 56 57 58 59
+		60 61 62 63 64 65 66 67 68 71 72 73 74 75 76 77 80 81 82 83 84 85 86 87 88 90 91 92 93 94 95 98 99`) {
+		usEINPrefixes[prefix] = true
+	}
+}
+
+// normalizeTaxID validates the identifier of the type offline, by its format and check digits,
+// and returns it in canonical form with the ISO 3166-1 code of the issuing country.
+func normalizeTaxID(taxIDType, value string) (normalized, country string, err error) {
+	value = strings.ToUpper(strings.NewReplacer(" ", "", "-", "", ".", "", "/", "").Replace(value))
+	invalid := func() (string, string, error) {
+		return "", "", fmt.Errorf("%w: %q is not a valid %s", ErrInvalidTaxID, value, taxIDType)
+	}
+	switch taxIDType {
+	case TaxIDTypeEUVAT:
+		if len(value) < 3 {
+			return invalid()
+		}
+		prefix, number := value[:2], value[2:]
+		format, ok := euVATFormats[prefix]
+		if !ok || !format.MatchString(number) {
+			return invalid()
+		}
+		if checksum, ok := euVATChecksums[prefix]; ok && !checksum(number) {
+			return invalid()
+		}
+		country = prefix
+		switch prefix {
+		case "EL":
+			country = "GR"
+		case "XI":
+			country = "GB"
+		}
+		return value, country, nil
+	case TaxIDTypeGBVAT:
+		number := strings.TrimPrefix(value, "GB")
+		if !gbVATFormat.MatchString(number) || !checkGBVAT(number) {
+			return invalid()
+		}
+		return "GB" + number, "GB", nil
+	case TaxIDTypeCHVAT:
+		match := chVATFormat.FindStringSubmatch(value)
+		if match == nil || !checkCHUID(match[1]) {
+			return invalid()
+		}
+		return value, "CH", nil
+	case TaxIDTypeNOVAT:
+		match := noVATFormat.FindStringSubmatch(strings.TrimPrefix(value, "NO"))
+		if match == nil || !checkNOVAT(match[1]) {
+			return invalid()
+		}
+		return "NO" + match[1] + "MVA", "NO", nil
+	case TaxIDTypeRUINN:
+		if !ruINNFormat.MatchString(value) || !checkRUINN(value) {
+			return invalid()
+		}
+		return value, "RU", nil
+	case TaxIDTypeUSEIN:
+		if !usEINFormat.MatchString(value) || !usEINPrefixes[value[:2]] {
+			return invalid()
+		}
+		return value[:2] + "-" + value[2:], "US", nil
+	case TaxIDTypeAUABN:
+		if !auABNFormat.MatchString(value) || !checkAUABN(value) {
+			return invalid()
+		}
+		return value, "AU", nil
+	default:
+		return "", "", fmt.Errorf("%w: unknown type %q", ErrInvalidTaxID, taxIDType)
+	}
+}
+
+func checkATVAT(n string) bool {
+	sum := 0
+	for i := 1; i < 8; i++ {
+		d := digit(n, i)
+		if i%2 == 0 {
+			d *= 2
+			d = d/10 + d%10
+		}
+		sum += d
+	}
+	return (10-(sum+4)%10)%10 == digit(n, 8)
+}
+
+// checkFRVAT verifies the numeric key of a French number, alphanumeric keys have no published algorithm.
+func checkFRVAT(n string) bool {
+	key := n[:2]
+	if strings.Trim(key, "0123456789") != "" {
+		return true
+	}
+	return (12+3*mod(n[2:], 97))%97 == atoi(key)
+}
+
+// checkNLVAT accepts the mod 11 numbers of companies and the mod 97 numbers of sole proprietors issued since 2020.
+func checkNLVAT(n string) bool {
+	if weightedSum(n, 9, 8, 7, 6, 5, 4, 3, 2)%11 == digit(n, 8) {
+		return true
+	}
+	// "NL" is 2321 when the letters are replaced by their position + 9, "B" is 11
+	return mod("2321"+n[:9]+"11"+n[10:], 97) == 1
+}
+
+func checkGBVAT(n string) bool {
+	if len(n) != 9 && len(n) != 12 {
+		// government departments and health authorities have no check digits
+		return true
+	}
+	total := weightedSum(n, 8, 7, 6, 5, 4, 3, 2) + atoi(n[7:9])
+	return total%97 == 0 || (total+55)%97 == 0
+}
+
+func checkCHUID(n string) bool {
+	check := 11 - weightedSum(n, 5, 4, 3, 2, 7, 6, 5, 4)%11
+	if check == 11 {
+		check = 0
+	}
+	return check == digit(n, 8)
+}
+
+func checkRUINN(n string) bool {
+	check := func(weights ...int) int { return weightedSum(n, weights...) % 11 % 10 }
+	if len(n) == 10 {
+		return check(2, 4, 10, 3, 5, 9, 4, 6, 8) == digit(n, 9)
+	}
+	return check(7, 2, 4, 10, 3, 5, 9, 4, 6, 8) == digit(n, 10) &&
+		check(3, 7, 2, 4, 10, 3, 5, 9, 4, 6, 8) == digit(n, 11)
+}
+
+func checkAUABN(n string) bool {
+	weights := []int{10, 1, 3, 5, 7, 9, 11, 13, 15, 17, 19}
+	sum := (digit(n, 0) - 1) * weights[0]
+	for i := 1; i < len(weights); i++ {
+		sum += digit(n, i) * weights[i]
+	}
+	return sum%89 == 0
+}
+
+// checkISO7064Mod11_10 verifies the last digit of n with the ISO 7064 MOD 11,10 algorithm.
+func checkISO7064Mod11_10(n string) bool {
+	product := 10
+	for i := 0; i < len(n)-1; i++ {
+		sum := (digit(n, i) + product) % 10
+		if sum == 0 {
+			sum = 10
+		}
+		product = 2 * sum % 11
+	}
+	check := 11 - product
+	if check == 10 {
+		check = 0
+	}
+	return check == digit(n, len(n)-1)
+}
+
+func checkLuhn(n string) bool {
+	sum := 0
+	for i := len(n) - 1; i >= 0; i-- {
+		d := digit(n, i)
+		if (len(n)-i)%2 == 0 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// The countries below compute the check digit as 11 - sum mod 11, but differ in what they do with 10 and 11.
+
+// checkFIVAT maps 11 to 0, no number is issued with the check 10.
+func checkFIVAT(n string) bool {
+	check := 11 - weightedSum(n, 7, 9, 10, 5, 8, 4, 2)%11
+	switch check {
+	case 10:
+		return false
+	case 11:
+		check = 0
+	}
+	return check == digit(n, 7)
+}
+
+// checkNOVAT maps 11 to 0, no number is issued with the check 10.
+func checkNOVAT(n string) bool {
+	check := 11 - weightedSum(n, 3, 2, 7, 6, 5, 4, 3, 2)%11
+	switch check {
+	case 10:
+		return false
+	case 11:
+		check = 0
+	}
+	return check == digit(n, 8)
+}
+
+// checkPTVAT maps both 10 and 11 to 0.
+func checkPTVAT(n string) bool {
+	check := 11 - weightedSum(n, 9, 8, 7, 6, 5, 4, 3, 2)%11
+	if check >= 10 {
+		check = 0
+	}
+	return check == digit(n, 8)
+}
+
+// checkSIVAT maps 10 to 0, no number is issued with the check 11.
+func checkSIVAT(n string) bool {
+	check := 11 - weightedSum(n, 8, 7, 6, 5, 4, 3, 2)%11
+	switch check {
+	case 10:
+		check = 0
+	case 11:
+		return false
+	}
+	return check == digit(n, 7)
+}
+
+func weightedSum(n string, weights ...int) int {
+	sum := 0
+	for i, weight := range weights {
+		sum += digit(n, i) * weight
+	}
+	return sum
+}
+
+// mod returns the remainder of the decimal number n, which may be longer than an int.
+func mod(n string, m int) int {
+	r := 0
+	for i := range n {
+		r = (r*10 + digit(n, i)) % m
+	}
+	return r
+}
+
+func atoi(n string) int {
+	return mod(n, 1<<31-1)
+}
+
+func digit(n string, i int) int {
+	return int(n[i] - '0')
+}
@@ -0,0 +1,113 @@
+package application
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeTaxID(t *testing.T) {
+	tests := []struct {
+		taxIDType  string
+		value      string
+		normalized string
+		country    string
+	}{
+		{TaxIDTypeEUVAT, "ATU13585627", "ATU13585627", "AT"},
+		{TaxIDTypeEUVAT, "BE 0403.019.261", "BE0403019261", "BE"},
+		{TaxIDTypeEUVAT, "DE 136 695 976", "DE136695976", "DE"},
+		{TaxIDTypeEUVAT, "DK13585628", "DK13585628", "DK"},
+		{TaxIDTypeEUVAT, "EE100931558", "EE100931558", "EE"},
+		{TaxIDTypeEUVAT, "EL094259216", "EL094259216", "GR"},
+		{TaxIDTypeEUVAT, "FI20774740", "FI20774740", "FI"},
+		{TaxIDTypeEUVAT, "FR40303265045", "FR40303265045", "FR"},
+		{TaxIDTypeEUVAT, "FRK7399859412", "FRK7399859412", "FR"},
+		{TaxIDTypeEUVAT, "HR33392005961", "HR33392005961", "HR"},
+		{TaxIDTypeEUVAT, "HU12892312", "HU12892312", "HU"},
+		{TaxIDTypeEUVAT, "IT00743110157", "IT00743110157", "IT"},
+		{TaxIDTypeEUVAT, "LU15027442", "LU15027442", "LU"},
+		{TaxIDTypeEUVAT, "NL004495445B01", "NL004495445B01", "NL"},
+		{TaxIDTypeEUVAT, "NL000099998B57", "NL000099998B57", "NL"},
+		{TaxIDTypeEUVAT, "PL8567346215", "PL8567346215", "PL"},
+		{TaxIDTypeEUVAT, "PT501964843", "PT501964843", "PT"},
+		// the check 10 is 0
+		{TaxIDTypeEUVAT, "PT500000000", "PT500000000", "PT"},
+		// the check 11 is 0
+		{TaxIDTypeEUVAT, "PT100000010", "PT100000010", "PT"},
+		{TaxIDTypeEUVAT, "SE123456789701", "SE123456789701", "SE"},
+		{TaxIDTypeEUVAT, "SI50223704", "SI50223704", "SI"},
+		// the check 10 is 0
+		{TaxIDTypeEUVAT, "SI10000020", "SI10000020", "SI"},
+		{TaxIDTypeEUVAT, "SK2022749619", "SK2022749619", "SK"},
+		{TaxIDTypeEUVAT, "XI980780684", "XI980780684", "GB"},
+		{TaxIDTypeGBVAT, "GB 980 7806 84", "GB980780684", "GB"},
+		{TaxIDTypeGBVAT, "GD100", "GBGD100", "GB"},
+		{TaxIDTypeCHVAT, "CHE-100.155.212 MWST", "CHE100155212MWST", "CH"},
+		{TaxIDTypeNOVAT, "NO 995 525 828 MVA", "NO995525828MVA", "NO"},
+		{TaxIDTypeRUINN, "1234567894", "1234567894", "RU"},
+		{TaxIDTypeRUINN, "123456789047", "123456789047", "RU"},
+		{TaxIDTypeUSEIN, "04-2103594", "04-2103594", "US"},
+		{TaxIDTypeAUABN, "83 914 571 673", "83914571673", "AU"},
+	}
+	for _, test := range tests {
+		normalized, country, err := normalizeTaxID(test.taxIDType, test.value)
+		if err != nil {
+			t.Errorf("normalizeTaxID(%s, %q) failed: %v", test.taxIDType, test.value, err)
+			continue
+		}
+		if normalized != test.normalized || country != test.country {
+			t.Errorf("normalizeTaxID(%s, %q) = %q, %q, want %q, %q",
+				test.taxIDType, test.value, normalized, country, test.normalized, test.country)
+		}
+	}
+}
+
+func TestNormalizeTaxIDRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		taxIDType string
+		value     string
+	}{
+		{TaxIDTypeEUVAT, "ATU13585626"},
+		{TaxIDTypeEUVAT, "BE0403019262"},
+		{TaxIDTypeEUVAT, "DE136695978"},
+		{TaxIDTypeEUVAT, "DK13585627"},
+		{TaxIDTypeEUVAT, "EE100931559"},
+		{TaxIDTypeEUVAT, "EL094259217"},
+		{TaxIDTypeEUVAT, "FI20774741"},
+		// the check 10 is never issued
+		{TaxIDTypeEUVAT, "FI10000080"},
+		{TaxIDTypeEUVAT, "FI10000081"},
+		{TaxIDTypeEUVAT, "FR41303265045"},
+		{TaxIDTypeEUVAT, "HR33392005962"},
+		{TaxIDTypeEUVAT, "HU12892313"},
+		{TaxIDTypeEUVAT, "IT00743110158"},
+		{TaxIDTypeEUVAT, "LU15027443"},
+		{TaxIDTypeEUVAT, "NL004495446B01"},
+		{TaxIDTypeEUVAT, "PL8567346216"},
+		{TaxIDTypeEUVAT, "PT501964842"},
+		{TaxIDTypeEUVAT, "PT500000001"},
+		{TaxIDTypeEUVAT, "SE123456789101"},
+		{TaxIDTypeEUVAT, "SI50223707"},
+		// the check 11 is never issued
+		{TaxIDTypeEUVAT, "SI10000070"},
+		{TaxIDTypeEUVAT, "SI10000071"},
+		{TaxIDTypeEUVAT, "SK2022749618"},
+		{TaxIDTypeEUVAT, "XI980780685"},
+		{TaxIDTypeEUVAT, "DE12345678"},
+		{TaxIDTypeEUVAT, "GB980780684"},
+		{TaxIDTypeGBVAT, "GB802311781"},
+		{TaxIDTypeCHVAT, "CHE-100.155.213"},
+		{TaxIDTypeNOVAT, "NO995525829"},
+		{TaxIDTypeNOVAT, "NO900000090"},
+		{TaxIDTypeNOVAT, "NO900000091"},
+		{TaxIDTypeRUINN, "1234567895"},
+		{TaxIDTypeRUINN, "123456789037"},
+		{TaxIDTypeUSEIN, "07-1144442"},
+		{TaxIDTypeAUABN, "99 999 999 999"},
+		{"xx_vat", "123"},
+	}
+	for _, test := range tests {
+		if _, _, err := normalizeTaxID(test.taxIDType, test.value); !errors.Is(err, ErrInvalidTaxID) {
+			t.Errorf("normalizeTaxID(%s, %q) = %v, want ErrInvalidTaxID", test.taxIDType, test.value, err)
+		}
+	}
+}
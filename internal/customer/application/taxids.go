@@ -0,0 +1,201 @@
+package application
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+// Types of tax identifiers, see normalizeTaxID for their formats.
+const (
+	// TaxIDTypeEUVAT is a VAT number of an EU member state with its prefix, e.g. "DE123456789".
+	TaxIDTypeEUVAT = "eu_vat"
+	TaxIDTypeGBVAT = "gb_vat"
+	// TaxIDTypeCHVAT is a Swiss UID with the VAT suffix, e.g. "CHE-116.281.710 MWST".
+	TaxIDTypeCHVAT = "ch_vat"
+	TaxIDTypeNOVAT = "no_vat"
+	TaxIDTypeRUINN = "ru_inn"
+	TaxIDTypeUSEIN = "us_ein"
+	TaxIDTypeAUABN = "au_abn"
+)
+
+// Statuses of the online verification of a tax ID.
+const (
+	// TaxIDStatusUnverified passed the offline validation and was not verified online.
+	TaxIDStatusUnverified = "unverified"
+	TaxIDStatusValid      = "valid"
+	TaxIDStatusInvalid    = "invalid"
+	// TaxIDStatusUnavailable means the registry could not be reached, the verification may be repeated.
+	TaxIDStatusUnavailable = "unavailable"
+)
+
+// Kinds of the holders of tax IDs.
+const (
+	TaxIDHolderCustomer     = "customer"
+	TaxIDHolderOrganization = "organization"
+)
+
+var (
+	ErrInvalidTaxID  = errors.New("invalid tax id")
+	ErrTaxIDNotFound = errors.New("tax id not found")
+	// ErrTaxIDVerificationUnsupported is returned by a verifier for the types its registry does not cover.
+	ErrTaxIDVerificationUnsupported = errors.New("tax id verification is not supported")
+)
+
+type TaxID struct {
+	Type string
+	// Value is the identifier in canonical form, e.g. "DE123456789" or "12-3456789".
+	Value string
+	// Country is the ISO 3166-1 alpha-2 code of the issuing country, "GR" for the Greek prefix "EL".
+	Country string
+	Status  string
+	// CheckedAt is the time of the last online verification, nil when the ID has not been verified online.
+	CheckedAt *time.Time
+	UpdatedAt time.Time
+}
+
+// TaxIDHolder is the customer or the organization a tax ID belongs to.
+type TaxIDHolder struct {
+	Kind string
+	ID   uuid.UUID
+}
+
+type TaxIDRepository interface {
+	// FindTaxID returns nil when the holder has no tax ID.
+	FindTaxID(ctx context.Context, holder TaxIDHolder) (*TaxID, error)
+	SaveTaxID(ctx context.Context, holder TaxIDHolder, taxID TaxID) error
+	// DeleteTaxID returns ErrTaxIDNotFound when the holder has no tax ID.
+	DeleteTaxID(ctx context.Context, holder TaxIDHolder) error
+}
+
+// TaxIDVerifier checks a tax ID against the registry of the issuing country, e.g. VIES for EU VAT numbers.
+type TaxIDVerifier interface {
+	// Verify returns TaxIDStatusValid or TaxIDStatusInvalid, or ErrTaxIDVerificationUnsupported.
+	// Any other error means the registry could not answer.
+	Verify(ctx context.Context, taxID TaxID) (string, error)
+}
+
+// TaxIDs keeps the tax IDs of customers and organizations. Customers manage their own tax ID, owners and
+// admins the one of their organization, which every member may read.
+type TaxIDs struct {
+	repo          TaxIDRepository
+	verifier      TaxIDVerifier
+	customers     Repository
+	organizations OrganizationRepository
+}
+
+func NewTaxIDs(repo TaxIDRepository, verifier TaxIDVerifier, customers Repository, organizations OrganizationRepository) *TaxIDs {
+	return &TaxIDs{
+		repo:          repo,
+		verifier:      verifier,
+		customers:     customers,
+		organizations: organizations,
+	}
+}
+
+func (t *TaxIDs) Get(ctx context.Context, holder TaxIDHolder) (*TaxID, error) {
+	if err := t.authorize(ctx, holder, false); err != nil {
+		return nil, err
+	}
+	taxID, err := t.repo.FindTaxID(ctx, holder)
+	if err != nil {
+		return nil, err
+	}
+	if taxID == nil {
+		return nil, ErrTaxIDNotFound
+	}
+	return taxID, nil
+}
+
+// Set validates the tax ID offline, verifies it online and saves it. Setting the saved ID again keeps its verification.
+func (t *TaxIDs) Set(ctx context.Context, holder TaxIDHolder, taxIDType, value string) (*TaxID, error) {
+	normalized, country, err := normalizeTaxID(taxIDType, value)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.authorize(ctx, holder, true); err != nil {
+		return nil, err
+	}
+	saved, err := t.repo.FindTaxID(ctx, holder)
+	if err != nil {
+		return nil, err
+	}
+	if saved != nil && saved.Type == taxIDType && saved.Value == normalized {
+		return saved, nil
+	}
+	taxID := TaxID{
+		Type:      taxIDType,
+		Value:     normalized,
+		Country:   country,
+		Status:    TaxIDStatusUnverified,
+		UpdatedAt: time.Now().UTC(),
+	}
+	t.verify(ctx, &taxID)
+	if err := t.repo.SaveTaxID(ctx, holder, taxID); err != nil {
+		return nil, err
+	}
+	return &taxID, nil
+}
+
+// Verify repeats the online verification, e.g. after the registry was unavailable.
+func (t *TaxIDs) Verify(ctx context.Context, holder TaxIDHolder) (*TaxID, error) {
+	if err := t.authorize(ctx, holder, true); err != nil {
+		return nil, err
+	}
+	taxID, err := t.repo.FindTaxID(ctx, holder)
+	if err != nil {
+		return nil, err
+	}
+	if taxID == nil {
+		return nil, ErrTaxIDNotFound
+	}
+	t.verify(ctx, taxID)
+	if err := t.repo.SaveTaxID(ctx, holder, *taxID); err != nil {
+		return nil, err
+	}
+	return taxID, nil
+}
+
+func (t *TaxIDs) Delete(ctx context.Context, holder TaxIDHolder) error {
+	if err := t.authorize(ctx, holder, true); err != nil {
+		return err
+	}
+	return t.repo.DeleteTaxID(ctx, holder)
+}
+
+// verify records the answer of the registry, an unsupported type keeps its status.
+func (t *TaxIDs) verify(ctx context.Context, taxID *TaxID) {
+	status, err := t.verifier.Verify(ctx, *taxID)
+	if errors.Is(err, ErrTaxIDVerificationUnsupported) {
+		return
+	}
+	now := time.Now().UTC()
+	taxID.CheckedAt = &now
+	if err != nil {
+		taxID.Status = TaxIDStatusUnavailable
+		return
+	}
+	taxID.Status = status
+}
+
+func (t *TaxIDs) authorize(ctx context.Context, holder TaxIDHolder, write bool) error {
+	switch holder.Kind {
+	case TaxIDHolderCustomer:
+		_, err := findOwnedCustomer(ctx, t.customers, holder.ID)
+		return err
+	case TaxIDHolderOrganization:
+		roles := []string{RoleOwner, RoleAdmin}
+		if !write {
+			roles = append(roles, RoleBuyer, RoleViewer)
+		}
+		if err := authorizeMember(ctx, t.organizations, t.customers, holder.ID, roles...); err != nil {
+			return err
+		}
+		_, err := t.organizations.FindOrganization(ctx, holder.ID)
+		return err
+	default:
+		return ErrNotAuthorized
+	}
+}
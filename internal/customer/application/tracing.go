@@ -0,0 +1,93 @@
+package application
+
+import (
+	"context"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/jnikolaeva/customerservice/internal/customer/application"
+
+type tracing struct {
+	service Service
+	tracer  trace.Tracer
+}
+
+func NewTracingService(service Service) Service {
+	return &tracing{
+		service: service,
+		tracer:  otel.Tracer(tracerName),
+	}
+}
+
+func (t tracing) Register(ctx context.Context, username, password, firstName, lastName, email, phone string) (_ CustomerID, err error) {
+	ctx, span := t.tracer.Start(ctx, "CustomerService.Register")
+	defer func() { end(span, err) }()
+	return t.service.Register(ctx, username, password, firstName, lastName, email, phone)
+}
+
+func (t tracing) Create(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (_ CustomerID, err error) {
+	ctx, span := t.start(ctx, "Create", id)
+	defer func() { end(span, err) }()
+	return t.service.Create(ctx, id, firstName, lastName, email, phone)
+}
+
+func (t tracing) FindByID(ctx context.Context, id uuid.UUID) (_ *Customer, err error) {
+	ctx, span := t.start(ctx, "FindByID", id)
+	defer func() { end(span, err) }()
+	return t.service.FindByID(ctx, id)
+}
+
+func (t tracing) Update(ctx context.Context, id uuid.UUID, firstName, lastName, email, phone string) (_ *Customer, err error) {
+	ctx, span := t.start(ctx, "Update", id)
+	defer func() { end(span, err) }()
+	return t.service.Update(ctx, id, firstName, lastName, email, phone)
+}
+
+func (t tracing) FindByEmail(ctx context.Context, email string) (_ []Customer, err error) {
+	ctx, span := t.tracer.Start(ctx, "CustomerService.FindByEmail")
+	defer func() { end(span, err) }()
+	return t.service.FindByEmail(ctx, email)
+}
+
+func (t tracing) Close(ctx context.Context, id uuid.UUID) (err error) {
+	ctx, span := t.start(ctx, "Close", id)
+	defer func() { end(span, err) }()
+	return t.service.Close(ctx, id)
+}
+
+func (t tracing) ChangeStatus(ctx context.Context, id uuid.UUID, status, reason, note string) (_ *Customer, err error) {
+	ctx, span := t.start(ctx, "ChangeStatus", id)
+	defer func() { end(span, err) }()
+	span.SetAttributes(attribute.String("customer.status", status), attribute.String("customer.status_reason", reason))
+	return t.service.ChangeStatus(ctx, id, status, reason, note)
+}
+
+func (t tracing) StatusHistory(ctx context.Context, id uuid.UUID) (_ []StatusChange, err error) {
+	ctx, span := t.start(ctx, "StatusHistory", id)
+	defer func() { end(span, err) }()
+	return t.service.StatusHistory(ctx, id)
+}
+
+func (t tracing) Merge(ctx context.Context, survivorID, mergedID uuid.UUID) (_ *Customer, err error) {
+	ctx, span := t.start(ctx, "Merge", survivorID)
+	defer func() { end(span, err) }()
+	span.SetAttributes(attribute.String("customer.merged_id", mergedID.String()))
+	return t.service.Merge(ctx, survivorID, mergedID)
+}
+
+func (t tracing) start(ctx context.Context, operation string, id uuid.UUID) (context.Context, trace.Span) {
+	return t.tracer.Start(ctx, "CustomerService."+operation, trace.WithAttributes(attribute.String("customer.id", id.String())))
+}
+
+func end(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
@@ -0,0 +1,309 @@
+package application
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	mathrand "math/rand"
+	"net/url"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+)
+
+const (
+	WebhookStatusPending   = "pending"
+	WebhookStatusDelivered = "delivered"
+	WebhookStatusDead      = "dead"
+)
+
+const maxWebhookDeliveries = 100
+
+var (
+	ErrWebhookNotFound = errors.New("webhook not found")
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+)
+
+type WebhookSubscription struct {
+	ID         uuid.UUID
+	URL        string
+	EventTypes []string
+	// Secret signs the deliveries, it is returned only when the subscription is created.
+	Secret    string
+	CreatedAt time.Time
+}
+
+type WebhookDelivery struct {
+	ID             uuid.UUID
+	SubscriptionID uuid.UUID
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int
+	NextAttemptAt  time.Time
+	LastStatusCode int
+	LastError      string
+	CreatedAt      time.Time
+	DeliveredAt    *time.Time
+}
+
+// ClaimedDelivery is a due delivery together with the target of its subscription.
+type ClaimedDelivery struct {
+	WebhookDelivery
+	URL    string
+	Secret string
+}
+
+type WebhookRepository interface {
+	AddSubscription(ctx context.Context, subscription WebhookSubscription) error
+	ListSubscriptions(ctx context.Context) ([]WebhookSubscription, error)
+	// DeleteSubscription deletes the deliveries as well, it returns ErrWebhookNotFound for an unknown ID.
+	DeleteSubscription(ctx context.Context, id uuid.UUID) error
+	// ClaimDue returns pending deliveries which are due and postpones them by lease,
+	// so that concurrent dispatchers do not send them twice.
+	ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]ClaimedDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery WebhookDelivery) error
+	// ListDeliveries returns the latest deliveries of the subscription, optionally filtered by status.
+	ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, limit int) ([]WebhookDelivery, error)
+	// Redeliver makes the delivery pending and due with a fresh attempt budget.
+	Redeliver(ctx context.Context, id uuid.UUID) error
+}
+
+// WebhookRetryPolicy spaces the attempts of a delivery exponentially, with jitter,
+// and gives up after MaxAttempts.
+type WebhookRetryPolicy struct {
+	MaxAttempts    int
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+}
+
+func (p WebhookRetryPolicy) Backoff(attempt int) time.Duration {
+	backoff := float64(p.InitialBackoff) * math.Pow(2, float64(attempt-1))
+	if backoff > float64(p.MaxBackoff) {
+		backoff = float64(p.MaxBackoff)
+	}
+	// up to 20% jitter spreads the retries of a recovering endpoint
+	return time.Duration(backoff * (0.8 + 0.2*mathrand.Float64()))
+}
+
+// RecordAttempt moves the delivery to its next state after an attempt.
+// 410 Gone means the receiver will never accept the delivery.
+func (d *WebhookDelivery) RecordAttempt(statusCode int, err error, now time.Time, policy WebhookRetryPolicy) {
+	d.Attempts++
+	d.LastStatusCode = statusCode
+	d.LastError = ""
+	if err == nil && statusCode >= 200 && statusCode < 300 {
+		d.Status = WebhookStatusDelivered
+		d.DeliveredAt = &now
+		return
+	}
+	if err != nil {
+		d.LastError = err.Error()
+	} else {
+		d.LastError = fmt.Sprintf("unexpected status code %d", statusCode)
+	}
+	if d.Attempts >= policy.MaxAttempts || statusCode == 410 {
+		d.Status = WebhookStatusDead
+		return
+	}
+	d.Status = WebhookStatusPending
+	d.NextAttemptAt = now.Add(policy.Backoff(d.Attempts))
+}
+
+type webhookPayload struct {
+	ID         string           `json:"id"`
+	Type       string           `json:"type"`
+	OccurredAt time.Time        `json:"occurredAt"`
+	CustomerID string           `json:"customerId"`
+	Customer   *webhookCustomer `json:"customer,omitempty"`
+	Consent    *webhookConsent  `json:"consent,omitempty"`
+	// MergedInto is the ID of the survivor of a merge, whose profile is the customer.
+	MergedInto string `json:"mergedInto,omitempty"`
+}
+
+type webhookConsent struct {
+	Purpose       string    `json:"purpose"`
+	Channel       string    `json:"channel"`
+	Granted       bool      `json:"granted"`
+	Source        string    `json:"source"`
+	PolicyVersion string    `json:"policyVersion"`
+	RecordedAt    time.Time `json:"recordedAt"`
+}
+
+type webhookCustomer struct {
+	ID        string `json:"id"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+	Status    string `json:"status"`
+}
+
+// Webhooks manages the subscriptions of partners and turns customer events into deliveries.
+type Webhooks struct {
+	repo WebhookRepository
+}
+
+func NewWebhooks(repo WebhookRepository) *Webhooks {
+	return &Webhooks{
+		repo: repo,
+	}
+}
+
+// Subscribe registers the URL for the event types. A secret is generated when none is given.
+func (w *Webhooks) Subscribe(ctx context.Context, callbackURL string, eventTypes []string, secret string) (*WebhookSubscription, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	if parsed, err := url.Parse(callbackURL); err != nil || (parsed.Scheme != "https" && parsed.Scheme != "http") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https URL", ErrInvalidWebhook)
+	}
+	if len(eventTypes) == 0 {
+		return nil, fmt.Errorf("%w: at least one event type is required", ErrInvalidWebhook)
+	}
+	for _, eventType := range eventTypes {
+		if !isWebhookEventType(eventType) {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidWebhook, eventType)
+		}
+	}
+	if secret == "" {
+		var err error
+		if secret, err = generateWebhookSecret(); err != nil {
+			return nil, err
+		}
+	}
+	subscription := WebhookSubscription{
+		ID:         uuid.Generate(),
+		URL:        callbackURL,
+		EventTypes: eventTypes,
+		Secret:     secret,
+		CreatedAt:  time.Now().UTC(),
+	}
+	if err := w.repo.AddSubscription(ctx, subscription); err != nil {
+		return nil, err
+	}
+	return &subscription, nil
+}
+
+func (w *Webhooks) Subscriptions(ctx context.Context) ([]WebhookSubscription, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	return w.repo.ListSubscriptions(ctx)
+}
+
+func (w *Webhooks) Unsubscribe(ctx context.Context, id uuid.UUID) error {
+	if !IsAdmin(ctx) {
+		return ErrNotAuthorized
+	}
+	return w.repo.DeleteSubscription(ctx, id)
+}
+
+func (w *Webhooks) Deliveries(ctx context.Context, subscriptionID uuid.UUID, status string) ([]WebhookDelivery, error) {
+	if !IsAdmin(ctx) {
+		return nil, ErrNotAuthorized
+	}
+	switch status {
+	case "", WebhookStatusPending, WebhookStatusDelivered, WebhookStatusDead:
+	default:
+		return nil, fmt.Errorf("%w: unknown delivery status %q", ErrInvalidWebhook, status)
+	}
+	return w.repo.ListDeliveries(ctx, subscriptionID, status, maxWebhookDeliveries)
+}
+
+func (w *Webhooks) Redeliver(ctx context.Context, deliveryID uuid.UUID) error {
+	if !IsAdmin(ctx) {
+		return ErrNotAuthorized
+	}
+	return w.repo.Redeliver(ctx, deliveryID)
+}
+
+// NewWebhookDeliveries returns a delivery of the event for every subscription to its type. The repositories
+// save them in the transaction of the change, so that a change is never committed without its deliveries.
+func NewWebhookDeliveries(event Event, subscriptions []WebhookSubscription) ([]WebhookDelivery, error) {
+	if len(subscriptions) == 0 {
+		return nil, nil
+	}
+	payload, err := newWebhookPayload(event)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now().UTC()
+	deliveries := make([]WebhookDelivery, 0, len(subscriptions))
+	for _, subscription := range subscriptions {
+		deliveries = append(deliveries, WebhookDelivery{
+			ID:             uuid.Generate(),
+			SubscriptionID: subscription.ID,
+			EventType:      event.EventType(),
+			Payload:        payload,
+			Status:         WebhookStatusPending,
+			NextAttemptAt:  now,
+			CreatedAt:      now,
+		})
+	}
+	return deliveries, nil
+}
+
+// newWebhookPayload serializes the event once for all subscriptions, its ID lets receivers drop duplicates.
+func newWebhookPayload(event Event) ([]byte, error) {
+	payload := webhookPayload{
+		ID:         uuid.Generate().String(),
+		Type:       event.EventType(),
+		OccurredAt: event.OccurredAt(),
+		CustomerID: event.CustomerID().String(),
+	}
+	var customer *Customer
+	switch e := event.(type) {
+	case CustomerRegistered:
+		customer = &e.Customer
+	case CustomerUpdated:
+		customer = &e.Customer
+	case CustomerStatusChanged:
+		customer = &e.Customer
+	case CustomersMerged:
+		customer = &e.Survivor
+		payload.MergedInto = e.Survivor.ID.String()
+	case CustomerConsentChanged:
+		payload.Consent = &webhookConsent{
+			Purpose:       e.Consent.Purpose,
+			Channel:       e.Consent.Channel,
+			Granted:       e.Consent.Granted,
+			Source:        e.Consent.Source,
+			PolicyVersion: e.Consent.PolicyVersion,
+			RecordedAt:    e.Consent.RecordedAt,
+		}
+	}
+	if customer != nil {
+		payload.Customer = &webhookCustomer{
+			ID:        customer.ID.String(),
+			FirstName: customer.FirstName,
+			LastName:  customer.LastName,
+			Email:     customer.Email,
+			Phone:     customer.Phone,
+			Status:    customer.Status,
+		}
+	}
+	return json.Marshal(payload)
+}
+
+func isWebhookEventType(eventType string) bool {
+	switch eventType {
+	case EventTypeCustomerRegistered, EventTypeCustomerUpdated, EventTypeCustomerClosed, EventTypeStatusChanged,
+		EventTypeConsentChanged, EventTypeCustomersMerged:
+		return true
+	default:
+		return false
+	}
+}
+
+func generateWebhookSecret() (string, error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", fmt.Errorf("failed to generate webhook secret: %w", err)
+	}
+	return hex.EncodeToString(secret), nil
+}
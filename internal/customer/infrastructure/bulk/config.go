@@ -0,0 +1,20 @@
+package bulk
+
+import (
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	// HashKey keys the HMAC of the columns redacted with "hash", without it they cannot be hashed.
+	// Exports hashed with the same key can be joined on the hashed columns.
+	HashKey string `envconfig:"EXPORT_HASH_KEY"`
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse export environment config values")
+	}
+	return config, nil
+}
@@ -0,0 +1,172 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// maxLineSize bounds a single NDJSON record.
+const maxLineSize = 1024 * 1024
+
+var ErrUnsupportedFormat = errors.New("unsupported format")
+
+// importColumns maps the accepted CSV header names to the record fields.
+var importColumns = map[string]func(record *application.ImportRecord) *string{
+	"id":         func(r *application.ImportRecord) *string { return &r.ID },
+	"username":   func(r *application.ImportRecord) *string { return &r.Username },
+	"password":   func(r *application.ImportRecord) *string { return &r.Password },
+	"first_name": func(r *application.ImportRecord) *string { return &r.FirstName },
+	"firstname":  func(r *application.ImportRecord) *string { return &r.FirstName },
+	"last_name":  func(r *application.ImportRecord) *string { return &r.LastName },
+	"lastname":   func(r *application.ImportRecord) *string { return &r.LastName },
+	"email":      func(r *application.ImportRecord) *string { return &r.Email },
+	"phone":      func(r *application.ImportRecord) *string { return &r.Phone },
+}
+
+// NewImportSource reads records of the given format. Line numbers count from 1 and include
+// the CSV header, so that they point to the line of the file.
+func NewImportSource(format string, r io.Reader) (application.ImportSource, error) {
+	switch format {
+	case FormatCSV:
+		return newCSVSource(r), nil
+	case FormatNDJSON:
+		scanner := bufio.NewScanner(r)
+		scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+		return &ndjsonSource{scanner: scanner}, nil
+	default:
+		return nil, errors.WithMessagef(ErrUnsupportedFormat, "%q", format)
+	}
+}
+
+type csvSource struct {
+	reader  *csv.Reader
+	columns []func(record *application.ImportRecord) *string
+	header  bool
+}
+
+func newCSVSource(r io.Reader) *csvSource {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	return &csvSource{reader: reader}
+}
+
+func (s *csvSource) Read() (application.ImportRecord, error) {
+	if !s.header {
+		if err := s.readHeader(); err != nil {
+			return application.ImportRecord{}, err
+		}
+	}
+	fields, err := s.reader.Read()
+	if err == io.EOF {
+		return application.ImportRecord{}, io.EOF
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return application.ImportRecord{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+		}
+		return application.ImportRecord{}, errors.WithStack(err)
+	}
+	line, _ := s.reader.FieldPos(0)
+	record := application.ImportRecord{Line: line}
+	if len(fields) != len(s.columns) {
+		record.Err = errors.Errorf("expected %d fields, got %d", len(s.columns), len(fields))
+		return record, nil
+	}
+	for i, field := range fields {
+		if s.columns[i] != nil {
+			*s.columns[i](&record) = field
+		}
+	}
+	trimRecord(&record)
+	return record, nil
+}
+
+// readHeader resolves the columns by name, unknown columns are ignored.
+func (s *csvSource) readHeader() error {
+	names, err := s.reader.Read()
+	if err == io.EOF {
+		return io.EOF
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to read CSV header")
+	}
+	s.columns = make([]func(record *application.ImportRecord) *string, len(names))
+	hasEmail := false
+	for i, name := range names {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\uFEFF")))
+		s.columns[i] = importColumns[name]
+		hasEmail = hasEmail || name == "email"
+	}
+	if !hasEmail {
+		return errors.New("CSV header has no email column")
+	}
+	s.header = true
+	return nil
+}
+
+type ndjsonRecord struct {
+	ID        string `json:"id"`
+	Username  string `json:"username"`
+	Password  string `json:"password"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+	Email     string `json:"email"`
+	Phone     string `json:"phone"`
+}
+
+type ndjsonSource struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (s *ndjsonSource) Read() (application.ImportRecord, error) {
+	for s.scanner.Scan() {
+		s.line++
+		data := strings.TrimSpace(s.scanner.Text())
+		if data == "" {
+			continue
+		}
+		record := application.ImportRecord{Line: s.line}
+		var raw ndjsonRecord
+		if err := json.Unmarshal([]byte(data), &raw); err != nil {
+			record.Err = errors.Wrap(err, "malformed JSON")
+			return record, nil
+		}
+		record.ID = raw.ID
+		record.Username = raw.Username
+		record.Password = raw.Password
+		record.FirstName = raw.FirstName
+		record.LastName = raw.LastName
+		record.Email = raw.Email
+		record.Phone = raw.Phone
+		trimRecord(&record)
+		return record, nil
+	}
+	if err := s.scanner.Err(); err != nil {
+		return application.ImportRecord{}, errors.Wrapf(err, "failed to read line %d", s.line+1)
+	}
+	return application.ImportRecord{}, io.EOF
+}
+
+// trimRecord removes surrounding spaces from every field but the password.
+func trimRecord(record *application.ImportRecord) {
+	record.ID = strings.TrimSpace(record.ID)
+	record.Username = strings.TrimSpace(record.Username)
+	record.FirstName = strings.TrimSpace(record.FirstName)
+	record.LastName = strings.TrimSpace(record.LastName)
+	record.Email = strings.TrimSpace(record.Email)
+	record.Phone = strings.TrimSpace(record.Phone)
+}
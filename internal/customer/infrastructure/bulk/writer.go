@@ -0,0 +1,130 @@
+package bulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const FormatParquet = "parquet"
+
+// parquetRowGroupSize bounds the rows buffered by the parquet writer.
+const parquetRowGroupSize = 10000
+
+var csvHeader = []string{"id", "first_name", "last_name", "email", "phone", "status", "created_at", "updated_at"}
+
+type exportedCustomer struct {
+	ID        string    `json:"id" parquet:"id"`
+	FirstName string    `json:"firstName" parquet:"first_name"`
+	LastName  string    `json:"lastName" parquet:"last_name"`
+	Email     string    `json:"email" parquet:"email"`
+	Phone     string    `json:"phone" parquet:"phone"`
+	Status    string    `json:"status" parquet:"status"`
+	CreatedAt time.Time `json:"createdAt" parquet:"created_at,timestamp(millisecond)"`
+	UpdatedAt time.Time `json:"updatedAt" parquet:"updated_at,timestamp(millisecond)"`
+}
+
+// ContentType returns the media type of the export format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv; charset=utf-8"
+	case FormatParquet:
+		return "application/vnd.apache.parquet"
+	default:
+		return "application/x-ndjson"
+	}
+}
+
+func NewExportWriter(format string, w io.Writer) (application.CustomerWriter, error) {
+	switch format {
+	case FormatNDJSON:
+		buffered := bufio.NewWriter(w)
+		return &ndjsonWriter{buffered: buffered, encoder: json.NewEncoder(buffered)}, nil
+	case FormatCSV:
+		return &csvWriter{writer: csv.NewWriter(w)}, nil
+	case FormatParquet:
+		return &parquetWriter{writer: parquet.NewGenericWriter[exportedCustomer](w, parquet.MaxRowsPerRowGroup(parquetRowGroupSize))}, nil
+	default:
+		return nil, errors.WithMessagef(ErrUnsupportedFormat, "%q", format)
+	}
+}
+
+func toExportedCustomer(customer application.Customer) exportedCustomer {
+	return exportedCustomer{
+		ID:        customer.ID.String(),
+		FirstName: customer.FirstName,
+		LastName:  customer.LastName,
+		Email:     customer.Email,
+		Phone:     customer.Phone,
+		Status:    customer.Status,
+		CreatedAt: customer.CreatedAt,
+		UpdatedAt: customer.UpdatedAt,
+	}
+}
+
+type ndjsonWriter struct {
+	buffered *bufio.Writer
+	encoder  *json.Encoder
+}
+
+func (w *ndjsonWriter) Write(customer application.Customer) error {
+	return errors.WithStack(w.encoder.Encode(toExportedCustomer(customer)))
+}
+
+func (w *ndjsonWriter) Close() error {
+	return errors.WithStack(w.buffered.Flush())
+}
+
+type csvWriter struct {
+	writer *csv.Writer
+	header bool
+}
+
+func (w *csvWriter) Write(customer application.Customer) error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	c := toExportedCustomer(customer)
+	return errors.WithStack(w.writer.Write([]string{
+		c.ID, c.FirstName, c.LastName, c.Email, c.Phone, c.Status,
+		c.CreatedAt.Format(time.RFC3339), c.UpdatedAt.Format(time.RFC3339),
+	}))
+}
+
+// Close writes the header of an empty export as well.
+func (w *csvWriter) Close() error {
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.writer.Flush()
+	return errors.WithStack(w.writer.Error())
+}
+
+func (w *csvWriter) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return errors.WithStack(w.writer.Write(csvHeader))
+}
+
+type parquetWriter struct {
+	writer *parquet.GenericWriter[exportedCustomer]
+}
+
+func (w *parquetWriter) Write(customer application.Customer) error {
+	_, err := w.writer.Write([]exportedCustomer{toExportedCustomer(customer)})
+	return errors.WithStack(err)
+}
+
+func (w *parquetWriter) Close() error {
+	return errors.WithStack(w.writer.Close())
+}
@@ -0,0 +1,38 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+const (
+	BackendNone   = "none"
+	BackendMemory = "memory"
+	BackendRedis  = "redis"
+)
+
+type Config struct {
+	Backend  string        `envconfig:"CACHE_BACKEND" default:"memory"`
+	TTL      time.Duration `envconfig:"CACHE_TTL" default:"1m"`
+	Size     int           `envconfig:"CACHE_SIZE" default:"10000"` // max entries of the in-process cache
+	RedisURL string        `envconfig:"CACHE_REDIS_URL"`
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse cache environment config values")
+	}
+	switch config.Backend {
+	case BackendNone, BackendMemory:
+	case BackendRedis:
+		if config.RedisURL == "" {
+			return Config{}, errors.New("environment variable CACHE_REDIS_URL is not set")
+		}
+	default:
+		return Config{}, errors.Errorf("unknown cache backend: %s", config.Backend)
+	}
+	return config, nil
+}
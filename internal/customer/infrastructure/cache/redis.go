@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	redisKeyPrefix     = "customerservice:"
+	redisVersionPrefix = "customerservice:version:"
+	// redisVersionTTL keeps the version of an invalidated key far longer than any load of it may take.
+	redisVersionTTL = 24 * time.Hour
+)
+
+// RedisClient is the subset of the redis client used by the store.
+// Any server speaking the redis protocol will do, including an embedded one in tests.
+type RedisClient interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+	Watch(ctx context.Context, fn func(*redis.Tx) error, keys ...string) error
+	TxPipelined(ctx context.Context, fn func(redis.Pipeliner) error) ([]redis.Cmder, error)
+}
+
+// redisStore keeps the version of every key in a key of its own, which Set watches
+// so that a concurrent Delete aborts it.
+type redisStore struct {
+	client RedisClient
+}
+
+func NewRedisClient(url string) (*redis.Client, error) {
+	options, err := redis.ParseURL(url)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to parse redis URL")
+	}
+	return redis.NewClient(options), nil
+}
+
+func NewRedisStore(client RedisClient) Store {
+	return &redisStore{
+		client: client,
+	}
+}
+
+func (s *redisStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	value, err := s.client.Get(ctx, redisKeyPrefix+key).Bytes()
+	if err == redis.Nil {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, errors.WithStack(err)
+	}
+	return value, true, nil
+}
+
+func (s *redisStore) Version(ctx context.Context, key string) (int64, error) {
+	return redisVersion(ctx, s.client, key)
+}
+
+func (s *redisStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration, version int64) (bool, error) {
+	stored := false
+	err := s.client.Watch(ctx, func(tx *redis.Tx) error {
+		current, err := redisVersion(ctx, tx, key)
+		if err != nil || current != version {
+			return err
+		}
+		_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Set(ctx, redisKeyPrefix+key, value, ttl)
+			return nil
+		})
+		stored = err == nil
+		return err
+	}, redisVersionPrefix+key)
+	if err == redis.TxFailedErr {
+		return false, nil
+	}
+	return stored, errors.WithStack(err)
+}
+
+func (s *redisStore) Delete(ctx context.Context, key string) error {
+	_, err := s.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, redisVersionPrefix+key)
+		pipe.Expire(ctx, redisVersionPrefix+key, redisVersionTTL)
+		pipe.Del(ctx, redisKeyPrefix+key)
+		return nil
+	})
+	return errors.WithStack(err)
+}
+
+// redisReader is implemented by both the client and a transaction.
+type redisReader interface {
+	Get(ctx context.Context, key string) *redis.StringCmd
+}
+
+func redisVersion(ctx context.Context, client redisReader, key string) (int64, error) {
+	version, err := client.Get(ctx, redisVersionPrefix+key).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	return version, errors.WithStack(err)
+}
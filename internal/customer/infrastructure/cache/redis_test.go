@@ -0,0 +1,201 @@
+package cache
+
+import (
+	"context"
+	"io/ioutil"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/redis/go-redis/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func newTestRedisStore(t *testing.T) (*miniredis.Miniredis, Store) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { _ = client.Close() })
+	return server, NewRedisStore(client)
+}
+
+func TestRedisStore(t *testing.T) {
+	server, store := newTestRedisStore(t)
+	ctx := context.Background()
+
+	if _, ok, err := store.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("Get of missing key = %v, %v, want miss", ok, err)
+	}
+	version, err := store.Version(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Set(ctx, "a", []byte("1"), time.Minute, version); err != nil || !stored {
+		t.Fatalf("Set = %v, %v, want stored", stored, err)
+	}
+	if value, ok, err := store.Get(ctx, "a"); err != nil || !ok || string(value) != "1" {
+		t.Fatalf("Get = %q, %v, %v, want 1", value, ok, err)
+	}
+
+	if err := store.Delete(ctx, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, err := store.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("Get after Delete = %v, %v, want miss", ok, err)
+	}
+	if stored, err := store.Set(ctx, "a", []byte("stale"), time.Minute, version); err != nil || stored {
+		t.Fatalf("Set with version taken before Delete = %v, %v, want not stored", stored, err)
+	}
+	if server.Exists(redisKeyPrefix + "a") {
+		t.Fatal("stale value was stored")
+	}
+
+	version, err = store.Version(ctx, "a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, err := store.Set(ctx, "a", []byte("2"), time.Minute, version); err != nil || !stored {
+		t.Fatalf("Set with current version = %v, %v, want stored", stored, err)
+	}
+	server.FastForward(time.Minute + time.Second)
+	if _, ok, err := store.Get(ctx, "a"); err != nil || ok {
+		t.Fatalf("Get after TTL = %v, %v, want miss", ok, err)
+	}
+}
+
+// testRepository serves a single customer, FindByID blocks while loads is not nil.
+type testRepository struct {
+	application.Repository
+
+	mu       sync.Mutex
+	customer application.Customer
+	reads    int
+	loading  chan struct{}
+	loads    chan struct{}
+}
+
+func (r *testRepository) FindByID(_ context.Context, id application.CustomerID) (*application.Customer, error) {
+	r.mu.Lock()
+	r.reads++
+	customer := r.customer
+	loading, loads := r.loading, r.loads
+	r.mu.Unlock()
+	if loads != nil {
+		loading <- struct{}{}
+		<-loads
+	}
+	if customer.ID != id {
+		return nil, application.ErrCustomerNotFound
+	}
+	return &customer, nil
+}
+
+func (r *testRepository) Update(_ context.Context, customer application.Customer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.customer = customer
+	return nil
+}
+
+func newTestRepository(t *testing.T) (*miniredis.Miniredis, *testRepository, *Repository) {
+	t.Helper()
+	server, store := newTestRedisStore(t)
+	logger := logrus.New()
+	logger.SetOutput(ioutil.Discard)
+	repo := &testRepository{customer: application.Customer{
+		ID:        application.CustomerID(uuid.Generate()),
+		FirstName: "Ada",
+		Status:    application.StatusActive,
+	}}
+	return server, repo, NewRepository(repo, store, time.Minute, logger)
+}
+
+func TestRepositoryInvalidatesOnUpdate(t *testing.T) {
+	server, repo, cached := newTestRepository(t)
+	ctx := context.Background()
+	id := repo.customer.ID
+
+	for i := 0; i < 2; i++ {
+		customer, err := cached.FindByID(ctx, id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if customer.FirstName != "Ada" {
+			t.Fatalf("FirstName = %q, want Ada", customer.FirstName)
+		}
+	}
+	if repo.reads != 1 {
+		t.Fatalf("repository read %d times, want 1", repo.reads)
+	}
+	if !server.Exists(redisKeyPrefix + customerKeyPrefix + id.String()) {
+		t.Fatal("customer is not cached")
+	}
+
+	updated := repo.customer
+	updated.FirstName = "Grace"
+	if err := cached.Update(ctx, updated); err != nil {
+		t.Fatal(err)
+	}
+	customer, err := cached.FindByID(ctx, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if customer.FirstName != "Grace" || repo.reads != 2 {
+		t.Fatalf("after Update FirstName = %q with %d reads, want Grace with 2", customer.FirstName, repo.reads)
+	}
+}
+
+func TestRepositoryDropsFillRacingWithInvalidation(t *testing.T) {
+	server, repo, cached := newTestRepository(t)
+	ctx := context.Background()
+	id := repo.customer.ID
+	repo.loading, repo.loads = make(chan struct{}), make(chan struct{})
+
+	found := make(chan error, 1)
+	go func() {
+		_, err := cached.FindByID(ctx, id)
+		found <- err
+	}()
+	<-repo.loading
+	// the customer changes after it was read, but before the read is cached
+	cached.Invalidate(ctx, id)
+	close(repo.loads)
+	if err := <-found; err != nil {
+		t.Fatal(err)
+	}
+	if server.Exists(redisKeyPrefix + customerKeyPrefix + id.String()) {
+		t.Fatal("customer read before the invalidation was cached")
+	}
+}
+
+func TestRepositoryLoadOutlivesCaller(t *testing.T) {
+	server, repo, cached := newTestRepository(t)
+	id := repo.customer.ID
+	repo.loading, repo.loads = make(chan struct{}), make(chan struct{})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	found := make(chan error, 1)
+	go func() {
+		_, err := cached.FindByID(ctx, id)
+		found <- err
+	}()
+	<-repo.loading
+	cancel()
+	if err := <-found; err == nil {
+		t.Fatal("FindByID with canceled context succeeded")
+	}
+
+	// the load goes on after its only caller gave up
+	close(repo.loads)
+	deadline := time.Now().Add(5 * time.Second)
+	for !server.Exists(redisKeyPrefix + customerKeyPrefix + id.String()) {
+		if time.Now().After(deadline) {
+			t.Fatal("load was abandoned with its caller")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
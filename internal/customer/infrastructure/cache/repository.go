@@ -0,0 +1,243 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const (
+	customerKeyPrefix = "customer:"
+	// loadTimeout bounds a load of a missing customer, which outlives the callers that gave up waiting for it.
+	loadTimeout = 10 * time.Second
+)
+
+// Repository is a read-through cache of customers. Concurrent misses of the same customer
+// are collapsed into a single query. Failures of the store are logged and bypassed.
+type Repository struct {
+	repo   application.Repository
+	store  Store
+	ttl    time.Duration
+	logger logrus.FieldLogger
+	group  singleflight.Group
+}
+
+type cachedCustomer struct {
+	ID        string    `json:"id"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Attributes are missing from entries cached before the custom attributes were introduced.
+	Attributes        map[string]interface{} `json:"attributes,omitempty"`
+	IdentityMissingAt *time.Time             `json:"identityMissingAt,omitempty"`
+}
+
+func NewRepository(repo application.Repository, store Store, ttl time.Duration, logger logrus.FieldLogger) *Repository {
+	return &Repository{
+		repo:   repo,
+		store:  store,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+func (r *Repository) Add(ctx context.Context, customer application.Customer) error {
+	return r.repo.Add(ctx, customer)
+}
+
+func (r *Repository) FindByID(ctx context.Context, id application.CustomerID) (*application.Customer, error) {
+	key := customerKeyPrefix + id.String()
+	data, ok, err := r.store.Get(ctx, key)
+	if err != nil {
+		r.logger.WithError(err).Warn("failed to read customer from cache")
+	}
+	if !ok {
+		data, err = r.load(ctx, key, id)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return decodeCustomer(data)
+}
+
+// load reads the customer from the repository and caches it. The load is shared by every caller
+// missing the customer, so it runs detached from the context of the one that started it.
+// The version of the key is taken before the read: a change invalidating the customer meanwhile
+// keeps the stale read out of the cache.
+func (r *Repository) load(ctx context.Context, key string, id application.CustomerID) ([]byte, error) {
+	result := r.group.DoChan(key, func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), loadTimeout)
+		defer cancel()
+		version, versionErr := r.store.Version(ctx, key)
+		if versionErr != nil {
+			r.logger.WithError(versionErr).Warn("failed to read version of cached customer")
+		}
+		customer, err := r.repo.FindByID(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		// the shared result is serialized, so every caller decodes its own copy
+		data, err := encodeCustomer(*customer)
+		if err != nil {
+			return nil, err
+		}
+		if versionErr == nil {
+			if _, err := r.store.Set(ctx, key, data, r.ttl, version); err != nil {
+				r.logger.WithError(err).Warn("failed to write customer to cache")
+			}
+		}
+		return data, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, errors.WithStack(ctx.Err())
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return res.Val.([]byte), nil
+	}
+}
+
+func (r *Repository) Update(ctx context.Context, customer application.Customer) error {
+	if err := r.repo.Update(ctx, customer); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, customer.ID)
+	return nil
+}
+
+func (r *Repository) FindByEmail(ctx context.Context, email string) ([]application.Customer, error) {
+	return r.repo.FindByEmail(ctx, email)
+}
+
+func (r *Repository) List(ctx context.Context, after application.CustomerID, limit int) ([]application.Customer, error) {
+	return r.repo.List(ctx, after, limit)
+}
+
+func (r *Repository) FlagMissingIdentity(ctx context.Context, id application.CustomerID) error {
+	if err := r.repo.FlagMissingIdentity(ctx, id); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, id)
+	return nil
+}
+
+func (r *Repository) ClearMissingIdentity(ctx context.Context, id application.CustomerID) error {
+	if err := r.repo.ClearMissingIdentity(ctx, id); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, id)
+	return nil
+}
+
+func (r *Repository) Stream(ctx context.Context, filter application.CustomerFilter, handle func(customer application.Customer) error) error {
+	return r.repo.Stream(ctx, filter, handle)
+}
+
+func (r *Repository) UpdateStatus(ctx context.Context, customer application.Customer, change application.StatusChange) error {
+	if err := r.repo.UpdateStatus(ctx, customer, change); err != nil {
+		return err
+	}
+	r.Invalidate(ctx, customer.ID)
+	return nil
+}
+
+func (r *Repository) Merge(ctx context.Context, merge application.Merge) (*application.Customer, error) {
+	survivor, err := r.repo.Merge(ctx, merge)
+	if err != nil {
+		return nil, err
+	}
+	r.Invalidate(ctx, merge.MergedID)
+	r.Invalidate(ctx, merge.SurvivorID)
+	return survivor, nil
+}
+
+func (r *Repository) MergedInto(ctx context.Context, id application.CustomerID) (*application.CustomerID, error) {
+	return r.repo.MergedInto(ctx, id)
+}
+
+func (r *Repository) UpdateAttributes(ctx context.Context, id application.CustomerID, values map[string]interface{}, removed []string, updatedAt time.Time) (*application.Customer, error) {
+	customer, err := r.repo.UpdateAttributes(ctx, id, values, removed, updatedAt)
+	if err != nil {
+		return nil, err
+	}
+	r.Invalidate(ctx, id)
+	return customer, nil
+}
+
+func (r *Repository) FindByAttributes(ctx context.Context, values map[string]interface{}, after application.CustomerID, limit int) ([]application.Customer, error) {
+	return r.repo.FindByAttributes(ctx, values, after, limit)
+}
+
+func (r *Repository) Status(ctx context.Context, id application.CustomerID) (string, error) {
+	return r.repo.Status(ctx, id)
+}
+
+func (r *Repository) StatusHistory(ctx context.Context, id application.CustomerID) ([]application.StatusChange, error) {
+	return r.repo.StatusHistory(ctx, id)
+}
+
+// Invalidate removes the cached customer. Callers missing it afterwards do not join a load started before.
+func (r *Repository) Invalidate(ctx context.Context, id application.CustomerID) {
+	key := customerKeyPrefix + id.String()
+	r.group.Forget(key)
+	if err := r.store.Delete(ctx, key); err != nil {
+		r.logger.WithError(err).Warn("failed to invalidate cached customer")
+	}
+}
+
+// Handle invalidates the cached customer on every customer event.
+func (r *Repository) Handle(ctx context.Context, event application.Event) {
+	r.Invalidate(ctx, event.CustomerID())
+}
+
+func encodeCustomer(customer application.Customer) ([]byte, error) {
+	data, err := json.Marshal(cachedCustomer{
+		ID:                customer.ID.String(),
+		FirstName:         customer.FirstName,
+		LastName:          customer.LastName,
+		Email:             customer.Email,
+		Phone:             customer.Phone,
+		Status:            customer.Status,
+		CreatedAt:         customer.CreatedAt,
+		UpdatedAt:         customer.UpdatedAt,
+		Attributes:        customer.Attributes,
+		IdentityMissingAt: customer.IdentityMissingAt,
+	})
+	return data, errors.WithStack(err)
+}
+
+func decodeCustomer(data []byte) (*application.Customer, error) {
+	var cached cachedCustomer
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, errors.Wrap(err, "failed to decode cached customer")
+	}
+	id, err := uuid.FromString(cached.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode cached customer")
+	}
+	return &application.Customer{
+		ID:                application.CustomerID(id),
+		FirstName:         cached.FirstName,
+		LastName:          cached.LastName,
+		Email:             cached.Email,
+		Phone:             cached.Phone,
+		Status:            cached.Status,
+		CreatedAt:         cached.CreatedAt,
+		UpdatedAt:         cached.UpdatedAt,
+		Attributes:        cached.Attributes,
+		IdentityMissingAt: cached.IdentityMissingAt,
+	}, nil
+}
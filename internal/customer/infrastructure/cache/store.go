@@ -0,0 +1,17 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Store keeps serialized entries until their TTL expires. Deleting a key advances its version,
+// so that a value loaded before the key was invalidated is not stored after it.
+type Store interface {
+	Get(ctx context.Context, key string) ([]byte, bool, error)
+	// Version returns the current version of the key, to be passed to Set along with the value loaded after it.
+	Version(ctx context.Context, key string) (int64, error)
+	// Set stores the value unless the key was deleted since Version returned the version, and reports whether it did.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration, version int64) (bool, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,48 @@
+package duplicate
+
+import (
+	"regexp"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+var countryCodePattern = regexp.MustCompile(`^[1-9]\d{0,2}$`)
+
+type Config struct {
+	// FlagThreshold is the score from which a candidate is flagged as a likely duplicate.
+	FlagThreshold float64 `envconfig:"DUPLICATE_FLAG_THRESHOLD" default:"0.75"`
+	// ReportThreshold is the lowest score of a candidate that is kept for the report.
+	ReportThreshold float64 `envconfig:"DUPLICATE_REPORT_THRESHOLD" default:"0.5"`
+	// PhoneCountryCode is the calling code of phone numbers entered without one, e.g. 49.
+	PhoneCountryCode string `envconfig:"DUPLICATE_PHONE_COUNTRY_CODE"`
+	MaxCandidates    int    `envconfig:"DUPLICATE_MAX_CANDIDATES" default:"100"` // customers scored against one customer
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse duplicate detection environment config values")
+	}
+	if config.ReportThreshold <= 0 || config.ReportThreshold > config.FlagThreshold || config.FlagThreshold > 1 {
+		return Config{}, errors.New("DUPLICATE_REPORT_THRESHOLD and DUPLICATE_FLAG_THRESHOLD must satisfy 0 < report <= flag <= 1")
+	}
+	if config.PhoneCountryCode != "" && !countryCodePattern.MatchString(config.PhoneCountryCode) {
+		return Config{}, errors.Errorf("invalid DUPLICATE_PHONE_COUNTRY_CODE: %s", config.PhoneCountryCode)
+	}
+	if config.MaxCandidates <= 0 {
+		return Config{}, errors.New("DUPLICATE_MAX_CANDIDATES must be positive")
+	}
+	return config, nil
+}
+
+func (c Config) Settings() application.DuplicateSettings {
+	return application.DuplicateSettings{
+		FlagThreshold:    c.FlagThreshold,
+		ReportThreshold:  c.ReportThreshold,
+		PhoneCountryCode: c.PhoneCountryCode,
+		MaxCandidates:    c.MaxCandidates,
+	}
+}
@@ -0,0 +1,223 @@
+package identity
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sony/gobreaker"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const tracerName = "github.com/jnikolaeva/customerservice/internal/customer/infrastructure/identity"
+
+type requestFactory func(ctx context.Context) (*http.Request, error)
+
+type responseHandler func(r *http.Response) error
+
+// client sends requests to the identity provider through a circuit breaker.
+// Idempotent requests are retried on transient failures with jittered exponential backoff.
+type client struct {
+	httpClient *http.Client
+	breaker    *gobreaker.TwoStepCircuitBreaker
+	backoff    *backoff
+	timeout    time.Duration
+	maxRetries int
+	metrics    *Metrics
+}
+
+type transientError struct {
+	err error
+}
+
+func (e transientError) Error() string {
+	return e.err.Error()
+}
+
+func (e transientError) Unwrap() error {
+	return e.err
+}
+
+func newClient(config Config, metrics *Metrics) *client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConnsPerHost = 10
+
+	breaker := gobreaker.NewTwoStepCircuitBreaker(gobreaker.Settings{
+		Name:        "identity-provider",
+		MaxRequests: 1,
+		Timeout:     config.BreakerOpenTimeout,
+		ReadyToTrip: func(counts gobreaker.Counts) bool {
+			return counts.ConsecutiveFailures >= config.BreakerMaxFailures
+		},
+	})
+
+	return &client{
+		httpClient: &http.Client{Transport: otelhttp.NewTransport(transport)},
+		breaker:    breaker,
+		backoff:    newBackoff(config.RetryBaseDelay, config.RetryMaxDelay),
+		timeout:    config.Timeout,
+		maxRetries: config.MaxRetries,
+		metrics:    metrics,
+	}
+}
+
+func (c *client) do(ctx context.Context, operation string, idempotent bool, newRequest requestFactory, handle responseHandler) (err error) {
+	ctx, span := otel.Tracer(tracerName).Start(ctx, "IdentityProvider."+operation)
+	defer func() {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+	}()
+
+	start := time.Now()
+	attempts := 1
+	if idempotent {
+		attempts += c.maxRetries
+	}
+
+	for attempt := 0; attempt < attempts; attempt++ {
+		if attempt > 0 {
+			if waitErr := c.backoff.wait(ctx, attempt); waitErr != nil {
+				err = errors.WithStack(waitErr)
+				break
+			}
+		}
+		span.SetAttributes(attribute.Int("idp.attempts", attempt+1))
+		err = c.attempt(ctx, newRequest, handle)
+		if _, ok := err.(transientError); !ok {
+			break
+		}
+	}
+
+	switch {
+	case err == nil:
+		c.metrics.observe(operation, outcomeSuccess, start)
+	case errors.Is(err, application.ErrIdentityProviderUnavailable):
+		c.metrics.observe(operation, outcomeRejected, start)
+	default:
+		c.metrics.observe(operation, outcomeError, start)
+	}
+
+	if _, ok := err.(transientError); ok {
+		return errors.Wrap(application.ErrIdentityProviderUnavailable, err.Error())
+	}
+	return err
+}
+
+func (c *client) attempt(ctx context.Context, newRequest requestFactory, handle responseHandler) error {
+	done, err := c.breaker.Allow()
+	if err != nil {
+		return errors.Wrap(application.ErrIdentityProviderUnavailable, err.Error())
+	}
+
+	attemptCtx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	req, err := newRequest(attemptCtx)
+	if err != nil {
+		done(true)
+		return err
+	}
+	r, err := c.httpClient.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// the caller gave up, it says nothing about the identity provider health
+			done(true)
+			return errors.WithStack(ctx.Err())
+		}
+		done(false)
+		return transientError{err: errors.Wrap(err, "identity provider request failed")}
+	}
+	defer drainAndClose(r.Body)
+
+	if r.StatusCode >= http.StatusInternalServerError || r.StatusCode == http.StatusTooManyRequests {
+		done(false)
+		return transientError{err: errors.Errorf("identity provider responded with status code: %d", r.StatusCode)}
+	}
+	done(true)
+	return handle(r)
+}
+
+func drainAndClose(body io.ReadCloser) {
+	_, _ = io.Copy(ioutil.Discard, io.LimitReader(body, 64*1024))
+	_ = body.Close()
+}
+
+type backoff struct {
+	baseDelay time.Duration
+	maxDelay  time.Duration
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+func newBackoff(baseDelay, maxDelay time.Duration) *backoff {
+	return &backoff{
+		baseDelay: baseDelay,
+		maxDelay:  maxDelay,
+		rnd:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// delay returns a random duration up to the exponentially growing cap ("full jitter").
+func (b *backoff) delay(attempt int) time.Duration {
+	ceiling := b.baseDelay << uint(attempt-1)
+	if ceiling > b.maxDelay || ceiling <= 0 {
+		ceiling = b.maxDelay
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return time.Duration(b.rnd.Int63n(int64(ceiling) + 1))
+}
+
+func (b *backoff) wait(ctx context.Context, attempt int) error {
+	timer := time.NewTimer(b.delay(attempt))
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// prober checks whether the identity provider is reachable for the readiness probe. It bypasses the
+// circuit breaker and the metrics of client: probes neither trip the breaker nor are refused by it.
+type prober struct {
+	httpClient *http.Client
+}
+
+func newProber(config Config) *prober {
+	return &prober{
+		httpClient: &http.Client{Timeout: config.Timeout},
+	}
+}
+
+// ping treats any response without a server error as reachable. Probes are not retried.
+func (p *prober) ping(ctx context.Context, pingURL string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pingURL, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	r, err := p.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(application.ErrIdentityProviderUnavailable, err.Error())
+	}
+	defer drainAndClose(r.Body)
+	if r.StatusCode >= http.StatusInternalServerError {
+		return errors.Wrapf(application.ErrIdentityProviderUnavailable, "identity provider responded with status code: %d", r.StatusCode)
+	}
+	return nil
+}
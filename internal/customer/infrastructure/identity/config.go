@@ -0,0 +1,63 @@
+package identity
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+const (
+	BackendREST     = "rest"     // custom /users REST API
+	BackendKeycloak = "keycloak" // Keycloak-compatible admin REST API
+	BackendLocal    = "local"    // built-in credential store
+)
+
+type Config struct {
+	Backend            string        `envconfig:"IDP_BACKEND" default:"rest"`
+	URL                string        `envconfig:"IDP_URL"`
+	Timeout            time.Duration `envconfig:"IDP_TIMEOUT" default:"5s"`    // timeout of a single attempt
+	MaxRetries         int           `envconfig:"IDP_MAX_RETRIES" default:"3"` // retries of idempotent calls
+	RetryBaseDelay     time.Duration `envconfig:"IDP_RETRY_BASE_DELAY" default:"100ms"`
+	RetryMaxDelay      time.Duration `envconfig:"IDP_RETRY_MAX_DELAY" default:"2s"`
+	BreakerMaxFailures uint32        `envconfig:"IDP_BREAKER_MAX_FAILURES" default:"5"` // consecutive failures to open the circuit
+	BreakerOpenTimeout time.Duration `envconfig:"IDP_BREAKER_OPEN_TIMEOUT" default:"30s"`
+
+	Keycloak KeycloakConfig
+	Local    LocalConfig
+}
+
+type KeycloakConfig struct {
+	Realm        string `envconfig:"IDP_KEYCLOAK_REALM"`
+	ClientID     string `envconfig:"IDP_KEYCLOAK_CLIENT_ID"`
+	ClientSecret string `envconfig:"IDP_KEYCLOAK_CLIENT_SECRET"`
+}
+
+type LocalConfig struct {
+	Hasher            string `envconfig:"IDP_LOCAL_HASHER" default:"bcrypt"` // bcrypt or argon2
+	MinPasswordLength int    `envconfig:"IDP_LOCAL_MIN_PASSWORD_LENGTH" default:"8"`
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse identity provider environment config values")
+	}
+	switch config.Backend {
+	case BackendREST:
+		if config.URL == "" {
+			return Config{}, errors.New("environment variable IDP_URL is not set")
+		}
+	case BackendKeycloak:
+		if config.URL == "" || config.Keycloak.Realm == "" || config.Keycloak.ClientID == "" {
+			return Config{}, errors.New("environment variables IDP_URL, IDP_KEYCLOAK_REALM and IDP_KEYCLOAK_CLIENT_ID are required for keycloak identity provider")
+		}
+	case BackendLocal:
+		if config.Local.Hasher != hasherBcrypt && config.Local.Hasher != hasherArgon2 {
+			return Config{}, errors.Errorf("unknown password hasher: %s", config.Local.Hasher)
+		}
+	default:
+		return Config{}, errors.Errorf("unknown identity provider backend: %s", config.Backend)
+	}
+	return config, nil
+}
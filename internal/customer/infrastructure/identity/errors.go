@@ -0,0 +1,60 @@
+package identity
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/logging"
+)
+
+type errorResponse struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+// parseRegisterError converts a rejected registration into an application error.
+// Responses that cannot be recognized are reported with the status code only.
+func parseRegisterError(r *http.Response, logger logrus.FieldLogger) error {
+	var response errorResponse
+	_ = json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&response)
+
+	switch {
+	case r.StatusCode == http.StatusConflict:
+		return logProviderMessage(r, logger, application.ErrUsernameTaken, response.Message)
+	case r.StatusCode == http.StatusUnprocessableEntity,
+		r.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(response.Message), "password"):
+		return logProviderMessage(r, logger, application.ErrWeakPassword, response.Message)
+	default:
+		return errors.WithStack(errors.Errorf("identity provider failed to register user with status code: %d", r.StatusCode))
+	}
+}
+
+// parseExistsResponse sets exists from the response to a request of a single user.
+func parseExistsResponse(r *http.Response, exists *bool) error {
+	switch r.StatusCode {
+	case http.StatusOK:
+		*exists = true
+		return nil
+	case http.StatusNotFound:
+		*exists = false
+		return nil
+	default:
+		return errors.WithStack(errors.Errorf("identity provider failed to get user with status code: %d", r.StatusCode))
+	}
+}
+
+// logProviderMessage logs the message of the identity provider and returns err alone:
+// the wording of the provider is not ours to show to clients and may change with its version.
+func logProviderMessage(r *http.Response, logger logrus.FieldLogger, err error, message string) error {
+	if message != "" {
+		logging.FromContext(r.Request.Context(), logger).WithError(err).
+			WithField("provider_message", message).Info("identity provider rejected registration")
+	}
+	return err
+}
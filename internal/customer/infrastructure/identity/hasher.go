@@ -0,0 +1,56 @@
+package identity
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	hasherBcrypt = "bcrypt"
+	hasherArgon2 = "argon2"
+
+	argon2Time    = 1
+	argon2Memory  = 64 * 1024
+	argon2Threads = 4
+	argon2KeyLen  = 32
+	argon2SaltLen = 16
+)
+
+type passwordHasher interface {
+	Hash(password string) (string, error)
+}
+
+func newPasswordHasher(name string) passwordHasher {
+	if name == hasherArgon2 {
+		return argon2Hasher{}
+	}
+	return bcryptHasher{}
+}
+
+type bcryptHasher struct{}
+
+func (bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(hash), nil
+}
+
+// argon2Hasher encodes hashes in the PHC string format: $argon2id$v=19$m=65536,t=1,p=4$<salt>$<key>
+type argon2Hasher struct{}
+
+func (argon2Hasher) Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", errors.WithStack(err)
+	}
+	key := argon2.IDKey([]byte(password), salt, argon2Time, argon2Memory, argon2Threads, argon2KeyLen)
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argon2Memory, argon2Time, argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key)), nil
+}
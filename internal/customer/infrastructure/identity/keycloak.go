@@ -0,0 +1,347 @@
+package identity
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"golang.org/x/sync/singleflight"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+// tokenExpiryMargin renews the access token slightly before the identity provider rejects it.
+const tokenExpiryMargin = 30 * time.Second
+
+// KeycloakProvider manages users through the Keycloak admin REST API,
+// authenticating itself with the client credentials grant.
+type KeycloakProvider struct {
+	baseURL      string
+	realm        string
+	clientID     string
+	clientSecret string
+	client       *client
+	prober       *prober
+	logger       logrus.FieldLogger
+	refreshes    singleflight.Group
+
+	mu          sync.Mutex
+	accessToken string
+	expiresAt   time.Time
+}
+
+type keycloakCredential struct {
+	Type      string `json:"type"`
+	Value     string `json:"value"`
+	Temporary bool   `json:"temporary"`
+}
+
+type keycloakUser struct {
+	Username    string               `json:"username"`
+	Enabled     bool                 `json:"enabled"`
+	Credentials []keycloakCredential `json:"credentials"`
+}
+
+type keycloakTokenResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+}
+
+type keycloakErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+	ErrorMessage     string `json:"errorMessage"`
+}
+
+func NewKeycloakProvider(config Config, metrics *Metrics, logger logrus.FieldLogger) *KeycloakProvider {
+	return &KeycloakProvider{
+		baseURL:      strings.TrimSuffix(config.URL, "/"),
+		realm:        config.Keycloak.Realm,
+		clientID:     config.Keycloak.ClientID,
+		clientSecret: config.Keycloak.ClientSecret,
+		client:       newClient(config, metrics),
+		prober:       newProber(config),
+		logger:       logger,
+	}
+}
+
+func (p *KeycloakProvider) Register(ctx context.Context, username, password string) (uuid.UUID, error) {
+	data, err := json.Marshal(&keycloakUser{
+		Username:    username,
+		Enabled:     true,
+		Credentials: []keycloakCredential{{Type: "password", Value: password}},
+	})
+	if err != nil {
+		return uuid.UUID{}, errors.Wrap(err, "failed to register user")
+	}
+
+	var location string
+	err = p.adminCall(ctx, "register", false, http.MethodPost, p.usersURL(), data, func(r *http.Response) error {
+		if r.StatusCode != http.StatusCreated {
+			return parseKeycloakRegisterError(r, p.logger)
+		}
+		location = r.Header.Get("Location")
+		return nil
+	})
+	if err != nil {
+		return uuid.UUID{}, err
+	}
+
+	id, err := uuid.FromString(path.Base(location))
+	if err != nil {
+		return uuid.UUID{}, errors.Wrapf(err, "failed to convert user location from identity provider: %v", location)
+	}
+	return id, nil
+}
+
+func (p *KeycloakProvider) Delete(ctx context.Context, userID uuid.UUID) error {
+	return p.adminCall(ctx, "delete", true, http.MethodDelete, p.usersURL()+"/"+userID.String(), nil, func(r *http.Response) error {
+		if r.StatusCode != http.StatusNoContent && r.StatusCode != http.StatusNotFound {
+			return errors.WithStack(errors.Errorf("identity provider failed to delete user with status code: %d", r.StatusCode))
+		}
+		return nil
+	})
+}
+
+func (p *KeycloakProvider) IdentityExists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	exists := false
+	err := p.adminCall(ctx, "get", true, http.MethodGet, p.usersURL()+"/"+userID.String(), nil, func(r *http.Response) error {
+		return parseExistsResponse(r, &exists)
+	})
+	return exists, err
+}
+
+// ListIdentities pages through the realm users in brief representation. Keycloak orders them by username
+// and pages by position only, so the cursor holds the position and the ID of the last user listed.
+// When users before it were added or deleted since, the next page starts where that user is found now,
+// looking up to a page back and forth; a user listed twice is harmless to the caller.
+func (p *KeycloakProvider) ListIdentities(ctx context.Context, cursor string, limit int) ([]uuid.UUID, string, error) {
+	if cursor == "" {
+		users, err := p.listUsers(ctx, 0, limit)
+		if err != nil {
+			return nil, "", err
+		}
+		return keycloakPage(users, 0, limit)
+	}
+	position, anchor, err := parseKeycloakCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// the last user is read again to check that it did not move
+	users, err := p.listUsers(ctx, position, limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(users) > 0 && users[0].ID == anchor {
+		return keycloakPage(users[1:], position+1, limit)
+	}
+
+	start := position - limit
+	if start < 0 {
+		start = 0
+	}
+	users, err = p.listUsers(ctx, start, 2*limit+1)
+	if err != nil {
+		return nil, "", err
+	}
+	for i, user := range users {
+		if user.ID == anchor {
+			return keycloakPage(users[i+1:], start+i+1, limit)
+		}
+	}
+	// the last user was deleted or moved further: the page starts before it rather than after
+	return keycloakPage(users, start, limit)
+}
+
+func (p *KeycloakProvider) listUsers(ctx context.Context, first, size int) ([]userResponse, error) {
+	listURL := p.usersURL() + "?" + url.Values{
+		"first":               {strconv.Itoa(first)},
+		"max":                 {strconv.Itoa(size)},
+		"briefRepresentation": {"true"},
+	}.Encode()
+	var users []userResponse
+	err := p.adminCall(ctx, "list", true, http.MethodGet, listURL, nil, func(r *http.Response) error {
+		if r.StatusCode != http.StatusOK {
+			return errors.WithStack(errors.Errorf("identity provider failed to list users with status code: %d", r.StatusCode))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&users); err != nil {
+			return errors.Wrap(err, "failed to decode response from identity provider")
+		}
+		return nil
+	})
+	return users, err
+}
+
+// keycloakPage returns up to limit of the users starting at the position, with the cursor of the next page.
+func keycloakPage(users []userResponse, position, limit int) ([]uuid.UUID, string, error) {
+	if len(users) > limit {
+		users = users[:limit]
+	}
+	ids, err := toUserIDs(users)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(users) < limit || len(users) == 0 {
+		return ids, "", nil
+	}
+	last := len(users) - 1
+	return ids, strconv.Itoa(position+last) + ":" + users[last].ID, nil
+}
+
+func parseKeycloakCursor(cursor string) (int, string, error) {
+	parts := strings.SplitN(cursor, ":", 2)
+	if len(parts) != 2 {
+		return 0, "", errors.Errorf("invalid cursor: %s", cursor)
+	}
+	position, err := strconv.Atoi(parts[0])
+	if err != nil || position < 0 {
+		return 0, "", errors.Errorf("invalid cursor: %s", cursor)
+	}
+	return position, parts[1], nil
+}
+
+// adminCall sends an authorized admin API request. A rejected token is renewed once.
+func (p *KeycloakProvider) adminCall(ctx context.Context, operation string, idempotent bool, method, callURL string, body []byte, handle responseHandler) error {
+	for attempt := 0; ; attempt++ {
+		token, err := p.token(ctx)
+		if err != nil {
+			return err
+		}
+		unauthorized := false
+		err = p.client.do(ctx, operation, idempotent, func(ctx context.Context) (*http.Request, error) {
+			var reader io.Reader
+			if body != nil {
+				reader = bytes.NewReader(body)
+			}
+			req, err := http.NewRequestWithContext(ctx, method, callURL, reader)
+			if err != nil {
+				return nil, err
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			if body != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			return req, nil
+		}, func(r *http.Response) error {
+			if r.StatusCode == http.StatusUnauthorized {
+				unauthorized = true
+				return errors.New("identity provider rejected access token")
+			}
+			return handle(r)
+		})
+		if unauthorized && attempt == 0 {
+			p.invalidateToken(token)
+			continue
+		}
+		return err
+	}
+}
+
+// token returns the cached access token or requests a new one. Concurrent callers share a single
+// request, which runs without the lock and is not cancelled when the caller that started it gives up.
+func (p *KeycloakProvider) token(ctx context.Context) (string, error) {
+	p.mu.Lock()
+	if p.accessToken != "" && time.Now().Before(p.expiresAt) {
+		token := p.accessToken
+		p.mu.Unlock()
+		return token, nil
+	}
+	p.mu.Unlock()
+
+	result := p.refreshes.DoChan("token", func() (interface{}, error) {
+		return p.requestToken(context.WithoutCancel(ctx))
+	})
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return "", res.Err
+		}
+		return res.Val.(string), nil
+	}
+}
+
+func (p *KeycloakProvider) requestToken(ctx context.Context) (string, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {p.clientID},
+		"client_secret": {p.clientSecret},
+	}.Encode()
+	tokenURL := p.baseURL + "/realms/" + url.PathEscape(p.realm) + "/protocol/openid-connect/token"
+
+	var response keycloakTokenResponse
+	err := p.client.do(ctx, "token", true, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, tokenURL, strings.NewReader(form))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return req, nil
+	}, func(r *http.Response) error {
+		if r.StatusCode != http.StatusOK {
+			return errors.WithStack(errors.Errorf("identity provider failed to issue access token with status code: %d", r.StatusCode))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&response); err != nil {
+			return errors.Wrap(err, "failed to decode token response from identity provider")
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.accessToken = response.AccessToken
+	p.expiresAt = time.Now().Add(time.Duration(response.ExpiresIn)*time.Second - tokenExpiryMargin)
+	return p.accessToken, nil
+}
+
+func (p *KeycloakProvider) invalidateToken(token string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.accessToken == token {
+		p.accessToken = ""
+	}
+}
+
+func (p *KeycloakProvider) usersURL() string {
+	return p.baseURL + "/admin/realms/" + url.PathEscape(p.realm) + "/users"
+}
+
+func parseKeycloakRegisterError(r *http.Response, logger logrus.FieldLogger) error {
+	var response keycloakErrorResponse
+	_ = json.NewDecoder(io.LimitReader(r.Body, 64*1024)).Decode(&response)
+	message := response.ErrorMessage
+	if message == "" {
+		message = response.ErrorDescription
+	}
+
+	switch {
+	case r.StatusCode == http.StatusConflict:
+		return logProviderMessage(r, logger, application.ErrUsernameTaken, message)
+	case r.StatusCode == http.StatusBadRequest && strings.HasPrefix(response.Error, "invalidPassword"),
+		r.StatusCode == http.StatusBadRequest && strings.Contains(strings.ToLower(message), "password"):
+		return logProviderMessage(r, logger, application.ErrWeakPassword, message)
+	default:
+		return errors.WithStack(errors.Errorf("identity provider failed to register user with status code: %d", r.StatusCode))
+	}
+}
+
+// Ping requests the public realm description, which needs no access token.
+func (p *KeycloakProvider) Ping(ctx context.Context) error {
+	return p.prober.ping(ctx, p.baseURL+"/realms/"+url.PathEscape(p.realm))
+}
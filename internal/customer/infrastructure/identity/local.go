@@ -0,0 +1,85 @@
+package identity
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+type Credentials struct {
+	UserID       uuid.UUID
+	Username     string
+	PasswordHash string
+}
+
+// CredentialStore persists credentials of the local identity provider.
+// Add must return application.ErrUsernameTaken when the username is already registered.
+type CredentialStore interface {
+	Add(ctx context.Context, credentials Credentials) error
+	Delete(ctx context.Context, userID uuid.UUID) error
+	Exists(ctx context.Context, userID uuid.UUID) (bool, error)
+	// ListUserIDs returns up to limit user IDs greater than after, in order.
+	ListUserIDs(ctx context.Context, after uuid.UUID, limit int) ([]uuid.UUID, error)
+}
+
+// LocalProvider keeps credentials next to the customers, for deployments without a dedicated identity provider.
+type LocalProvider struct {
+	store             CredentialStore
+	hasher            passwordHasher
+	minPasswordLength int
+}
+
+func NewLocalProvider(config LocalConfig, store CredentialStore) *LocalProvider {
+	return &LocalProvider{
+		store:             store,
+		hasher:            newPasswordHasher(config.Hasher),
+		minPasswordLength: config.MinPasswordLength,
+	}
+}
+
+func (p *LocalProvider) Register(ctx context.Context, username, password string) (uuid.UUID, error) {
+	if utf8.RuneCountInString(password) < p.minPasswordLength {
+		return uuid.UUID{}, errors.WithMessagef(application.ErrWeakPassword, "password must be at least %d characters long", p.minPasswordLength)
+	}
+	hash, err := p.hasher.Hash(password)
+	if err != nil {
+		return uuid.UUID{}, errors.Wrap(err, "failed to hash password")
+	}
+	credentials := Credentials{
+		UserID:       uuid.Generate(),
+		Username:     username,
+		PasswordHash: hash,
+	}
+	if err := p.store.Add(ctx, credentials); err != nil {
+		return uuid.UUID{}, err
+	}
+	return credentials.UserID, nil
+}
+
+func (p *LocalProvider) Delete(ctx context.Context, userID uuid.UUID) error {
+	return p.store.Delete(ctx, userID)
+}
+
+func (p *LocalProvider) IdentityExists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	return p.store.Exists(ctx, userID)
+}
+
+// ListIdentities pages by user ID, the cursor is the last ID of the previous page.
+func (p *LocalProvider) ListIdentities(ctx context.Context, cursor string, limit int) ([]uuid.UUID, string, error) {
+	var after uuid.UUID
+	if cursor != "" {
+		var err error
+		if after, err = uuid.FromString(cursor); err != nil {
+			return nil, "", errors.Wrapf(err, "invalid cursor: %s", cursor)
+		}
+	}
+	ids, err := p.store.ListUserIDs(ctx, after, limit)
+	if err != nil {
+		return nil, "", err
+	}
+	return ids, nextIDCursor(ids, limit), nil
+}
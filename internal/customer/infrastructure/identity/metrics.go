@@ -0,0 +1,33 @@
+package identity
+
+import (
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+)
+
+const (
+	outcomeSuccess  = "success"
+	outcomeError    = "error"
+	outcomeRejected = "rejected"
+)
+
+type Metrics struct {
+	RequestCount   metrics.Counter
+	RequestLatency metrics.Histogram
+}
+
+func NewMetrics(counter metrics.Counter, latency metrics.Histogram) *Metrics {
+	return &Metrics{
+		RequestCount:   counter,
+		RequestLatency: latency,
+	}
+}
+
+func (m *Metrics) observe(operation, outcome string, start time.Time) {
+	if m == nil {
+		return
+	}
+	m.RequestCount.With("operation", operation, "outcome", outcome).Add(1)
+	m.RequestLatency.With("operation", operation).Observe(time.Since(start).Seconds())
+}
@@ -2,17 +2,22 @@ package identity
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"net/http"
-	"time"
+	"net/url"
+	"strconv"
 
 	"github.com/jnikolaeva/eshop-common/uuid"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 )
 
 type Proxy struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL string
+	client  *client
+	prober  *prober
+	logger  logrus.FieldLogger
 }
 
 type registerUserRequest struct {
@@ -24,37 +29,48 @@ type userResponse struct {
 	ID string `json:"id"`
 }
 
-func NewProviderProxy(baseURL string) *Proxy {
-	client := http.DefaultClient
-	client.Timeout = 20 * time.Second
+func NewProviderProxy(config Config, metrics *Metrics, logger logrus.FieldLogger) *Proxy {
 	return &Proxy{
-		baseURL:    baseURL,
-		httpClient: client,
+		baseURL: config.URL,
+		client:  newClient(config, metrics),
+		prober:  newProber(config),
+		logger:  logger,
 	}
 }
 
-func (p *Proxy) Register(username, password string) (uuid.UUID, error) {
+func (p *Proxy) Register(ctx context.Context, username, password string) (uuid.UUID, error) {
 	registerURL := p.baseURL + "/users"
 	request := &registerUserRequest{
 		Username: username,
 		Password: password,
 	}
-	data := new(bytes.Buffer)
-	if err := json.NewEncoder(data).Encode(request); err != nil {
-		return uuid.UUID{}, errors.Wrap(err, "failed to register user")
-	}
-	r, err := p.httpClient.Post(registerURL, "application/json", data)
+	data, err := json.Marshal(request)
 	if err != nil {
-		return uuid.UUID{}, errors.Wrap(err, "identity provider failed to register user")
-	}
-	if r.StatusCode != http.StatusOK {
-		return uuid.UUID{}, errors.WithStack(errors.Errorf("identity provider failed to register user with status code: %d", r.StatusCode))
+		return uuid.UUID{}, errors.Wrap(err, "failed to register user")
 	}
-	defer r.Body.Close()
+
 	var user userResponse
-	if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
-		return uuid.UUID{}, errors.Wrap(err, "failed to decode response from identity provider")
+	// registration is not idempotent, so it is never retried
+	err = p.client.do(ctx, "register", false, func(ctx context.Context) (*http.Request, error) {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, registerURL, bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		return req, nil
+	}, func(r *http.Response) error {
+		if r.StatusCode != http.StatusOK {
+			return parseRegisterError(r, p.logger)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&user); err != nil {
+			return errors.Wrap(err, "failed to decode response from identity provider")
+		}
+		return nil
+	})
+	if err != nil {
+		return uuid.UUID{}, err
 	}
+
 	id, err := uuid.FromString(user.ID)
 	if err != nil {
 		return uuid.UUID{}, errors.Wrapf(err, "failed to convert user id from identity provider: %v", user.ID)
@@ -62,18 +78,82 @@ func (p *Proxy) Register(username, password string) (uuid.UUID, error) {
 	return id, nil
 }
 
-func (p *Proxy) Delete(userID uuid.UUID) error {
+func (p *Proxy) Delete(ctx context.Context, userID uuid.UUID) error {
 	deleteURL := p.baseURL + "/users/" + userID.String()
-	req, err := http.NewRequest(http.MethodDelete, deleteURL, nil)
+	return p.client.do(ctx, "delete", true, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodDelete, deleteURL, nil)
+	}, func(r *http.Response) error {
+		// a repeated delete may find the user already gone
+		if r.StatusCode != http.StatusNoContent && r.StatusCode != http.StatusNotFound {
+			return errors.WithStack(errors.Errorf("identity provider failed to delete user with status code: %d", r.StatusCode))
+		}
+		return nil
+	})
+}
+
+// IdentityExists requests GET /users/{id}, which responds with 404 Not Found for an unknown user.
+func (p *Proxy) IdentityExists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	userURL := p.baseURL + "/users/" + userID.String()
+	exists := false
+	err := p.client.do(ctx, "get", true, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, userURL, nil)
+	}, func(r *http.Response) error {
+		return parseExistsResponse(r, &exists)
+	})
+	return exists, err
+}
+
+// ListIdentities pages through GET /users?after=&limit=, which returns a JSON array of the users ordered by ID
+// after the given one. The cursor is the last ID of the previous page.
+func (p *Proxy) ListIdentities(ctx context.Context, cursor string, limit int) ([]uuid.UUID, string, error) {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if cursor != "" {
+		query.Set("after", cursor)
+	}
+	listURL := p.baseURL + "/users?" + query.Encode()
+	var users []userResponse
+	err := p.client.do(ctx, "list", true, func(ctx context.Context) (*http.Request, error) {
+		return http.NewRequestWithContext(ctx, http.MethodGet, listURL, nil)
+	}, func(r *http.Response) error {
+		if r.StatusCode != http.StatusOK {
+			return errors.WithStack(errors.Errorf("identity provider failed to list users with status code: %d", r.StatusCode))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&users); err != nil {
+			return errors.Wrap(err, "failed to decode response from identity provider")
+		}
+		return nil
+	})
 	if err != nil {
-		return err
+		return nil, "", err
 	}
-	r, err := p.httpClient.Do(req)
+	ids, err := toUserIDs(users)
 	if err != nil {
-		return errors.Wrap(err, "failed to delete user")
+		return nil, "", err
 	}
-	if r.StatusCode != http.StatusNoContent {
-		return errors.WithStack(errors.Errorf("identity provider failed to delete user with status code: %d", r.StatusCode))
+	return ids, nextIDCursor(ids, limit), nil
+}
+
+// Ping reports whether the identity provider responds at all.
+func (p *Proxy) Ping(ctx context.Context) error {
+	return p.prober.ping(ctx, p.baseURL)
+}
+
+// nextIDCursor returns the last ID of a full page, there is no next page after a shorter one.
+func nextIDCursor(ids []uuid.UUID, limit int) string {
+	if len(ids) < limit || len(ids) == 0 {
+		return ""
+	}
+	return ids[len(ids)-1].String()
+}
+
+func toUserIDs(users []userResponse) ([]uuid.UUID, error) {
+	ids := make([]uuid.UUID, 0, len(users))
+	for _, user := range users {
+		id, err := uuid.FromString(user.ID)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to convert user id from identity provider: %v", user.ID)
+		}
+		ids = append(ids, id)
 	}
-	return nil
+	return ids, nil
 }
@@ -0,0 +1,137 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const attributeDefinitionColumns = "name, type, description, visibility, searchable, validation, created_at, updated_at"
+
+type attributeRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewAttributeRepository(connPool *pgx.ConnPool) application.AttributeRepository {
+	return &attributeRepository{
+		connPool: connPool,
+	}
+}
+
+// attributeValidation is the JSON form of application.AttributeValidation.
+type attributeValidation struct {
+	Pattern   string   `json:"pattern,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	Values    []string `json:"values,omitempty"`
+}
+
+func (r *attributeRepository) Definitions(ctx context.Context) ([]application.AttributeDefinition, error) {
+	query := "SELECT " + attributeDefinitionColumns + " FROM attribute_definitions ORDER BY name"
+	ctx, span := startSpan(ctx, "Definitions", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var definitions []application.AttributeDefinition
+	for rows.Next() {
+		definition, err := scanAttributeDefinition(rows)
+		if err != nil {
+			return nil, endSpan(span, err)
+		}
+		definitions = append(definitions, definition)
+	}
+	return definitions, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+func (r *attributeRepository) FindDefinition(ctx context.Context, name string) (*application.AttributeDefinition, error) {
+	query := "SELECT " + attributeDefinitionColumns + " FROM attribute_definitions WHERE name = $1"
+	ctx, span := startSpan(ctx, "FindDefinition", query)
+	defer span.End()
+	definition, err := scanAttributeDefinition(r.connPool.QueryRowEx(ctx, query, nil, name))
+	if errors.Cause(err) == pgx.ErrNoRows {
+		return nil, endSpan(span, application.ErrAttributeNotFound)
+	}
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	return &definition, endSpan(span, nil)
+}
+
+func (r *attributeRepository) SaveDefinition(ctx context.Context, d application.AttributeDefinition) error {
+	query := "INSERT INTO attribute_definitions (" + attributeDefinitionColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8) " +
+		"ON CONFLICT (name) DO UPDATE SET type = $2, description = $3, visibility = $4, searchable = $5, validation = $6, updated_at = $8"
+	ctx, span := startSpan(ctx, "SaveDefinition", query)
+	defer span.End()
+	v := d.Validation
+	validation, err := json.Marshal(attributeValidation{
+		Pattern:   v.Pattern,
+		MinLength: v.MinLength,
+		MaxLength: v.MaxLength,
+		Min:       v.Min,
+		Max:       v.Max,
+		Values:    v.Values,
+	})
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	_, err = r.connPool.ExecEx(ctx, query, nil,
+		d.Name, d.Type, d.Description, d.Visibility, d.Searchable, validation, d.CreatedAt, d.UpdatedAt)
+	return endSpan(span, errors.WithStack(err))
+}
+
+// DeleteDefinition removes the values without change log records, like a column dropped from the schema.
+func (r *attributeRepository) DeleteDefinition(ctx context.Context, name string) error {
+	query := "DELETE FROM attribute_definitions WHERE name = $1"
+	ctx, span := startSpan(ctx, "DeleteDefinition", query)
+	defer span.End()
+	tx, err := r.connPool.BeginEx(ctx, nil)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	defer func() { _ = tx.Rollback() }()
+	tag, err := tx.ExecEx(ctx, query, nil, name)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrAttributeNotFound)
+	}
+	if _, err := tx.ExecEx(ctx, "UPDATE customers SET attributes = attributes - $1 WHERE attributes ? $1", nil, name); err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	return endSpan(span, errors.WithStack(tx.CommitEx(ctx)))
+}
+
+func scanAttributeDefinition(row scanner) (application.AttributeDefinition, error) {
+	var (
+		d          application.AttributeDefinition
+		validation []byte
+	)
+	if err := row.Scan(&d.Name, &d.Type, &d.Description, &d.Visibility, &d.Searchable, &validation, &d.CreatedAt, &d.UpdatedAt); err != nil {
+		return application.AttributeDefinition{}, errors.WithStack(err)
+	}
+	var v attributeValidation
+	if err := json.Unmarshal(validation, &v); err != nil {
+		return application.AttributeDefinition{}, errors.Wrap(err, "failed to decode attribute validation")
+	}
+	d.Validation = application.AttributeValidation{
+		Pattern:   v.Pattern,
+		MinLength: v.MinLength,
+		MaxLength: v.MaxLength,
+		Min:       v.Min,
+		Max:       v.Max,
+		Values:    v.Values,
+	}
+	d.CreatedAt, d.UpdatedAt = d.CreatedAt.UTC(), d.UpdatedAt.UTC()
+	return d, nil
+}
@@ -0,0 +1,223 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const (
+	changesChannel = "customer_changes"
+	// changeLogLockID serializes the writers of the change log, see recordChange.
+	changeLogLockID = 7346120386
+	// listenRetryDelay is the pause before the listener reconnects after a failure.
+	listenRetryDelay = 5 * time.Second
+	// pruneBatchSize bounds the changes deleted by one statement, so that a large backlog is not pruned in one transaction.
+	pruneBatchSize = 10000
+)
+
+type changedCustomer struct {
+	ID        string    `json:"id"`
+	FirstName string    `json:"firstName"`
+	LastName  string    `json:"lastName"`
+	Email     string    `json:"email"`
+	Phone     string    `json:"phone"`
+	Status    string    `json:"status"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// recordChange appends the event to the change log and saves its webhook deliveries in the transaction of the customer write.
+// A sequence is taken at insert but becomes visible at commit, so the writers hold a lock until
+// they commit to make sequences visible in order. The notification is delivered at commit as well.
+//
+// The lock is global: customer writes are serialized from recordChange to their commit, which bounds them to
+// about one per commit latency, i.e. some thousands a second on a local disk and far fewer with synchronous
+// replication. Callers therefore record the change as the last statement of the transaction.
+func recordChange(ctx context.Context, tx *pgx.Tx, event application.Event) error {
+	var customer *application.Customer
+	switch e := event.(type) {
+	case application.CustomerRegistered:
+		customer = &e.Customer
+	case application.CustomerUpdated:
+		customer = &e.Customer
+	case application.CustomerStatusChanged:
+		customer = &e.Customer
+	case application.CustomersMerged:
+		customer = &e.Survivor
+	}
+	var data []byte
+	if customer != nil {
+		var err error
+		data, err = json.Marshal(changedCustomer{
+			ID:        customer.ID.String(),
+			FirstName: customer.FirstName,
+			LastName:  customer.LastName,
+			Email:     customer.Email,
+			Phone:     customer.Phone,
+			Status:    customer.Status,
+			CreatedAt: customer.CreatedAt,
+			UpdatedAt: customer.UpdatedAt,
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	// before the lock, which is held until the commit
+	if err := addWebhookDeliveries(ctx, tx, event); err != nil {
+		return err
+	}
+	if _, err := tx.ExecEx(ctx, "SELECT pg_advisory_xact_lock($1)", nil, changeLogLockID); err != nil {
+		return errors.Wrap(err, "failed to lock change log")
+	}
+	if _, err := tx.ExecEx(ctx, "INSERT INTO customer_changes (customer_id, event_type, customer) VALUES ($1, $2, $3)", nil,
+		event.CustomerID().String(), event.EventType(), data); err != nil {
+		return errors.Wrap(err, "failed to record change")
+	}
+	_, err := tx.ExecEx(ctx, "SELECT pg_notify($1, '')", nil, changesChannel)
+	return errors.Wrap(err, "failed to notify change")
+}
+
+type changeLog struct {
+	connPool *pgx.ConnPool
+}
+
+func NewChangeLog(connPool *pgx.ConnPool) application.ChangeLog {
+	return &changeLog{
+		connPool: connPool,
+	}
+}
+
+func (l *changeLog) Prune(ctx context.Context, before time.Time) (int64, error) {
+	query := "DELETE FROM customer_changes WHERE sequence IN (SELECT sequence FROM customer_changes WHERE occurred_at < $1 ORDER BY sequence LIMIT $2)"
+	ctx, span := startSpan(ctx, "Prune", query)
+	defer span.End()
+	var pruned int64
+	for {
+		tag, err := l.connPool.ExecEx(ctx, query, nil, before, pruneBatchSize)
+		if err != nil {
+			return pruned, endSpan(span, errors.WithStack(err))
+		}
+		pruned += tag.RowsAffected()
+		if tag.RowsAffected() < pruneBatchSize {
+			return pruned, endSpan(span, nil)
+		}
+	}
+}
+
+func (l *changeLog) ChangesAfter(ctx context.Context, after int64, limit int) ([]application.Change, error) {
+	query := "SELECT sequence, customer_id, event_type, customer, occurred_at FROM customer_changes WHERE sequence > $1 ORDER BY sequence LIMIT $2"
+	ctx, span := startSpan(ctx, "ChangesAfter", query)
+	defer span.End()
+	rows, err := l.connPool.QueryEx(ctx, query, nil, after, limit)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var changes []application.Change
+	for rows.Next() {
+		var (
+			change   application.Change
+			rawID    string
+			customer []byte
+		)
+		if err := rows.Scan(&change.Sequence, &rawID, &change.EventType, &customer, &change.OccurredAt); err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		id, err := uuid.FromString(rawID)
+		if err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		change.CustomerID = application.CustomerID(id)
+		change.OccurredAt = change.OccurredAt.UTC()
+		if customer != nil {
+			if change.Customer, err = decodeChangedCustomer(customer); err != nil {
+				return nil, endSpan(span, err)
+			}
+		}
+		changes = append(changes, change)
+	}
+	return changes, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+func decodeChangedCustomer(data []byte) (*application.Customer, error) {
+	var changed changedCustomer
+	if err := json.Unmarshal(data, &changed); err != nil {
+		return nil, errors.Wrap(err, "failed to decode changed customer")
+	}
+	id, err := uuid.FromString(changed.ID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode changed customer")
+	}
+	return &application.Customer{
+		ID:        application.CustomerID(id),
+		FirstName: changed.FirstName,
+		LastName:  changed.LastName,
+		Email:     changed.Email,
+		Phone:     changed.Phone,
+		Status:    changed.Status,
+		CreatedAt: changed.CreatedAt,
+		UpdatedAt: changed.UpdatedAt,
+	}, nil
+}
+
+// ChangeListener forwards the notifications of committed changes, including those of other instances.
+// It holds a connection of the pool while it runs.
+type ChangeListener struct {
+	connPool *pgx.ConnPool
+	notifier *application.ChangeNotifier
+	logger   logrus.FieldLogger
+}
+
+func NewChangeListener(connPool *pgx.ConnPool, notifier *application.ChangeNotifier, logger logrus.FieldLogger) *ChangeListener {
+	return &ChangeListener{
+		connPool: connPool,
+		notifier: notifier,
+		logger:   logger,
+	}
+}
+
+// Run listens until ctx is canceled, reconnecting after failures.
+func (l *ChangeListener) Run(ctx context.Context) error {
+	for {
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return nil
+		}
+		l.logger.WithError(err).Warn("change listener failed, reconnecting")
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(listenRetryDelay):
+		}
+	}
+}
+
+func (l *ChangeListener) listen(ctx context.Context) error {
+	conn, err := l.connPool.AcquireEx(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// a canceled wait leaves the connection closed, the pool drops it on release
+	defer l.connPool.Release(conn)
+	if err := conn.Listen(changesChannel); err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = conn.Unlisten(changesChannel) }()
+	// changes committed while the listener was down are picked up by the readers polling
+	l.notifier.Notify()
+	for {
+		if _, err := conn.WaitForNotification(ctx); err != nil {
+			return errors.WithStack(err)
+		}
+		l.notifier.Notify()
+	}
+}
@@ -0,0 +1,91 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+type consentRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewConsentRepository(connPool *pgx.ConnPool) application.ConsentRepository {
+	return &consentRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *consentRepository) AppendConsents(ctx context.Context, consents []application.Consent) error {
+	query := "INSERT INTO customer_consents (customer_id, purpose, channel, granted, source, policy_version, recorded_at) VALUES ($1, $2, $3, $4, $5, $6, $7)"
+	ctx, span := startSpan(ctx, "AppendConsents", query)
+	defer span.End()
+	tx, err := r.connPool.BeginEx(ctx, nil)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	defer func() { _ = tx.Rollback() }()
+	for _, c := range consents {
+		if _, err := tx.ExecEx(ctx, query, nil,
+			c.CustomerID.String(), c.Purpose, c.Channel, c.Granted, c.Source, c.PolicyVersion, c.RecordedAt); err != nil {
+			return endSpan(span, errors.WithStack(err))
+		}
+		if err := addWebhookDeliveries(ctx, tx, application.NewCustomerConsentChanged(c)); err != nil {
+			return endSpan(span, err)
+		}
+	}
+	return endSpan(span, errors.WithStack(tx.CommitEx(ctx)))
+}
+
+func (r *consentRepository) ConsentHistory(ctx context.Context, id application.CustomerID) ([]application.Consent, error) {
+	query := "SELECT purpose, channel, granted, source, policy_version, recorded_at FROM customer_consents WHERE customer_id = $1 ORDER BY recorded_at, id"
+	ctx, span := startSpan(ctx, "ConsentHistory", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil, id.String())
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var consents []application.Consent
+	for rows.Next() {
+		consent := application.Consent{CustomerID: id}
+		if err := rows.Scan(&consent.Purpose, &consent.Channel, &consent.Granted, &consent.Source, &consent.PolicyVersion, &consent.RecordedAt); err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		consent.RecordedAt = consent.RecordedAt.UTC()
+		consents = append(consents, consent)
+	}
+	return consents, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+func (r *consentRepository) ConsentingCustomers(ctx context.Context, purpose, channel string, after application.CustomerID, limit int) ([]application.Customer, error) {
+	// the latest consent decides, customers without a decision or whose account is not active are left out
+	query := "SELECT " + customerColumns + " FROM customers c WHERE c.id > $3 AND c.status = 'active' AND (" +
+		"SELECT granted FROM customer_consents WHERE customer_id = c.id AND purpose = $1 AND channel = $2 ORDER BY recorded_at DESC, id DESC LIMIT 1" +
+		") ORDER BY c.id LIMIT $4"
+	ctx, span := startSpan(ctx, "ConsentingCustomers", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil, purpose, channel, after.String(), limit)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var customers []application.Customer
+	for rows.Next() {
+		raw, err := scanCustomer(rows)
+		if err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		customer, err := toCustomer(raw)
+		if err != nil {
+			return nil, endSpan(span, err)
+		}
+		customers = append(customers, customer)
+	}
+	return customers, endSpan(span, errors.WithStack(rows.Err()))
+}
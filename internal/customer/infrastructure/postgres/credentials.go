@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/identity"
+)
+
+type credentialStore struct {
+	connPool *pgx.ConnPool
+}
+
+func NewCredentialStore(connPool *pgx.ConnPool) identity.CredentialStore {
+	return &credentialStore{
+		connPool: connPool,
+	}
+}
+
+func (s *credentialStore) Add(ctx context.Context, credentials identity.Credentials) error {
+	_, err := s.connPool.ExecEx(ctx,
+		"INSERT INTO credentials (user_id, username, password_hash) VALUES ($1, $2, $3)", nil,
+		credentials.UserID.String(), credentials.Username, credentials.PasswordHash)
+	if err != nil {
+		pgErr, ok := err.(pgx.PgError)
+		if ok && pgErr.Code == errUniqueConstraint {
+			return application.ErrUsernameTaken
+		}
+		return errors.WithStack(err)
+	}
+	return nil
+}
+
+func (s *credentialStore) Delete(ctx context.Context, userID uuid.UUID) error {
+	_, err := s.connPool.ExecEx(ctx, "DELETE FROM credentials WHERE user_id = $1", nil, userID.String())
+	return errors.WithStack(err)
+}
+
+func (s *credentialStore) Exists(ctx context.Context, userID uuid.UUID) (bool, error) {
+	var exists bool
+	err := s.connPool.QueryRowEx(ctx, "SELECT EXISTS (SELECT 1 FROM credentials WHERE user_id = $1)", nil, userID.String()).Scan(&exists)
+	return exists, errors.WithStack(err)
+}
+
+func (s *credentialStore) ListUserIDs(ctx context.Context, after uuid.UUID, limit int) ([]uuid.UUID, error) {
+	rows, err := s.connPool.QueryEx(ctx, "SELECT user_id FROM credentials WHERE user_id > $1 ORDER BY user_id LIMIT $2", nil, after.String(), limit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+	var ids []uuid.UUID
+	for rows.Next() {
+		var rawID string
+		if err := rows.Scan(&rawID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		id, err := uuid.FromString(rawID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, errors.WithStack(rows.Err())
+}
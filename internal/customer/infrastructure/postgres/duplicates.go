@@ -0,0 +1,144 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+type duplicateRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewDuplicateRepository(connPool *pgx.ConnPool) application.DuplicateRepository {
+	return &duplicateRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *duplicateRepository) SaveMatchKeys(ctx context.Context, keys application.MatchKeys) error {
+	query := "INSERT INTO customer_match_keys (customer_id, email, phone, name, name_words, updated_at) VALUES ($1, $2, $3, $4, string_to_array($4, ' '), now()) " +
+		"ON CONFLICT (customer_id) DO UPDATE SET email = $2, phone = $3, name = $4, name_words = string_to_array($4, ' '), updated_at = now()"
+	ctx, span := startSpan(ctx, "SaveMatchKeys", query)
+	defer span.End()
+	_, err := r.connPool.ExecEx(ctx, query, nil,
+		keys.CustomerID.String(), keys.Email, keys.Phone, keys.Name)
+	return endSpan(span, errors.WithStack(err))
+}
+
+func (r *duplicateRepository) FindMatchCandidates(ctx context.Context, keys application.MatchKeys, limit int) ([]application.MatchKeys, error) {
+	// candidates with the same email or phone come first, the ones sharing only a word or trigrams of the name fill up
+	// to the limit, the most similar names first
+	query := "SELECT customer_id, email, phone, name FROM customer_match_keys " +
+		"WHERE customer_id <> $1 AND (($2 <> '' AND email = $2) OR ($3 <> '' AND phone = $3) OR name_words && string_to_array($4, ' ') OR name % $4) " +
+		"ORDER BY ($2 <> '' AND email = $2) DESC, ($3 <> '' AND phone = $3) DESC, similarity(name, $4) DESC, customer_id LIMIT $5"
+	ctx, span := startSpan(ctx, "FindMatchCandidates", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil,
+		keys.CustomerID.String(), keys.Email, keys.Phone, keys.Name, limit)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var candidates []application.MatchKeys
+	for rows.Next() {
+		var (
+			candidate application.MatchKeys
+			rawID     string
+		)
+		if err := rows.Scan(&rawID, &candidate.Email, &candidate.Phone, &candidate.Name); err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		id, err := uuid.FromString(rawID)
+		if err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		candidate.CustomerID = application.CustomerID(id)
+		candidates = append(candidates, candidate)
+	}
+	return candidates, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+func (r *duplicateRepository) SaveDuplicates(ctx context.Context, id application.CustomerID, pairs []application.DuplicatePair) error {
+	query := "INSERT INTO customer_duplicates (customer_id, candidate_id, score, reasons, detected_at) VALUES ($1, $2, $3, $4, $5)"
+	ctx, span := startSpan(ctx, "SaveDuplicates", query)
+	defer span.End()
+	tx, err := r.connPool.BeginEx(ctx, nil)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	defer func() { _ = tx.Rollback() }()
+	if _, err := tx.ExecEx(ctx, "DELETE FROM customer_duplicates WHERE customer_id = $1 OR candidate_id = $1", nil, id.String()); err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	for _, pair := range pairs {
+		first, second := pair.CustomerID.String(), pair.CandidateID.String()
+		if second < first {
+			first, second = second, first
+		}
+		if _, err := tx.ExecEx(ctx, query, nil, first, second, pair.Score, pair.Reasons, pair.DetectedAt); err != nil {
+			return endSpan(span, errors.WithStack(err))
+		}
+	}
+	return endSpan(span, errors.WithStack(tx.CommitEx(ctx)))
+}
+
+func (r *duplicateRepository) DuplicatesOf(ctx context.Context, id application.CustomerID, minScore float64) ([]application.DuplicatePair, error) {
+	query := "SELECT customer_id, candidate_id, score, reasons, detected_at FROM customer_duplicates " +
+		"WHERE (customer_id = $1 OR candidate_id = $1) AND score >= $2 ORDER BY score DESC"
+	ctx, span := startSpan(ctx, "DuplicatesOf", query)
+	defer span.End()
+	var pairs []application.DuplicatePair
+	err := r.queryPairs(ctx, query, func(pair application.DuplicatePair) error {
+		if pair.CandidateID == id {
+			pair.CustomerID, pair.CandidateID = pair.CandidateID, pair.CustomerID
+		}
+		pairs = append(pairs, pair)
+		return nil
+	}, id.String(), minScore)
+	return pairs, endSpan(span, err)
+}
+
+func (r *duplicateRepository) DuplicatePairs(ctx context.Context, minScore float64, handle func(pair application.DuplicatePair) error) error {
+	query := "SELECT customer_id, candidate_id, score, reasons, detected_at FROM customer_duplicates " +
+		"WHERE score >= $1 ORDER BY customer_id, candidate_id"
+	ctx, span := startSpan(ctx, "DuplicatePairs", query)
+	defer span.End()
+	return endSpan(span, r.queryPairs(ctx, query, handle, minScore))
+}
+
+func (r *duplicateRepository) queryPairs(ctx context.Context, query string, handle func(pair application.DuplicatePair) error, args ...interface{}) error {
+	rows, err := r.connPool.QueryEx(ctx, query, nil, args...)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			pair                application.DuplicatePair
+			rawID, rawCandidate string
+		)
+		if err := rows.Scan(&rawID, &rawCandidate, &pair.Score, &pair.Reasons, &pair.DetectedAt); err != nil {
+			return errors.WithStack(err)
+		}
+		id, err := uuid.FromString(rawID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		candidate, err := uuid.FromString(rawCandidate)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		pair.CustomerID, pair.CandidateID = application.CustomerID(id), application.CustomerID(candidate)
+		pair.DetectedAt = pair.DetectedAt.UTC()
+		if err := handle(pair); err != nil {
+			return err
+		}
+	}
+	return errors.WithStack(rows.Err())
+}
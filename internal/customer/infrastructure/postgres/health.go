@@ -0,0 +1,27 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+)
+
+type HealthChecker struct {
+	connPool *pgx.ConnPool
+}
+
+func NewHealthChecker(connPool *pgx.ConnPool) *HealthChecker {
+	return &HealthChecker{
+		connPool: connPool,
+	}
+}
+
+func (c *HealthChecker) Ping(ctx context.Context) error {
+	conn, err := c.connPool.AcquireEx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire connection")
+	}
+	defer c.connPool.Release(conn)
+	return errors.WithStack(conn.Ping(ctx))
+}
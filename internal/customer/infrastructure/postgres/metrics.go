@@ -0,0 +1,79 @@
+package postgres
+
+import (
+	"sync/atomic"
+
+	"github.com/jackc/pgx"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+)
+
+// pgx v3 reports a pool without free connections only with this log message.
+const waitingForConnectionMessage = "waiting for available connection"
+
+// PoolCollector exposes connection pool statistics, read at scrape time.
+// pgx v3 does not report the number of waiting goroutines, so waits are counted
+// through the pool logger instead, see PoolCollector.Logger.
+type PoolCollector struct {
+	connPool *pgx.ConnPool
+	waits    uint64
+
+	max        *prometheus.Desc
+	acquired   *prometheus.Desc
+	idle       *prometheus.Desc
+	waitsTotal *prometheus.Desc
+}
+
+func NewPoolCollector(namespace string) *PoolCollector {
+	return &PoolCollector{
+		max:        prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "max_connections"), "Maximum number of connections in the pool.", nil, nil),
+		acquired:   prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "acquired_connections"), "Number of connections currently in use.", nil, nil),
+		idle:       prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "idle_connections"), "Number of established connections available for use.", nil, nil),
+		waitsTotal: prometheus.NewDesc(prometheus.BuildFQName(namespace, "db_pool", "waits_total"), "Number of times a query had to wait for a connection.", nil, nil),
+	}
+}
+
+// SetPool must be called once the pool is created, before the collector is registered.
+func (c *PoolCollector) SetPool(connPool *pgx.ConnPool) {
+	c.connPool = connPool
+}
+
+// Logger returns a pgx logger which counts waits for a connection and forwards warnings and errors to logger.
+func (c *PoolCollector) Logger(logger logrus.FieldLogger) pgx.Logger {
+	return &poolLogger{collector: c, logger: logger}
+}
+
+func (c *PoolCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.max
+	ch <- c.acquired
+	ch <- c.idle
+	ch <- c.waitsTotal
+}
+
+func (c *PoolCollector) Collect(ch chan<- prometheus.Metric) {
+	stat := c.connPool.Stat()
+	ch <- prometheus.MustNewConstMetric(c.max, prometheus.GaugeValue, float64(stat.MaxConnections))
+	ch <- prometheus.MustNewConstMetric(c.acquired, prometheus.GaugeValue, float64(stat.CheckedOutConnections()))
+	ch <- prometheus.MustNewConstMetric(c.idle, prometheus.GaugeValue, float64(stat.AvailableConnections))
+	ch <- prometheus.MustNewConstMetric(c.waitsTotal, prometheus.CounterValue, float64(atomic.LoadUint64(&c.waits)))
+}
+
+type poolLogger struct {
+	collector *PoolCollector
+	logger    logrus.FieldLogger
+}
+
+func (l *poolLogger) Log(level pgx.LogLevel, msg string, data map[string]interface{}) {
+	if msg == waitingForConnectionMessage {
+		atomic.AddUint64(&l.collector.waits, 1)
+		return
+	}
+	// query arguments may contain personal data
+	delete(data, "args")
+	entry := l.logger.WithFields(data)
+	if level == pgx.LogLevelError {
+		entry.Error(msg)
+	} else {
+		entry.Warn(msg)
+	}
+}
@@ -0,0 +1,266 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const (
+	organizationColumns = "id, legal_name, address_line1, address_line2, city, postal_code, region, country, created_at, updated_at"
+	memberColumns       = "organization_id, customer_id, role, joined_at"
+	invitationColumns   = "id, organization_id, email, role, token_hash, invited_by, created_at, expires_at, accepted_at"
+)
+
+type organizationRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewOrganizationRepository(connPool *pgx.ConnPool) application.OrganizationRepository {
+	return &organizationRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *organizationRepository) AddOrganization(ctx context.Context, o application.Organization, owner application.Membership) error {
+	query := "INSERT INTO organizations (" + organizationColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+	ctx, span := startSpan(ctx, "AddOrganization", query)
+	defer span.End()
+	tx, err := r.connPool.BeginEx(ctx, nil)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	defer func() { _ = tx.Rollback() }()
+	a := o.BillingAddress
+	if _, err := tx.ExecEx(ctx, query, nil, o.ID.String(), o.LegalName,
+		a.Line1, a.Line2, a.City, a.PostalCode, a.Region, a.Country, o.CreatedAt, o.UpdatedAt); err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if err := addMember(ctx, tx, owner); err != nil {
+		return endSpan(span, err)
+	}
+	return endSpan(span, errors.WithStack(tx.CommitEx(ctx)))
+}
+
+func (r *organizationRepository) FindOrganization(ctx context.Context, id uuid.UUID) (*application.Organization, error) {
+	query := "SELECT " + organizationColumns + " FROM organizations WHERE id = $1"
+	ctx, span := startSpan(ctx, "FindOrganization", query)
+	defer span.End()
+	var (
+		o     application.Organization
+		rawID string
+	)
+	a := &o.BillingAddress
+	err := r.connPool.QueryRowEx(ctx, query, nil, id.String()).Scan(&rawID, &o.LegalName,
+		&a.Line1, &a.Line2, &a.City, &a.PostalCode, &a.Region, &a.Country, &o.CreatedAt, &o.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, endSpan(span, application.ErrOrganizationNotFound)
+	}
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	o.ID = id
+	o.CreatedAt = o.CreatedAt.UTC()
+	o.UpdatedAt = o.UpdatedAt.UTC()
+	return &o, endSpan(span, nil)
+}
+
+func (r *organizationRepository) UpdateOrganization(ctx context.Context, o application.Organization) error {
+	query := "UPDATE organizations SET legal_name = $1, address_line1 = $2, address_line2 = $3, city = $4, " +
+		"postal_code = $5, region = $6, country = $7, updated_at = $8 WHERE id = $9"
+	ctx, span := startSpan(ctx, "UpdateOrganization", query)
+	defer span.End()
+	a := o.BillingAddress
+	tag, err := r.connPool.ExecEx(ctx, query, nil, o.LegalName,
+		a.Line1, a.Line2, a.City, a.PostalCode, a.Region, a.Country, o.UpdatedAt, o.ID.String())
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrOrganizationNotFound)
+	}
+	return endSpan(span, nil)
+}
+
+func (r *organizationRepository) Members(ctx context.Context, organizationID uuid.UUID) ([]application.Membership, error) {
+	query := "SELECT " + memberColumns + " FROM organization_members WHERE organization_id = $1 ORDER BY joined_at, customer_id"
+	ctx, span := startSpan(ctx, "Members", query)
+	defer span.End()
+	members, err := r.queryMembers(ctx, query, organizationID.String())
+	return members, endSpan(span, err)
+}
+
+func (r *organizationRepository) MembershipsOf(ctx context.Context, id application.CustomerID) ([]application.Membership, error) {
+	query := "SELECT " + memberColumns + " FROM organization_members WHERE customer_id = $1 ORDER BY joined_at, organization_id"
+	ctx, span := startSpan(ctx, "MembershipsOf", query)
+	defer span.End()
+	members, err := r.queryMembers(ctx, query, id.String())
+	return members, endSpan(span, err)
+}
+
+func (r *organizationRepository) FindMembership(ctx context.Context, organizationID uuid.UUID, id application.CustomerID) (*application.Membership, error) {
+	query := "SELECT " + memberColumns + " FROM organization_members WHERE organization_id = $1 AND customer_id = $2"
+	ctx, span := startSpan(ctx, "FindMembership", query)
+	defer span.End()
+	member, err := scanMember(r.connPool.QueryRowEx(ctx, query, nil, organizationID.String(), id.String()))
+	if errors.Cause(err) == pgx.ErrNoRows {
+		return nil, endSpan(span, application.ErrMemberNotFound)
+	}
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	return &member, endSpan(span, nil)
+}
+
+func (r *organizationRepository) UpdateMemberRole(ctx context.Context, organizationID uuid.UUID, id application.CustomerID, role string) error {
+	query := "UPDATE organization_members SET role = $1 WHERE organization_id = $2 AND customer_id = $3"
+	ctx, span := startSpan(ctx, "UpdateMemberRole", query)
+	defer span.End()
+	tag, err := r.connPool.ExecEx(ctx, query, nil, role, organizationID.String(), id.String())
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrMemberNotFound)
+	}
+	return endSpan(span, nil)
+}
+
+func (r *organizationRepository) RemoveMember(ctx context.Context, organizationID uuid.UUID, id application.CustomerID) error {
+	query := "DELETE FROM organization_members WHERE organization_id = $1 AND customer_id = $2"
+	ctx, span := startSpan(ctx, "RemoveMember", query)
+	defer span.End()
+	tag, err := r.connPool.ExecEx(ctx, query, nil, organizationID.String(), id.String())
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrMemberNotFound)
+	}
+	return endSpan(span, nil)
+}
+
+func (r *organizationRepository) AddInvitation(ctx context.Context, i application.Invitation) error {
+	query := "INSERT INTO organization_invitations (" + invitationColumns + ") VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	ctx, span := startSpan(ctx, "AddInvitation", query)
+	defer span.End()
+	_, err := r.connPool.ExecEx(ctx, query, nil, i.ID.String(), i.OrganizationID.String(), i.Email, i.Role, i.TokenHash,
+		i.InvitedBy.String(), i.CreatedAt, i.ExpiresAt, i.AcceptedAt)
+	return endSpan(span, errors.WithStack(err))
+}
+
+func (r *organizationRepository) FindInvitation(ctx context.Context, tokenHash string) (*application.Invitation, error) {
+	query := "SELECT " + invitationColumns + " FROM organization_invitations WHERE token_hash = $1"
+	ctx, span := startSpan(ctx, "FindInvitation", query)
+	defer span.End()
+	var (
+		i                                    application.Invitation
+		rawID, rawOrganizationID, rawInviter string
+	)
+	err := r.connPool.QueryRowEx(ctx, query, nil, tokenHash).Scan(&rawID, &rawOrganizationID, &i.Email, &i.Role, &i.TokenHash,
+		&rawInviter, &i.CreatedAt, &i.ExpiresAt, &i.AcceptedAt)
+	if err == pgx.ErrNoRows {
+		return nil, endSpan(span, application.ErrInvitationNotFound)
+	}
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	if i.ID, err = uuid.FromString(rawID); err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	if i.OrganizationID, err = uuid.FromString(rawOrganizationID); err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	inviter, err := uuid.FromString(rawInviter)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	i.InvitedBy = application.CustomerID(inviter)
+	return &i, endSpan(span, nil)
+}
+
+func (r *organizationRepository) AcceptInvitation(ctx context.Context, i application.Invitation, member application.Membership) error {
+	query := "UPDATE organization_invitations SET accepted_at = $1, accepted_by = $2 WHERE id = $3 AND accepted_at IS NULL"
+	ctx, span := startSpan(ctx, "AcceptInvitation", query)
+	defer span.End()
+	tx, err := r.connPool.BeginEx(ctx, nil)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	defer func() { _ = tx.Rollback() }()
+	tag, err := tx.ExecEx(ctx, query, nil, i.AcceptedAt, member.CustomerID.String(), i.ID.String())
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrInvitationNotFound)
+	}
+	if err := addMember(ctx, tx, member); err != nil {
+		return endSpan(span, err)
+	}
+	return endSpan(span, errors.WithStack(tx.CommitEx(ctx)))
+}
+
+func (r *organizationRepository) ManagesMember(ctx context.Context, managerID, memberID application.CustomerID) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM organization_members manager " +
+		"JOIN organization_members member ON member.organization_id = manager.organization_id " +
+		"WHERE manager.customer_id = $1 AND manager.role IN ($3, $4) AND member.customer_id = $2)"
+	ctx, span := startSpan(ctx, "ManagesMember", query)
+	defer span.End()
+	var manages bool
+	err := r.connPool.QueryRowEx(ctx, query, nil, managerID.String(), memberID.String(), application.RoleOwner, application.RoleAdmin).
+		Scan(&manages)
+	return manages, endSpan(span, errors.WithStack(err))
+}
+
+func (r *organizationRepository) queryMembers(ctx context.Context, query string, args ...interface{}) ([]application.Membership, error) {
+	rows, err := r.connPool.QueryEx(ctx, query, nil, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var members []application.Membership
+	for rows.Next() {
+		member, err := scanMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		members = append(members, member)
+	}
+	return members, errors.WithStack(rows.Err())
+}
+
+// addMember inserts the membership, an existing membership of the customer keeps its role.
+func addMember(ctx context.Context, tx *pgx.Tx, member application.Membership) error {
+	_, err := tx.ExecEx(ctx,
+		"INSERT INTO organization_members ("+memberColumns+") VALUES ($1, $2, $3, $4) ON CONFLICT (organization_id, customer_id) DO NOTHING", nil,
+		member.OrganizationID.String(), member.CustomerID.String(), member.Role, member.JoinedAt)
+	return errors.WithStack(err)
+}
+
+func scanMember(row scanner) (application.Membership, error) {
+	var (
+		member                           application.Membership
+		rawOrganizationID, rawCustomerID string
+	)
+	if err := row.Scan(&rawOrganizationID, &rawCustomerID, &member.Role, &member.JoinedAt); err != nil {
+		return member, errors.WithStack(err)
+	}
+	organizationID, err := uuid.FromString(rawOrganizationID)
+	if err != nil {
+		return member, errors.WithStack(err)
+	}
+	customerID, err := uuid.FromString(rawCustomerID)
+	if err != nil {
+		return member, errors.WithStack(err)
+	}
+	member.OrganizationID = organizationID
+	member.CustomerID = application.CustomerID(customerID)
+	member.JoinedAt = member.JoinedAt.UTC()
+	return member, nil
+}
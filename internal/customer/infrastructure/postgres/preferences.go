@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+type preferencesRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewPreferencesRepository(connPool *pgx.ConnPool) application.PreferencesRepository {
+	return &preferencesRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *preferencesRepository) FindPreferences(ctx context.Context, id application.CustomerID) (*application.Preferences, error) {
+	query := "SELECT locale, timezone, currency, notifications, updated_at FROM customer_preferences WHERE customer_id = $1"
+	ctx, span := startSpan(ctx, "FindPreferences", query)
+	defer span.End()
+	var (
+		preferences   application.Preferences
+		notifications []byte
+	)
+	err := r.connPool.QueryRowEx(ctx, query, nil, id.String()).
+		Scan(&preferences.Locale, &preferences.Timezone, &preferences.Currency, &notifications, &preferences.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, endSpan(span, nil)
+	}
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	if err := json.Unmarshal(notifications, &preferences.Notifications); err != nil {
+		return nil, endSpan(span, errors.Wrap(err, "failed to decode notification preferences"))
+	}
+	preferences.UpdatedAt = preferences.UpdatedAt.UTC()
+	return &preferences, endSpan(span, nil)
+}
+
+func (r *preferencesRepository) SavePreferences(ctx context.Context, id application.CustomerID, preferences application.Preferences) error {
+	query := "INSERT INTO customer_preferences (customer_id, locale, timezone, currency, notifications, updated_at) VALUES ($1, $2, $3, $4, $5, $6) " +
+		"ON CONFLICT (customer_id) DO UPDATE SET locale = $2, timezone = $3, currency = $4, notifications = $5, updated_at = $6"
+	ctx, span := startSpan(ctx, "SavePreferences", query)
+	defer span.End()
+	notifications, err := json.Marshal(preferences.Notifications)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	_, err = r.connPool.ExecEx(ctx, query, nil,
+		id.String(), preferences.Locale, preferences.Timezone, preferences.Currency, notifications, preferences.UpdatedAt)
+	return endSpan(span, errors.WithStack(err))
+}
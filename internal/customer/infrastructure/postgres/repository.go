@@ -1,6 +1,11 @@
 package postgres
 
 import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
 	"github.com/jackc/pgx"
 	"github.com/jnikolaeva/eshop-common/uuid"
 	"github.com/pkg/errors"
@@ -8,14 +13,25 @@ import (
 	"github.com/jnikolaeva/customerservice/internal/customer/application"
 )
 
-const errUniqueConstraint = "23505"
+const (
+	errUniqueConstraint = "23505"
+	customerColumns     = "id, first_name, last_name, phone, email, status, created_at, updated_at, attributes, identity_missing_at"
+	// streamFetchSize is the number of rows fetched from the cursor at once.
+	streamFetchSize = 1000
+)
 
 type rawCustomer struct {
-	ID        string `db:"id"`
-	FirstName string `db:"first_name"`
-	LastName  string `db:"last_name"`
-	Email     string `db:"email"`
-	Phone     string `db:"phone"`
+	ID        string    `db:"id"`
+	FirstName string    `db:"first_name"`
+	LastName  string    `db:"last_name"`
+	Email     string    `db:"email"`
+	Phone     string    `db:"phone"`
+	Status    string    `db:"status"`
+	CreatedAt time.Time `db:"created_at"`
+	UpdatedAt time.Time `db:"updated_at"`
+	// Attributes is the JSON object of the custom attributes.
+	Attributes        []byte     `db:"attributes"`
+	IdentityMissingAt *time.Time `db:"identity_missing_at"`
 }
 
 type repository struct {
@@ -28,39 +44,455 @@ func New(connPool *pgx.ConnPool) application.Repository {
 	}
 }
 
-func (r *repository) Add(customer application.Customer) error {
-	_, err := r.connPool.Exec(
-		"INSERT INTO customers (id, first_name, last_name, email, phone) VALUES ($1, $2, $3, $4, $5)",
-		customer.ID.String(), customer.FirstName, customer.LastName, customer.Email, customer.Phone)
-	return r.convertError(err)
+func (r *repository) Add(ctx context.Context, customer application.Customer) error {
+	query := "INSERT INTO customers (id, first_name, last_name, email, phone, status, created_at, updated_at, attributes) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)"
+	ctx, span := startSpan(ctx, "Add", query)
+	defer span.End()
+	attributes, err := encodeAttributes(customer.Attributes)
+	if err != nil {
+		return endSpan(span, err)
+	}
+	err = r.inTx(ctx, func(tx *pgx.Tx) error {
+		if _, err := tx.ExecEx(ctx, query, nil,
+			customer.ID.String(), customer.FirstName, customer.LastName, customer.Email, customer.Phone, customer.Status, customer.CreatedAt, customer.UpdatedAt, attributes); err != nil {
+			return r.convertError(err)
+		}
+		return recordChange(ctx, tx, application.NewCustomerRegistered(customer))
+	})
+	return endSpan(span, err)
 }
 
-func (r *repository) FindByID(id application.CustomerID) (*application.Customer, error) {
-	var raw rawCustomer
-	query := "SELECT id, first_name, last_name, phone, email FROM customers WHERE id = $1"
-	err := r.connPool.QueryRow(query, id.String()).Scan(&raw.ID, &raw.FirstName, &raw.LastName, &raw.Phone, &raw.Email)
+func (r *repository) FindByID(ctx context.Context, id application.CustomerID) (*application.Customer, error) {
+	query := "SELECT " + customerColumns + " FROM customers WHERE id = $1"
+	ctx, span := startSpan(ctx, "FindByID", query)
+	defer span.End()
+	raw, err := scanCustomer(r.connPool.QueryRowEx(ctx, query, nil, id.String()))
 	if err != nil {
 		if err == pgx.ErrNoRows {
 			err = application.ErrCustomerNotFound
 		}
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	customer, err := toCustomer(raw)
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	return &customer, nil
+}
+
+func (r *repository) Update(ctx context.Context, user application.Customer) error {
+	query := "UPDATE customers SET first_name = $1, last_name = $2, email = $3, phone = $4, updated_at = $5 WHERE id = $6"
+	ctx, span := startSpan(ctx, "Update", query)
+	defer span.End()
+	err := r.inTx(ctx, func(tx *pgx.Tx) error {
+		tag, err := tx.ExecEx(ctx, query, nil,
+			user.FirstName, user.LastName, user.Email, user.Phone, user.UpdatedAt, user.ID.String())
+		if err != nil {
+			return r.convertError(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return application.ErrCustomerNotFound
+		}
+		return recordChange(ctx, tx, application.NewCustomerUpdated(user))
+	})
+	return endSpan(span, err)
+}
+
+func (r *repository) FindByEmail(ctx context.Context, email string) ([]application.Customer, error) {
+	query := "SELECT " + customerColumns + " FROM customers WHERE lower(email) = lower($1) ORDER BY id"
+	ctx, span := startSpan(ctx, "FindByEmail", query)
+	defer span.End()
+	customers, err := r.query(ctx, query, email)
+	return customers, endSpan(span, err)
+}
+
+func (r *repository) List(ctx context.Context, after application.CustomerID, limit int) ([]application.Customer, error) {
+	query := "SELECT " + customerColumns + " FROM customers WHERE id > $1 ORDER BY id LIMIT $2"
+	ctx, span := startSpan(ctx, "List", query)
+	defer span.End()
+	customers, err := r.query(ctx, query, after.String(), limit)
+	return customers, endSpan(span, err)
+}
+
+func (r *repository) FlagMissingIdentity(ctx context.Context, id application.CustomerID) error {
+	query := "UPDATE customers SET identity_missing_at = now() WHERE id = $1 AND identity_missing_at IS NULL"
+	ctx, span := startSpan(ctx, "FlagMissingIdentity", query)
+	defer span.End()
+	_, err := r.connPool.ExecEx(ctx, query, nil, id.String())
+	return endSpan(span, r.convertError(err))
+}
+
+func (r *repository) ClearMissingIdentity(ctx context.Context, id application.CustomerID) error {
+	query := "UPDATE customers SET identity_missing_at = NULL WHERE id = $1 AND identity_missing_at IS NOT NULL"
+	ctx, span := startSpan(ctx, "ClearMissingIdentity", query)
+	defer span.End()
+	_, err := r.connPool.ExecEx(ctx, query, nil, id.String())
+	return endSpan(span, r.convertError(err))
+}
+
+func (r *repository) UpdateStatus(ctx context.Context, customer application.Customer, change application.StatusChange) error {
+	query := "UPDATE customers SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4"
+	ctx, span := startSpan(ctx, "UpdateStatus", query)
+	defer span.End()
+	err := r.inTx(ctx, func(tx *pgx.Tx) error {
+		tag, err := tx.ExecEx(ctx, query, nil, change.To, customer.UpdatedAt, customer.ID.String(), change.From)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if tag.RowsAffected() == 0 {
+			// the status was changed concurrently, or the customer was deleted
+			return application.ErrStatusTransitionNotAllowed
+		}
+		if _, err := tx.ExecEx(ctx,
+			"INSERT INTO customer_status_changes (customer_id, from_status, to_status, reason, note, actor, changed_at) VALUES ($1, $2, $3, $4, $5, $6, $7)", nil,
+			customer.ID.String(), change.From, change.To, change.Reason, change.Note, change.Actor, change.ChangedAt); err != nil {
+			return errors.WithStack(err)
+		}
+		if change.To == application.StatusClosed {
+			// subscribers of customer.closed learn of closed accounts as well
+			if err := addWebhookDeliveries(ctx, tx, application.NewCustomerClosed(customer.ID)); err != nil {
+				return err
+			}
+		}
+		return recordChange(ctx, tx, application.NewCustomerStatusChanged(customer, change))
+	})
+	return endSpan(span, err)
+}
+
+func (r *repository) Status(ctx context.Context, id application.CustomerID) (string, error) {
+	query := "SELECT status FROM customers WHERE id = $1"
+	ctx, span := startSpan(ctx, "Status", query)
+	defer span.End()
+	var status string
+	err := r.connPool.QueryRowEx(ctx, query, nil, id.String()).Scan(&status)
+	if err == pgx.ErrNoRows {
+		err = application.ErrCustomerNotFound
+	}
+	return status, endSpan(span, errors.WithStack(err))
+}
+
+func (r *repository) StatusHistory(ctx context.Context, id application.CustomerID) ([]application.StatusChange, error) {
+	query := "SELECT from_status, to_status, reason, note, actor, changed_at FROM customer_status_changes WHERE customer_id = $1 ORDER BY id"
+	ctx, span := startSpan(ctx, "StatusHistory", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil, id.String())
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var history []application.StatusChange
+	for rows.Next() {
+		change := application.StatusChange{CustomerID: id}
+		if err := rows.Scan(&change.From, &change.To, &change.Reason, &change.Note, &change.Actor, &change.ChangedAt); err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		change.ChangedAt = change.ChangedAt.UTC()
+		history = append(history, change)
+	}
+	return history, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+// mergeStatements move the data of the merged customer $2 to the survivor $1 where the survivor has none.
+// The survivor gets the consent history of both, so the decision recorded last is the current one.
+// Memberships keep the more privileged role, the survivor gets the tags of both. Aliases of the merged customer
+// point to the survivor afterwards.
+var mergeStatements = []string{
+	"UPDATE customer_consents SET customer_id = $1 WHERE customer_id = $2",
+	"INSERT INTO customer_preferences (customer_id, locale, timezone, currency, notifications, updated_at) " +
+		"SELECT $1, locale, timezone, currency, notifications, updated_at FROM customer_preferences WHERE customer_id = $2 " +
+		"ON CONFLICT (customer_id) DO NOTHING",
+	"INSERT INTO customer_tax_ids (customer_id, type, value, country, status, checked_at, updated_at) " +
+		"SELECT $1, type, value, country, status, checked_at, updated_at FROM customer_tax_ids WHERE customer_id = $2 " +
+		"ON CONFLICT (customer_id) DO NOTHING",
+	"UPDATE organization_members s SET role = m.role FROM organization_members m " +
+		"WHERE s.customer_id = $1 AND m.customer_id = $2 AND m.organization_id = s.organization_id " +
+		"AND array_position(ARRAY['owner', 'admin', 'buyer', 'viewer']::VARCHAR[], m.role) < array_position(ARRAY['owner', 'admin', 'buyer', 'viewer']::VARCHAR[], s.role)",
+	"INSERT INTO organization_members (organization_id, customer_id, role, joined_at) " +
+		"SELECT organization_id, $1, role, joined_at FROM organization_members WHERE customer_id = $2 " +
+		"ON CONFLICT (organization_id, customer_id) DO NOTHING",
+	"INSERT INTO customer_tags (customer_id, tag, tagged_at) " +
+		"SELECT $1, tag, tagged_at FROM customer_tags WHERE customer_id = $2 " +
+		"ON CONFLICT (customer_id, tag) DO NOTHING",
+	"UPDATE customer_aliases SET customer_id = $1 WHERE customer_id = $2",
+}
+
+func (r *repository) Merge(ctx context.Context, merge application.Merge) (*application.Customer, error) {
+	query := "DELETE FROM customers WHERE id = $1"
+	ctx, span := startSpan(ctx, "Merge", query)
+	defer span.End()
+	var survivor application.Customer
+	err := r.inTx(ctx, func(tx *pgx.Tx) error {
+		locked, err := lockCustomers(ctx, tx, merge.SurvivorID, merge.MergedID)
+		if err != nil {
+			return err
+		}
+		if len(locked) != 2 {
+			return application.ErrCustomerNotFound
+		}
+		var merged application.Customer
+		for _, customer := range locked {
+			if customer.ID == merge.SurvivorID {
+				survivor = customer
+			} else {
+				merged = customer
+			}
+		}
+		if survivor, err = application.MergeInto(survivor, merged, merge); err != nil {
+			return err
+		}
+		attributes, err := encodeAttributes(survivor.Attributes)
+		if err != nil {
+			return err
+		}
+		if _, err := tx.ExecEx(ctx, "UPDATE customers SET attributes = $1, updated_at = $2 WHERE id = $3", nil,
+			attributes, survivor.UpdatedAt, survivor.ID.String()); err != nil {
+			return errors.WithStack(err)
+		}
+		for _, statement := range mergeStatements {
+			if _, err := tx.ExecEx(ctx, statement, nil, merge.SurvivorID.String(), merge.MergedID.String()); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+		if _, err := tx.ExecEx(ctx, "INSERT INTO customer_aliases (alias_id, customer_id, merged_by, merged_at) VALUES ($1, $2, $3, $4)", nil,
+			merge.MergedID.String(), merge.SurvivorID.String(), merge.Actor, merge.MergedAt); err != nil {
+			return errors.WithStack(err)
+		}
+		tag, err := tx.ExecEx(ctx, query, nil, merge.MergedID.String())
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if tag.RowsAffected() == 0 {
+			return application.ErrCustomerNotFound
+		}
+		return recordChange(ctx, tx, application.NewCustomersMerged(survivor, merge))
+	})
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	return &survivor, endSpan(span, nil)
+}
+
+// lockCustomers locks the customers for the rest of the transaction and returns the ones which exist.
+// Rows are locked in the order of their IDs, so that transactions locking the same customers do not deadlock.
+func lockCustomers(ctx context.Context, tx *pgx.Tx, ids ...application.CustomerID) ([]application.Customer, error) {
+	rawIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		rawIDs = append(rawIDs, id.String())
+	}
+	rows, err := tx.QueryEx(ctx, "SELECT "+customerColumns+" FROM customers WHERE id = ANY($1::UUID[]) ORDER BY id FOR UPDATE", nil, rawIDs)
+	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	defer rows.Close()
+
+	var customers []application.Customer
+	for rows.Next() {
+		raw, err := scanCustomer(rows)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		customer, err := toCustomer(raw)
+		if err != nil {
+			return nil, err
+		}
+		customers = append(customers, customer)
+	}
+	return customers, errors.WithStack(rows.Err())
+}
+
+func (r *repository) MergedInto(ctx context.Context, id application.CustomerID) (*application.CustomerID, error) {
+	query := "SELECT customer_id FROM customer_aliases WHERE alias_id = $1"
+	ctx, span := startSpan(ctx, "MergedInto", query)
+	defer span.End()
+	var rawID string
+	err := r.connPool.QueryRowEx(ctx, query, nil, id.String()).Scan(&rawID)
+	if err == pgx.ErrNoRows {
+		return nil, endSpan(span, nil)
+	}
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	survivorID, err := uuid.FromString(rawID)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	customerID := application.CustomerID(survivorID)
+	return &customerID, endSpan(span, nil)
+}
+
+// UpdateAttributes changes only the given keys in SQL, so that concurrent updates of other attributes are kept.
+func (r *repository) UpdateAttributes(ctx context.Context, id application.CustomerID, values map[string]interface{}, removed []string, updatedAt time.Time) (*application.Customer, error) {
+	query := "UPDATE customers SET attributes = (attributes || $1::JSONB) - $2::TEXT[], updated_at = $3 WHERE id = $4 RETURNING " + customerColumns
+	ctx, span := startSpan(ctx, "UpdateAttributes", query)
+	defer span.End()
+	attributes, err := encodeAttributes(values)
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	if removed == nil {
+		removed = []string{}
+	}
+	var customer application.Customer
+	err = r.inTx(ctx, func(tx *pgx.Tx) error {
+		raw, err := scanCustomer(tx.QueryRowEx(ctx, query, nil, attributes, removed, updatedAt, id.String()))
+		if err == pgx.ErrNoRows {
+			return application.ErrCustomerNotFound
+		}
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		if customer, err = toCustomer(raw); err != nil {
+			return err
+		}
+		return recordChange(ctx, tx, application.NewCustomerUpdated(customer))
+	})
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	return &customer, endSpan(span, nil)
+}
+
+// FindByAttributes matches the values with the containment operator, which the GIN index of the attributes serves.
+func (r *repository) FindByAttributes(ctx context.Context, values map[string]interface{}, after application.CustomerID, limit int) ([]application.Customer, error) {
+	query := "SELECT " + customerColumns + " FROM customers WHERE id > $1 AND attributes @> $2 ORDER BY id LIMIT $3"
+	ctx, span := startSpan(ctx, "FindByAttributes", query)
+	defer span.End()
+	filter, err := encodeAttributes(values)
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	customers, err := r.query(ctx, query, after.String(), filter, limit)
+	return customers, endSpan(span, err)
+}
+
+func (r *repository) query(ctx context.Context, query string, args ...interface{}) ([]application.Customer, error) {
+	rows, err := r.connPool.QueryEx(ctx, query, nil, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var customers []application.Customer
+	for rows.Next() {
+		raw, err := scanCustomer(rows)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		customer, err := toCustomer(raw)
+		if err != nil {
+			return nil, err
+		}
+		customers = append(customers, customer)
+	}
+	return customers, errors.WithStack(rows.Err())
+}
+
+func (r *repository) Stream(ctx context.Context, filter application.CustomerFilter, handle func(customer application.Customer) error) error {
+	query := "SELECT " + customerColumns + " FROM customers WHERE ($1::timestamptz IS NULL OR updated_at >= $1) AND ($2::timestamptz IS NULL OR updated_at < $2) ORDER BY updated_at, id"
+	ctx, span := startSpan(ctx, "Stream", query)
+	defer span.End()
+
+	tx, err := r.connPool.BeginEx(ctx, &pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecEx(ctx, "DECLARE customers_stream NO SCROLL CURSOR FOR "+query, nil,
+		nullableTime(filter.UpdatedSince), nullableTime(filter.UpdatedBefore)); err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	for {
+		rows, err := tx.QueryEx(ctx, "FETCH FORWARD "+strconv.Itoa(streamFetchSize)+" FROM customers_stream", nil)
+		if err != nil {
+			return endSpan(span, errors.WithStack(err))
+		}
+		fetched := 0
+		for rows.Next() {
+			fetched++
+			var customer application.Customer
+			raw, err := scanCustomer(rows)
+			if err == nil {
+				customer, err = toCustomer(raw)
+			}
+			if err == nil {
+				err = handle(customer)
+			}
+			if err != nil {
+				rows.Close()
+				return endSpan(span, errors.WithStack(err))
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return endSpan(span, errors.WithStack(err))
+		}
+		if fetched < streamFetchSize {
+			return nil
+		}
+	}
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanCustomer(row scanner) (rawCustomer, error) {
+	var raw rawCustomer
+	err := row.Scan(&raw.ID, &raw.FirstName, &raw.LastName, &raw.Phone, &raw.Email, &raw.Status, &raw.CreatedAt, &raw.UpdatedAt, &raw.Attributes, &raw.IdentityMissingAt)
+	return raw, err
+}
+
+func nullableTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func toCustomer(raw rawCustomer) (application.Customer, error) {
 	customerID, _ := uuid.FromString(raw.ID)
-	customer := &application.Customer{
+	customer := application.Customer{
 		ID:        application.CustomerID(customerID),
 		FirstName: raw.FirstName,
 		LastName:  raw.LastName,
 		Email:     raw.Email,
 		Phone:     raw.Phone,
+		Status:    raw.Status,
+		CreatedAt: raw.CreatedAt.UTC(),
+		UpdatedAt: raw.UpdatedAt.UTC(),
+	}
+	if raw.IdentityMissingAt != nil {
+		missingAt := raw.IdentityMissingAt.UTC()
+		customer.IdentityMissingAt = &missingAt
+	}
+	if err := json.Unmarshal(raw.Attributes, &customer.Attributes); err != nil {
+		return application.Customer{}, errors.Wrap(err, "failed to decode customer attributes")
 	}
 	return customer, nil
 }
 
-func (r *repository) Update(user application.Customer) error {
-	_, err := r.connPool.Exec(
-		"UPDATE customers SET first_name = $1, last_name = $2, email = $3, phone = $4 WHERE id = $5",
-		user.FirstName, user.LastName, user.Email, user.Phone, user.ID.String())
-	return r.convertError(err)
+// encodeAttributes returns the JSON object of the attributes, an empty one for nil.
+func encodeAttributes(attributes map[string]interface{}) ([]byte, error) {
+	if attributes == nil {
+		return []byte("{}"), nil
+	}
+	data, err := json.Marshal(attributes)
+	return data, errors.WithStack(err)
+}
+
+// inTx commits the writes of fn together with their change log record.
+func (r *repository) inTx(ctx context.Context, fn func(tx *pgx.Tx) error) error {
+	tx, err := r.connPool.BeginEx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return errors.WithStack(tx.CommitEx(ctx))
 }
 
 func (r *repository) convertError(err error) error {
@@ -0,0 +1,237 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+// segmentRebuildLockID lets a single instance rebuild the segments, see LockRebuilds.
+const segmentRebuildLockID = 7346120387
+
+const segmentColumns = "s.name, s.description, s.rule, s.rebuild_requested_at, s.created_at, s.updated_at, " +
+	"(SELECT count(*) FROM segment_members m WHERE m.segment_name = s.name)"
+
+type segmentRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewSegmentRepository(connPool *pgx.ConnPool) application.SegmentRepository {
+	return &segmentRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *segmentRepository) Segments(ctx context.Context) ([]application.Segment, error) {
+	query := "SELECT " + segmentColumns + " FROM segments s ORDER BY s.name"
+	ctx, span := startSpan(ctx, "Segments", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var segments []application.Segment
+	for rows.Next() {
+		segment, err := scanSegment(rows)
+		if err != nil {
+			return nil, endSpan(span, err)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+func (r *segmentRepository) Rules(ctx context.Context) (map[string]string, error) {
+	query := "SELECT name, rule FROM segments"
+	ctx, span := startSpan(ctx, "Rules", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	rules := make(map[string]string)
+	for rows.Next() {
+		var name, rule string
+		if err := rows.Scan(&name, &rule); err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		rules[name] = rule
+	}
+	return rules, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+func (r *segmentRepository) FindSegment(ctx context.Context, name string) (*application.Segment, error) {
+	query := "SELECT " + segmentColumns + " FROM segments s WHERE s.name = $1"
+	ctx, span := startSpan(ctx, "FindSegment", query)
+	defer span.End()
+	segment, err := scanSegment(r.connPool.QueryRowEx(ctx, query, nil, name))
+	if errors.Cause(err) == pgx.ErrNoRows {
+		return nil, endSpan(span, application.ErrSegmentNotFound)
+	}
+	if err != nil {
+		return nil, endSpan(span, err)
+	}
+	return &segment, endSpan(span, nil)
+}
+
+func (r *segmentRepository) SaveSegment(ctx context.Context, segment application.Segment) error {
+	query := "INSERT INTO segments (name, description, rule, created_at, updated_at, rebuild_requested_at) VALUES ($1, $2, $3, $4, $5, $5) " +
+		"ON CONFLICT (name) DO UPDATE SET description = $2, rule = $3, updated_at = $5, " +
+		"rebuild_requested_at = CASE WHEN segments.rule = $3 THEN segments.rebuild_requested_at ELSE $5 END"
+	ctx, span := startSpan(ctx, "SaveSegment", query)
+	defer span.End()
+	_, err := r.connPool.ExecEx(ctx, query, nil,
+		segment.Name, segment.Description, segment.Rule, segment.CreatedAt, segment.UpdatedAt)
+	return endSpan(span, errors.WithStack(err))
+}
+
+func (r *segmentRepository) RequestedRebuilds(ctx context.Context) ([]application.Segment, error) {
+	query := "SELECT " + segmentColumns + " FROM segments s WHERE s.rebuild_requested_at IS NOT NULL ORDER BY s.rebuild_requested_at"
+	ctx, span := startSpan(ctx, "RequestedRebuilds", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var segments []application.Segment
+	for rows.Next() {
+		segment, err := scanSegment(rows)
+		if err != nil {
+			return nil, endSpan(span, err)
+		}
+		segments = append(segments, segment)
+	}
+	return segments, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+// LockRebuilds holds a session advisory lock on a connection of its own, so the lock is released when the
+// instance dies in the middle of a rebuild.
+func (r *segmentRepository) LockRebuilds(ctx context.Context, rebuild func() error) (bool, error) {
+	conn, err := r.connPool.AcquireEx(ctx)
+	if err != nil {
+		return false, errors.Wrap(err, "failed to acquire connection")
+	}
+	defer r.connPool.Release(conn)
+
+	var locked bool
+	if err := conn.QueryRowEx(ctx, "SELECT pg_try_advisory_lock($1)", nil, segmentRebuildLockID).Scan(&locked); err != nil {
+		return false, errors.Wrap(err, "failed to acquire segment rebuild lock")
+	}
+	if !locked {
+		return false, nil
+	}
+	defer func() {
+		// the lock must be released even if ctx is done, the connection returns to the pool
+		_, _ = conn.Exec("SELECT pg_advisory_unlock($1)", segmentRebuildLockID)
+	}()
+	return true, rebuild()
+}
+
+func (r *segmentRepository) FinishRebuild(ctx context.Context, name string, requestedAt time.Time) error {
+	query := "UPDATE segments SET rebuild_requested_at = NULL WHERE name = $1 AND rebuild_requested_at = $2"
+	ctx, span := startSpan(ctx, "FinishRebuild", query)
+	defer span.End()
+	_, err := r.connPool.ExecEx(ctx, query, nil, name, requestedAt)
+	return endSpan(span, errors.WithStack(err))
+}
+
+func (r *segmentRepository) DeleteSegment(ctx context.Context, name string) error {
+	query := "DELETE FROM segments WHERE name = $1"
+	ctx, span := startSpan(ctx, "DeleteSegment", query)
+	defer span.End()
+	tag, err := r.connPool.ExecEx(ctx, query, nil, name)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrSegmentNotFound)
+	}
+	return endSpan(span, nil)
+}
+
+// SetMembership ignores a customer deleted in the meantime.
+func (r *segmentRepository) SetMembership(ctx context.Context, segment string, id application.CustomerID, member bool, at time.Time) error {
+	query := "DELETE FROM segment_members WHERE segment_name = $1 AND customer_id = $2"
+	args := []interface{}{segment, id.String()}
+	if member {
+		query = "INSERT INTO segment_members (segment_name, customer_id, joined_at) " +
+			"SELECT $1, id, $3 FROM customers WHERE id = $2 ON CONFLICT (segment_name, customer_id) DO NOTHING"
+		args = append(args, at)
+	}
+	ctx, span := startSpan(ctx, "SetMembership", query)
+	defer span.End()
+	_, err := r.connPool.ExecEx(ctx, query, nil, args...)
+	return endSpan(span, errors.WithStack(err))
+}
+
+func (r *segmentRepository) Members(ctx context.Context, segment string, after application.CustomerID, limit int) ([]application.SegmentMembership, error) {
+	query := "SELECT segment_name, customer_id, joined_at FROM segment_members WHERE segment_name = $1 AND customer_id > $2 ORDER BY customer_id LIMIT $3"
+	ctx, span := startSpan(ctx, "Members", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil, segment, after.String(), limit)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+	memberships, err := scanSegmentMemberships(rows)
+	return memberships, endSpan(span, err)
+}
+
+func (r *segmentRepository) SegmentsOf(ctx context.Context, id application.CustomerID) ([]application.SegmentMembership, error) {
+	query := "SELECT segment_name, customer_id, joined_at FROM segment_members WHERE customer_id = $1 ORDER BY segment_name"
+	ctx, span := startSpan(ctx, "SegmentsOf", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil, id.String())
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+	memberships, err := scanSegmentMemberships(rows)
+	return memberships, endSpan(span, err)
+}
+
+func scanSegment(row scanner) (application.Segment, error) {
+	var segment application.Segment
+	if err := row.Scan(&segment.Name, &segment.Description, &segment.Rule, &segment.RebuildRequestedAt,
+		&segment.CreatedAt, &segment.UpdatedAt, &segment.Members); err != nil {
+		return application.Segment{}, errors.WithStack(err)
+	}
+	segment.CreatedAt, segment.UpdatedAt = segment.CreatedAt.UTC(), segment.UpdatedAt.UTC()
+	if segment.RebuildRequestedAt != nil {
+		requestedAt := segment.RebuildRequestedAt.UTC()
+		segment.RebuildRequestedAt = &requestedAt
+	}
+	return segment, nil
+}
+
+func scanSegmentMemberships(rows *pgx.Rows) ([]application.SegmentMembership, error) {
+	var memberships []application.SegmentMembership
+	for rows.Next() {
+		var (
+			membership application.SegmentMembership
+			rawID      string
+		)
+		if err := rows.Scan(&membership.Segment, &rawID, &membership.JoinedAt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		id, err := uuid.FromString(rawID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		membership.CustomerID = application.CustomerID(id)
+		membership.JoinedAt = membership.JoinedAt.UTC()
+		memberships = append(memberships, membership)
+	}
+	return memberships, errors.WithStack(rows.Err())
+}
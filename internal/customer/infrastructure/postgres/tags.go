@@ -0,0 +1,88 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+type tagRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewTagRepository(connPool *pgx.ConnPool) application.TagRepository {
+	return &tagRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *tagRepository) TagsOf(ctx context.Context, id application.CustomerID) ([]string, error) {
+	query := "SELECT tag FROM customer_tags WHERE customer_id = $1 ORDER BY tag"
+	ctx, span := startSpan(ctx, "TagsOf", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil, id.String())
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		tags = append(tags, tag)
+	}
+	return tags, endSpan(span, errors.WithStack(rows.Err()))
+}
+
+func (r *tagRepository) AddTag(ctx context.Context, id application.CustomerID, tag string, taggedAt time.Time) (bool, error) {
+	query := "INSERT INTO customer_tags (customer_id, tag, tagged_at) VALUES ($1, $2, $3) ON CONFLICT (customer_id, tag) DO NOTHING"
+	ctx, span := startSpan(ctx, "AddTag", query)
+	defer span.End()
+	commandTag, err := r.connPool.ExecEx(ctx, query, nil, id.String(), tag, taggedAt)
+	if err != nil {
+		return false, endSpan(span, errors.WithStack(err))
+	}
+	return commandTag.RowsAffected() > 0, endSpan(span, nil)
+}
+
+func (r *tagRepository) RemoveTag(ctx context.Context, id application.CustomerID, tag string) error {
+	query := "DELETE FROM customer_tags WHERE customer_id = $1 AND tag = $2"
+	ctx, span := startSpan(ctx, "RemoveTag", query)
+	defer span.End()
+	commandTag, err := r.connPool.ExecEx(ctx, query, nil, id.String(), tag)
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if commandTag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrTagNotFound)
+	}
+	return endSpan(span, nil)
+}
+
+func (r *tagRepository) TagCounts(ctx context.Context) ([]application.TagCount, error) {
+	query := "SELECT tag, count(*) FROM customer_tags GROUP BY tag ORDER BY tag"
+	ctx, span := startSpan(ctx, "TagCounts", query)
+	defer span.End()
+	rows, err := r.connPool.QueryEx(ctx, query, nil)
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	defer rows.Close()
+
+	var counts []application.TagCount
+	for rows.Next() {
+		var count application.TagCount
+		if err := rows.Scan(&count.Tag, &count.Customers); err != nil {
+			return nil, endSpan(span, errors.WithStack(err))
+		}
+		counts = append(counts, count)
+	}
+	return counts, endSpan(span, errors.WithStack(rows.Err()))
+}
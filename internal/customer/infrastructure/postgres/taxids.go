@@ -0,0 +1,90 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+type taxIDRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewTaxIDRepository(connPool *pgx.ConnPool) application.TaxIDRepository {
+	return &taxIDRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *taxIDRepository) FindTaxID(ctx context.Context, holder application.TaxIDHolder) (*application.TaxID, error) {
+	table, column, err := taxIDTable(holder)
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf("SELECT type, value, country, status, checked_at, updated_at FROM %s WHERE %s = $1", table, column)
+	ctx, span := startSpan(ctx, "FindTaxID", query)
+	defer span.End()
+	var taxID application.TaxID
+	err = r.connPool.QueryRowEx(ctx, query, nil, holder.ID.String()).
+		Scan(&taxID.Type, &taxID.Value, &taxID.Country, &taxID.Status, &taxID.CheckedAt, &taxID.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, endSpan(span, nil)
+	}
+	if err != nil {
+		return nil, endSpan(span, errors.WithStack(err))
+	}
+	if taxID.CheckedAt != nil {
+		checkedAt := taxID.CheckedAt.UTC()
+		taxID.CheckedAt = &checkedAt
+	}
+	taxID.UpdatedAt = taxID.UpdatedAt.UTC()
+	return &taxID, endSpan(span, nil)
+}
+
+func (r *taxIDRepository) SaveTaxID(ctx context.Context, holder application.TaxIDHolder, taxID application.TaxID) error {
+	table, column, err := taxIDTable(holder)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("INSERT INTO %[1]s (%[2]s, type, value, country, status, checked_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7) "+
+		"ON CONFLICT (%[2]s) DO UPDATE SET type = $2, value = $3, country = $4, status = $5, checked_at = $6, updated_at = $7", table, column)
+	ctx, span := startSpan(ctx, "SaveTaxID", query)
+	defer span.End()
+	_, err = r.connPool.ExecEx(ctx, query, nil,
+		holder.ID.String(), taxID.Type, taxID.Value, taxID.Country, taxID.Status, taxID.CheckedAt, taxID.UpdatedAt)
+	return endSpan(span, errors.WithStack(err))
+}
+
+func (r *taxIDRepository) DeleteTaxID(ctx context.Context, holder application.TaxIDHolder) error {
+	table, column, err := taxIDTable(holder)
+	if err != nil {
+		return err
+	}
+	query := fmt.Sprintf("DELETE FROM %s WHERE %s = $1", table, column)
+	ctx, span := startSpan(ctx, "DeleteTaxID", query)
+	defer span.End()
+	tag, err := r.connPool.ExecEx(ctx, query, nil, holder.ID.String())
+	if err != nil {
+		return endSpan(span, errors.WithStack(err))
+	}
+	if tag.RowsAffected() == 0 {
+		return endSpan(span, application.ErrTaxIDNotFound)
+	}
+	return endSpan(span, nil)
+}
+
+// taxIDTable returns the table keeping the tax IDs of the holder and its key column.
+func taxIDTable(holder application.TaxIDHolder) (table, column string, err error) {
+	switch holder.Kind {
+	case application.TaxIDHolderCustomer:
+		return "customer_tax_ids", "customer_id", nil
+	case application.TaxIDHolderOrganization:
+		return "organization_tax_ids", "organization_id", nil
+	default:
+		return "", "", errors.Errorf("unknown tax id holder %q", holder.Kind)
+	}
+}
@@ -0,0 +1,30 @@
+package postgres
+
+import (
+	"context"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const tracerName = "github.com/jnikolaeva/customerservice/internal/customer/infrastructure/postgres"
+
+func startSpan(ctx context.Context, operation, query string) (context.Context, trace.Span) {
+	return otel.Tracer(tracerName).Start(ctx, "postgres."+operation,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.DBSystemPostgreSQL, semconv.DBStatement(query)))
+}
+
+// endSpan records the error on the span unless it is an expected outcome of the query.
+func endSpan(span trace.Span, err error) error {
+	if err != nil && !errors.Is(err, application.ErrCustomerNotFound) && !errors.Is(err, application.ErrDuplicateUser) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	return err
+}
@@ -0,0 +1,182 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const deliveryColumns = "id, subscription_id, event_type, payload, status, attempts, next_attempt_at, last_status_code, last_error, created_at, delivered_at"
+
+type webhookRepository struct {
+	connPool *pgx.ConnPool
+}
+
+func NewWebhookRepository(connPool *pgx.ConnPool) application.WebhookRepository {
+	return &webhookRepository{
+		connPool: connPool,
+	}
+}
+
+func (r *webhookRepository) AddSubscription(ctx context.Context, subscription application.WebhookSubscription) error {
+	_, err := r.connPool.ExecEx(ctx,
+		"INSERT INTO webhook_subscriptions (id, url, event_types, secret, created_at) VALUES ($1, $2, $3, $4, $5)", nil,
+		subscription.ID.String(), subscription.URL, subscription.EventTypes, subscription.Secret, subscription.CreatedAt)
+	return errors.WithStack(err)
+}
+
+func (r *webhookRepository) ListSubscriptions(ctx context.Context) ([]application.WebhookSubscription, error) {
+	return r.querySubscriptions(ctx, "SELECT id, url, event_types, secret, created_at FROM webhook_subscriptions ORDER BY created_at")
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.connPool.ExecEx(ctx, "DELETE FROM webhook_subscriptions WHERE id = $1", nil, id.String())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return application.ErrWebhookNotFound
+	}
+	return nil
+}
+
+// addWebhookDeliveries saves the deliveries of the event in the transaction of the change.
+func addWebhookDeliveries(ctx context.Context, tx *pgx.Tx, event application.Event) error {
+	rows, err := tx.QueryEx(ctx, "SELECT id, url, event_types, secret, created_at FROM webhook_subscriptions WHERE $1 = ANY(event_types)", nil,
+		event.EventType())
+	if err != nil {
+		return errors.Wrap(err, "failed to find webhook subscriptions")
+	}
+	subscriptions, err := scanSubscriptions(rows)
+	if err != nil {
+		return err
+	}
+	deliveries, err := application.NewWebhookDeliveries(event, subscriptions)
+	if err != nil {
+		return err
+	}
+	for _, d := range deliveries {
+		if _, err := tx.ExecEx(ctx,
+			"INSERT INTO webhook_deliveries (id, subscription_id, event_type, payload, status, next_attempt_at, created_at) VALUES ($1, $2, $3, $4, $5, $6, $7)", nil,
+			d.ID.String(), d.SubscriptionID.String(), d.EventType, d.Payload, d.Status, d.NextAttemptAt, d.CreatedAt); err != nil {
+			return errors.Wrap(err, "failed to add webhook delivery")
+		}
+	}
+	return nil
+}
+
+func (r *webhookRepository) ClaimDue(ctx context.Context, limit int, lease time.Duration) ([]application.ClaimedDelivery, error) {
+	rows, err := r.connPool.QueryEx(ctx, `
+		UPDATE webhook_deliveries d SET next_attempt_at = now() + $2::bigint * interval '1 millisecond'
+		FROM webhook_subscriptions s
+		WHERE s.id = d.subscription_id AND d.id IN (
+			SELECT id FROM webhook_deliveries WHERE status = 'pending' AND next_attempt_at <= now()
+			ORDER BY next_attempt_at LIMIT $1 FOR UPDATE SKIP LOCKED)
+		RETURNING d.id, d.subscription_id, d.event_type, d.payload, d.status, d.attempts, d.next_attempt_at,
+			d.last_status_code, d.last_error, d.created_at, d.delivered_at, s.url, s.secret`, nil,
+		limit, lease.Milliseconds())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var claimed []application.ClaimedDelivery
+	for rows.Next() {
+		var c application.ClaimedDelivery
+		if err := scanDelivery(rows, &c.WebhookDelivery, &c.URL, &c.Secret); err != nil {
+			return nil, err
+		}
+		claimed = append(claimed, c)
+	}
+	return claimed, errors.WithStack(rows.Err())
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, d application.WebhookDelivery) error {
+	_, err := r.connPool.ExecEx(ctx,
+		"UPDATE webhook_deliveries SET status = $1, attempts = $2, next_attempt_at = $3, last_status_code = $4, last_error = $5, delivered_at = $6 WHERE id = $7", nil,
+		d.Status, d.Attempts, d.NextAttemptAt, d.LastStatusCode, d.LastError, d.DeliveredAt, d.ID.String())
+	return errors.WithStack(err)
+}
+
+func (r *webhookRepository) ListDeliveries(ctx context.Context, subscriptionID uuid.UUID, status string, limit int) ([]application.WebhookDelivery, error) {
+	rows, err := r.connPool.QueryEx(ctx,
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE subscription_id = $1 AND ($2 = '' OR status = $2) ORDER BY created_at DESC LIMIT $3", nil,
+		subscriptionID.String(), status, limit)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer rows.Close()
+
+	var deliveries []application.WebhookDelivery
+	for rows.Next() {
+		var d application.WebhookDelivery
+		if err := scanDelivery(rows, &d); err != nil {
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, errors.WithStack(rows.Err())
+}
+
+func (r *webhookRepository) Redeliver(ctx context.Context, id uuid.UUID) error {
+	tag, err := r.connPool.ExecEx(ctx,
+		"UPDATE webhook_deliveries SET status = 'pending', attempts = 0, next_attempt_at = now(), delivered_at = NULL WHERE id = $1", nil,
+		id.String())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if tag.RowsAffected() == 0 {
+		return application.ErrWebhookNotFound
+	}
+	return nil
+}
+
+func (r *webhookRepository) querySubscriptions(ctx context.Context, query string, args ...interface{}) ([]application.WebhookSubscription, error) {
+	rows, err := r.connPool.QueryEx(ctx, query, nil, args...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return scanSubscriptions(rows)
+}
+
+func scanSubscriptions(rows *pgx.Rows) ([]application.WebhookSubscription, error) {
+	defer rows.Close()
+
+	var subscriptions []application.WebhookSubscription
+	for rows.Next() {
+		var (
+			s     application.WebhookSubscription
+			rawID string
+			err   error
+		)
+		if err := rows.Scan(&rawID, &s.URL, &s.EventTypes, &s.Secret, &s.CreatedAt); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if s.ID, err = uuid.FromString(rawID); err != nil {
+			return nil, errors.WithStack(err)
+		}
+		subscriptions = append(subscriptions, s)
+	}
+	return subscriptions, errors.WithStack(rows.Err())
+}
+
+// scanDelivery scans the delivery columns followed by extra destinations.
+func scanDelivery(row scanner, d *application.WebhookDelivery, extra ...interface{}) error {
+	var rawID, rawSubscriptionID string
+	dest := append([]interface{}{&rawID, &rawSubscriptionID, &d.EventType, &d.Payload, &d.Status, &d.Attempts,
+		&d.NextAttemptAt, &d.LastStatusCode, &d.LastError, &d.CreatedAt, &d.DeliveredAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return errors.WithStack(err)
+	}
+	var err error
+	if d.ID, err = uuid.FromString(rawID); err != nil {
+		return errors.WithStack(err)
+	}
+	d.SubscriptionID, err = uuid.FromString(rawSubscriptionID)
+	return errors.WithStack(err)
+}
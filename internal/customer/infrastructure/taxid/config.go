@@ -0,0 +1,34 @@
+package taxid
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+const (
+	// BackendNone keeps tax IDs unverified after their offline validation.
+	BackendNone = "none"
+	// BackendStub accepts every EU and UK VAT number, for development and tests only.
+	BackendStub = "stub"
+)
+
+type Config struct {
+	Verifier string `envconfig:"TAX_ID_VERIFIER" default:"none"`
+	// Timeout bounds a verification, a registry answering later is recorded as unavailable.
+	Timeout time.Duration `envconfig:"TAX_ID_VERIFY_TIMEOUT" default:"5s"`
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse tax id environment config values")
+	}
+	switch config.Verifier {
+	case BackendNone, BackendStub:
+	default:
+		return Config{}, errors.Errorf("unknown tax id verifier: %s", config.Verifier)
+	}
+	return config, nil
+}
@@ -0,0 +1,50 @@
+package taxid
+
+import (
+	"context"
+	"time"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+// NewVerifier returns the verifier of the configured backend, bounded by the timeout.
+func NewVerifier(config Config) application.TaxIDVerifier {
+	var verifier application.TaxIDVerifier = noneVerifier{}
+	if config.Verifier == BackendStub {
+		verifier = stubVerifier{}
+	}
+	return &timeoutVerifier{
+		verifier: verifier,
+		timeout:  config.Timeout,
+	}
+}
+
+type noneVerifier struct{}
+
+func (noneVerifier) Verify(context.Context, application.TaxID) (string, error) {
+	return "", application.ErrTaxIDVerificationUnsupported
+}
+
+// stubVerifier answers like VIES and the HMRC VAT API would for registered numbers,
+// without calling them. The other types are not supported.
+type stubVerifier struct{}
+
+func (stubVerifier) Verify(ctx context.Context, taxID application.TaxID) (string, error) {
+	switch taxID.Type {
+	case application.TaxIDTypeEUVAT, application.TaxIDTypeGBVAT:
+		return application.TaxIDStatusValid, ctx.Err()
+	default:
+		return "", application.ErrTaxIDVerificationUnsupported
+	}
+}
+
+type timeoutVerifier struct {
+	verifier application.TaxIDVerifier
+	timeout  time.Duration
+}
+
+func (v *timeoutVerifier) Verify(ctx context.Context, taxID application.TaxID) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, v.timeout)
+	defer cancel()
+	return v.verifier.Verify(ctx, taxID)
+}
@@ -0,0 +1,322 @@
+package transport
+
+import (
+	"context"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	gokithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/jnikolaeva/eshop-common/httpkit"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/bulk"
+	"github.com/jnikolaeva/customerservice/internal/logging"
+)
+
+// maxImportBodySize bounds an uploaded import file, larger files are imported with the CLI.
+const maxImportBodySize = 64 << 20
+
+type AdminEndpoints struct {
+	ImportCustomers  endpoint.Endpoint
+	ExportCustomers  endpoint.Endpoint
+	ChangeStatus     endpoint.Endpoint
+	GetStatusHistory endpoint.Endpoint
+	MergeCustomers   endpoint.Endpoint
+
+	CreateWebhook            endpoint.Endpoint
+	ListWebhooks             endpoint.Endpoint
+	DeleteWebhook            endpoint.Endpoint
+	ListWebhookDeliveries    endpoint.Endpoint
+	RedeliverWebhookDelivery endpoint.Endpoint
+
+	ListConsentingCustomers endpoint.Endpoint
+
+	ListDuplicates        endpoint.Endpoint
+	ListDuplicateClusters endpoint.Endpoint
+
+	ListCustomers            endpoint.Endpoint
+	ListAttributeDefinitions endpoint.Endpoint
+	DefineAttribute          endpoint.Endpoint
+	DeleteAttribute          endpoint.Endpoint
+
+	ListTags             endpoint.Endpoint
+	GetCustomerTags      endpoint.Endpoint
+	TagCustomer          endpoint.Endpoint
+	UntagCustomer        endpoint.Endpoint
+	ListSegments         endpoint.Endpoint
+	GetSegment           endpoint.Endpoint
+	DefineSegment        endpoint.Endpoint
+	DeleteSegment        endpoint.Endpoint
+	ListSegmentMembers   endpoint.Endpoint
+	ListCustomerSegments endpoint.Endpoint
+}
+
+func MakeAdminEndpoints(s application.Service, importer *application.Importer, exporter *application.Exporter, webhooks *application.Webhooks, consents *application.Consents,
+	duplicates *application.Duplicates, attributes *application.Attributes, tags *application.Tags, segments *application.Segments) AdminEndpoints {
+	return AdminEndpoints{
+		ImportCustomers:  makeImportCustomersEndpoint(importer),
+		ExportCustomers:  makeExportCustomersEndpoint(exporter),
+		ChangeStatus:     makeChangeStatusEndpoint(s),
+		GetStatusHistory: makeGetStatusHistoryEndpoint(s),
+		MergeCustomers:   makeMergeCustomersEndpoint(s),
+
+		CreateWebhook:            makeCreateWebhookEndpoint(webhooks),
+		ListWebhooks:             makeListWebhooksEndpoint(webhooks),
+		DeleteWebhook:            makeDeleteWebhookEndpoint(webhooks),
+		ListWebhookDeliveries:    makeListWebhookDeliveriesEndpoint(webhooks),
+		RedeliverWebhookDelivery: makeRedeliverWebhookEndpoint(webhooks),
+
+		ListConsentingCustomers: makeListConsentingCustomersEndpoint(consents),
+
+		ListDuplicates:        makeListDuplicatesEndpoint(duplicates),
+		ListDuplicateClusters: makeListDuplicateClustersEndpoint(duplicates),
+
+		ListCustomers:            makeListCustomersEndpoint(attributes),
+		ListAttributeDefinitions: makeListAttributeDefinitionsEndpoint(attributes),
+		DefineAttribute:          makeDefineAttributeEndpoint(attributes),
+		DeleteAttribute:          makeDeleteAttributeDefinitionEndpoint(attributes),
+
+		ListTags:             makeListTagsEndpoint(tags),
+		GetCustomerTags:      makeGetCustomerTagsEndpoint(tags),
+		TagCustomer:          makeTagCustomerEndpoint(tags),
+		UntagCustomer:        makeUntagCustomerEndpoint(tags),
+		ListSegments:         makeListSegmentsEndpoint(segments),
+		GetSegment:           makeGetSegmentEndpoint(segments),
+		DefineSegment:        makeDefineSegmentEndpoint(segments),
+		DeleteSegment:        makeDeleteSegmentEndpoint(segments),
+		ListSegmentMembers:   makeListSegmentMembersEndpoint(segments),
+		ListCustomerSegments: makeListCustomerSegmentsEndpoint(segments),
+	}
+}
+
+func makeImportCustomersEndpoint(importer *application.Importer) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(importCustomersRequest)
+		report, err := importer.Import(ctx, req.source, req.options)
+		if err != nil {
+			if report == nil {
+				return nil, err
+			}
+			// the client resumes from the checkpoint of the partial report
+			return &importCustomersResponse{ImportReport: report, Error: err.Error()}, nil
+		}
+		return &importCustomersResponse{ImportReport: report}, nil
+	}
+}
+
+// makeExportCustomersEndpoint defers the export to the response encoder, which streams it.
+func makeExportCustomersEndpoint(exporter *application.Exporter) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(exportCustomersRequest)
+		return exportCustomersResponse{exporter: exporter, format: req.format, options: req.options}, nil
+	}
+}
+
+// MakeAdminHandler serves the operator API. The caller must have the admin role.
+func MakeAdminHandler(pathPrefix string, endpoints AdminEndpoints, logger *logrus.Logger, metrics *httpkit.MetricsHolder) http.Handler {
+	options := []gokithttp.ServerOption{
+		gokithttp.ServerErrorEncoder(encodeErrorResponse),
+		gokithttp.ServerErrorHandler(logging.NewErrorHandler(logger)),
+	}
+
+	importCustomersHandler := gokithttp.NewServer(endpoints.ImportCustomers, decodeImportCustomersRequest, encodeResponse, options...)
+	exportCustomersHandler := gokithttp.NewServer(endpoints.ExportCustomers, decodeExportCustomersRequest, encodeExportCustomersResponse(logger), options...)
+	changeStatusHandler := gokithttp.NewServer(endpoints.ChangeStatus, decodeChangeStatusRequest, encodeResponse, options...)
+	getStatusHistoryHandler := gokithttp.NewServer(endpoints.GetStatusHistory, decodeStatusHistoryRequest, encodeResponse, options...)
+	mergeCustomersHandler := gokithttp.NewServer(endpoints.MergeCustomers, decodeMergeCustomersRequest, encodeResponse, options...)
+	createWebhookHandler := gokithttp.NewServer(endpoints.CreateWebhook, decodeCreateWebhookRequest, encodeResponse, options...)
+	listWebhooksHandler := gokithttp.NewServer(endpoints.ListWebhooks, decodeListWebhooksRequest, encodeResponse, options...)
+	deleteWebhookHandler := gokithttp.NewServer(endpoints.DeleteWebhook, decodeWebhookRequest, encodeResponse, options...)
+	listWebhookDeliveriesHandler := gokithttp.NewServer(endpoints.ListWebhookDeliveries, decodeListWebhookDeliveriesRequest, encodeResponse, options...)
+	redeliverWebhookDeliveryHandler := gokithttp.NewServer(endpoints.RedeliverWebhookDelivery, decodeWebhookRequest, encodeResponse, options...)
+
+	listConsentingCustomersHandler := gokithttp.NewServer(endpoints.ListConsentingCustomers, decodeListConsentingCustomersRequest, encodeResponse, options...)
+
+	listDuplicatesHandler := gokithttp.NewServer(endpoints.ListDuplicates, decodeListDuplicatesRequest, encodeResponse, options...)
+	listDuplicateClustersHandler := gokithttp.NewServer(endpoints.ListDuplicateClusters, decodeListDuplicateClustersRequest, encodeResponse, options...)
+
+	listCustomersHandler := gokithttp.NewServer(endpoints.ListCustomers, decodeListCustomersRequest, encodeResponse, options...)
+	listAttributeDefinitionsHandler := gokithttp.NewServer(endpoints.ListAttributeDefinitions, decodeListAttributeDefinitionsRequest, encodeResponse, options...)
+	defineAttributeHandler := gokithttp.NewServer(endpoints.DefineAttribute, decodeDefineAttributeRequest, encodeResponse, options...)
+	deleteAttributeHandler := gokithttp.NewServer(endpoints.DeleteAttribute, decodeAttributeDefinitionRequest, encodeResponse, options...)
+
+	listTagsHandler := gokithttp.NewServer(endpoints.ListTags, decodeListTagsRequest, encodeResponse, options...)
+	getCustomerTagsHandler := gokithttp.NewServer(endpoints.GetCustomerTags, decodeCustomerTagsRequest, encodeResponse, options...)
+	tagCustomerHandler := gokithttp.NewServer(endpoints.TagCustomer, decodeCustomerTagRequest, encodeResponse, options...)
+	untagCustomerHandler := gokithttp.NewServer(endpoints.UntagCustomer, decodeCustomerTagRequest, encodeResponse, options...)
+	listSegmentsHandler := gokithttp.NewServer(endpoints.ListSegments, decodeListSegmentsRequest, encodeResponse, options...)
+	getSegmentHandler := gokithttp.NewServer(endpoints.GetSegment, decodeSegmentRequest, encodeResponse, options...)
+	defineSegmentHandler := gokithttp.NewServer(endpoints.DefineSegment, decodeDefineSegmentRequest, encodeAcceptedResponse, options...)
+	deleteSegmentHandler := gokithttp.NewServer(endpoints.DeleteSegment, decodeSegmentRequest, encodeResponse, options...)
+	listSegmentMembersHandler := gokithttp.NewServer(endpoints.ListSegmentMembers, decodeListSegmentMembersRequest, encodeResponse, options...)
+	listCustomerSegmentsHandler := gokithttp.NewServer(endpoints.ListCustomerSegments, decodeCustomerSegmentsRequest, encodeResponse, options...)
+
+	r := mux.NewRouter()
+	s := r.PathPrefix(pathPrefix).Subrouter()
+	s.Handle("/customers", instrument(authMiddleware(listCustomersHandler), metrics, "ListCustomers")).Methods(http.MethodGet)
+	s.Handle("/customers/import", instrument(authMiddleware(limitBody(importCustomersHandler, maxImportBodySize)), metrics, "ImportCustomers")).Methods(http.MethodPost)
+	s.Handle("/customers/export", withoutWriteDeadline(instrument(authMiddleware(exportCustomersHandler), metrics, "ExportCustomers"), logger)).Methods(http.MethodGet)
+	s.Handle("/customers/merge", instrument(authMiddleware(mergeCustomersHandler), metrics, "MergeCustomers")).Methods(http.MethodPost)
+	s.Handle("/customers/{userId}/status", instrument(authMiddleware(changeStatusHandler), metrics, "ChangeStatus")).Methods(http.MethodPut)
+	s.Handle("/customers/{userId}/status/history", instrument(authMiddleware(getStatusHistoryHandler), metrics, "GetStatusHistory")).Methods(http.MethodGet)
+	s.Handle("/webhooks", instrument(authMiddleware(createWebhookHandler), metrics, "CreateWebhook")).Methods(http.MethodPost)
+	s.Handle("/webhooks", instrument(authMiddleware(listWebhooksHandler), metrics, "ListWebhooks")).Methods(http.MethodGet)
+	s.Handle("/webhooks/deliveries/{id}/redeliver", instrument(authMiddleware(redeliverWebhookDeliveryHandler), metrics, "RedeliverWebhookDelivery")).Methods(http.MethodPost)
+	s.Handle("/webhooks/{id}", instrument(authMiddleware(deleteWebhookHandler), metrics, "DeleteWebhook")).Methods(http.MethodDelete)
+	s.Handle("/webhooks/{id}/deliveries", instrument(authMiddleware(listWebhookDeliveriesHandler), metrics, "ListWebhookDeliveries")).Methods(http.MethodGet)
+	s.Handle("/consents/customers", instrument(authMiddleware(listConsentingCustomersHandler), metrics, "ListConsentingCustomers")).Methods(http.MethodGet)
+	s.Handle("/customers/{userId}/duplicates", instrument(authMiddleware(listDuplicatesHandler), metrics, "ListDuplicates")).Methods(http.MethodGet)
+	s.Handle("/duplicates/clusters", instrument(authMiddleware(listDuplicateClustersHandler), metrics, "ListDuplicateClusters")).Methods(http.MethodGet)
+	s.Handle("/attributes", instrument(authMiddleware(listAttributeDefinitionsHandler), metrics, "ListAttributeDefinitions")).Methods(http.MethodGet)
+	s.Handle("/attributes/{name}", instrument(authMiddleware(defineAttributeHandler), metrics, "DefineAttribute")).Methods(http.MethodPut)
+	s.Handle("/attributes/{name}", instrument(authMiddleware(deleteAttributeHandler), metrics, "DeleteAttribute")).Methods(http.MethodDelete)
+	s.Handle("/tags", instrument(authMiddleware(listTagsHandler), metrics, "ListTags")).Methods(http.MethodGet)
+	s.Handle("/customers/{userId}/tags", instrument(authMiddleware(getCustomerTagsHandler), metrics, "GetCustomerTags")).Methods(http.MethodGet)
+	s.Handle("/customers/{userId}/tags/{tag}", instrument(authMiddleware(tagCustomerHandler), metrics, "TagCustomer")).Methods(http.MethodPut)
+	s.Handle("/customers/{userId}/tags/{tag}", instrument(authMiddleware(untagCustomerHandler), metrics, "UntagCustomer")).Methods(http.MethodDelete)
+	s.Handle("/customers/{userId}/segments", instrument(authMiddleware(listCustomerSegmentsHandler), metrics, "ListCustomerSegments")).Methods(http.MethodGet)
+	s.Handle("/segments", instrument(authMiddleware(listSegmentsHandler), metrics, "ListSegments")).Methods(http.MethodGet)
+	s.Handle("/segments/{name}", instrument(authMiddleware(getSegmentHandler), metrics, "GetSegment")).Methods(http.MethodGet)
+	s.Handle("/segments/{name}", instrument(authMiddleware(defineSegmentHandler), metrics, "DefineSegment")).Methods(http.MethodPut)
+	s.Handle("/segments/{name}", instrument(authMiddleware(deleteSegmentHandler), metrics, "DeleteSegment")).Methods(http.MethodDelete)
+	s.Handle("/segments/{name}/customers", instrument(authMiddleware(listSegmentMembersHandler), metrics, "ListSegmentMembers")).Methods(http.MethodGet)
+	return r
+}
+
+func limitBody(next http.Handler, size int64) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.Body = http.MaxBytesReader(w, r.Body, size)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeImportCustomersRequest takes the format from the query or the content type,
+// the body is read while the import runs.
+func decodeImportCustomersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	format := query.Get("format")
+	if format == "" {
+		mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		switch mediaType {
+		case "text/csv":
+			format = bulk.FormatCSV
+		case "application/x-ndjson":
+			format = bulk.FormatNDJSON
+		}
+	}
+	source, err := bulk.NewImportSource(format, r.Body)
+	if err != nil {
+		return nil, errors.WithMessage(ErrBadRequest, err.Error())
+	}
+
+	req := importCustomersRequest{source: source}
+	for name, target := range map[string]*bool{
+		"dryRun":              &req.options.DryRun,
+		"provisionIdentities": &req.options.ProvisionIdentities,
+	} {
+		if value := query.Get(name); value != "" {
+			if *target, err = strconv.ParseBool(value); err != nil {
+				return nil, errors.WithMessagef(ErrBadRequest, "invalid parameter '%s'", name)
+			}
+		}
+	}
+	for name, target := range map[string]*int{
+		"resumeAfter": &req.options.ResumeAfter,
+		"batchSize":   &req.options.BatchSize,
+		"concurrency": &req.options.Concurrency,
+	} {
+		if value := query.Get(name); value != "" {
+			if *target, err = strconv.Atoi(value); err != nil || *target < 0 {
+				return nil, errors.WithMessagef(ErrBadRequest, "invalid parameter '%s'", name)
+			}
+		}
+	}
+	return req, nil
+}
+
+func decodeExportCustomersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	req := exportCustomersRequest{format: query.Get("format")}
+	if req.format == "" {
+		req.format = bulk.FormatNDJSON
+	}
+	if _, err := bulk.NewExportWriter(req.format, io.Discard); err != nil {
+		return nil, errors.WithMessage(ErrBadRequest, err.Error())
+	}
+	for name, target := range map[string]*time.Time{
+		"updatedSince":  &req.options.Filter.UpdatedSince,
+		"updatedBefore": &req.options.Filter.UpdatedBefore,
+	} {
+		if value := query.Get(name); value != "" {
+			if *target, err = time.Parse(time.RFC3339, value); err != nil {
+				return nil, errors.WithMessagef(ErrBadRequest, "invalid parameter '%s', expected RFC 3339 time", name)
+			}
+		}
+	}
+	if req.options.Redact, err = application.ParseRedaction(query.Get("redact")); err != nil {
+		return nil, errors.WithMessage(ErrBadRequest, err.Error())
+	}
+	return req, nil
+}
+
+// encodeExportCustomersResponse streams the export. Errors before the first write get an error response,
+// a failure in the middle aborts the response so that the client does not take it for complete.
+func encodeExportCustomersResponse(logger *logrus.Logger) gokithttp.EncodeResponseFunc {
+	return func(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+		resp := response.(exportCustomersResponse)
+		writer := &lazyExportWriter{format: resp.format, w: w}
+		if _, err := resp.exporter.Export(ctx, writer, resp.options); err != nil {
+			if !writer.started {
+				return err
+			}
+			logging.FromContext(ctx, logger).WithError(err).Error("export aborted")
+			panic(http.ErrAbortHandler)
+		}
+		return nil
+	}
+}
+
+// lazyExportWriter sends the headers with the first customer, until then an error response is still possible.
+type lazyExportWriter struct {
+	format  string
+	w       http.ResponseWriter
+	writer  application.CustomerWriter
+	started bool
+}
+
+func (l *lazyExportWriter) Write(customer application.Customer) error {
+	if err := l.start(); err != nil {
+		return err
+	}
+	return l.writer.Write(customer)
+}
+
+func (l *lazyExportWriter) Close() error {
+	if err := l.start(); err != nil {
+		return err
+	}
+	return l.writer.Close()
+}
+
+func (l *lazyExportWriter) start() error {
+	if l.started {
+		return nil
+	}
+	l.started = true
+	writer, err := bulk.NewExportWriter(l.format, l.w)
+	if err != nil {
+		return err
+	}
+	l.writer = writer
+	l.w.Header().Set("Content-Type", bulk.ContentType(l.format))
+	l.w.Header().Set("Content-Disposition", `attachment; filename="customers.`+l.format+`"`)
+	l.w.WriteHeader(http.StatusOK)
+	return nil
+}
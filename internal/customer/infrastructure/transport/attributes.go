@@ -0,0 +1,254 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+// attributeFilterPrefix marks the query parameters of the customer listing which filter by an attribute, e.g. attr.tier=gold.
+const attributeFilterPrefix = "attr."
+
+func makeGetAttributesEndpoint(attributes *application.Attributes) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(attributesRequest)
+		values, err := attributes.Get(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return &attributesResponse{Attributes: values}, nil
+	}
+}
+
+func makeUpdateAttributesEndpoint(attributes *application.Attributes) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateAttributesRequest)
+		values, err := attributes.Update(ctx, req.ID, req.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		return &attributesResponse{Attributes: values}, nil
+	}
+}
+
+func makeListAttributeDefinitionsEndpoint(attributes *application.Attributes) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		definitions, err := attributes.Definitions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		response := &attributeDefinitionsResponse{Attributes: make([]attributeDefinitionData, 0, len(definitions))}
+		for _, definition := range definitions {
+			response.Attributes = append(response.Attributes, toAttributeDefinitionData(definition))
+		}
+		return response, nil
+	}
+}
+
+func makeDefineAttributeEndpoint(attributes *application.Attributes) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(attributeDefinitionData)
+		definition, err := attributes.Define(ctx, application.AttributeDefinition{
+			Name:        req.Name,
+			Type:        req.Type,
+			Description: req.Description,
+			Visibility:  req.Visibility,
+			Searchable:  req.Searchable,
+			Validation: application.AttributeValidation{
+				Pattern:   req.Validation.Pattern,
+				MinLength: req.Validation.MinLength,
+				MaxLength: req.Validation.MaxLength,
+				Min:       req.Validation.Min,
+				Max:       req.Validation.Max,
+				Values:    req.Validation.Values,
+			},
+		})
+		if err != nil {
+			return nil, err
+		}
+		data := toAttributeDefinitionData(*definition)
+		return &data, nil
+	}
+}
+
+func makeDeleteAttributeDefinitionEndpoint(attributes *application.Attributes) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(attributeDefinitionRequest)
+		return nil, attributes.DeleteDefinition(ctx, req.Name)
+	}
+}
+
+func makeListCustomersEndpoint(attributes *application.Attributes) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listCustomersRequest)
+		customers, err := attributes.Search(ctx, req.Filters, req.After, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		response := &listCustomersResponse{Customers: make([]adminUserData, 0, len(customers))}
+		for _, customer := range customers {
+			response.Customers = append(response.Customers, adminUserData{
+				userData:          toUserData(customer),
+				IdentityMissingAt: customer.IdentityMissingAt,
+			})
+		}
+		if len(customers) > 0 {
+			response.Next = customers[len(customers)-1].ID.String()
+		}
+		return response, nil
+	}
+}
+
+func toAttributeDefinitionData(d application.AttributeDefinition) attributeDefinitionData {
+	createdAt, updatedAt := d.CreatedAt, d.UpdatedAt
+	return attributeDefinitionData{
+		Name:        d.Name,
+		Type:        d.Type,
+		Description: d.Description,
+		Visibility:  d.Visibility,
+		Searchable:  d.Searchable,
+		Validation: attributeValidationData{
+			Pattern:   d.Validation.Pattern,
+			MinLength: d.Validation.MinLength,
+			MaxLength: d.Validation.MaxLength,
+			Min:       d.Validation.Min,
+			Max:       d.Validation.Max,
+			Values:    d.Validation.Values,
+		},
+		CreatedAt: &createdAt,
+		UpdatedAt: &updatedAt,
+	}
+}
+
+func decodeAttributesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return attributesRequest{ID: id}, nil
+}
+
+func decodeUpdateAttributesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	req := updateAttributesRequest{ID: id}
+	if e := json.NewDecoder(r.Body).Decode(&req.Attributes); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	return req, nil
+}
+
+func decodeListAttributeDefinitionsRequest(_ context.Context, _ *http.Request) (request interface{}, err error) {
+	return nil, nil
+}
+
+// decodeDefineAttributeRequest takes the name from the path, a name in the body is ignored.
+func decodeDefineAttributeRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	name, err := decodeAttributeDefinitionRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	var req attributeDefinitionData
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	req.Name = name.(attributeDefinitionRequest).Name
+	return req, nil
+}
+
+func decodeAttributeDefinitionRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	name, ok := mux.Vars(r)["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return attributeDefinitionRequest{Name: name}, nil
+}
+
+func decodeListCustomersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	req := listCustomersRequest{Filters: map[string]string{}}
+	for key, values := range query {
+		if name := strings.TrimPrefix(key, attributeFilterPrefix); name != key {
+			req.Filters[name] = values[0]
+		}
+	}
+	if value := query.Get("after"); value != "" {
+		after, err := uuid.FromString(value)
+		if err != nil {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'after'")
+		}
+		req.After = application.CustomerID(after)
+	}
+	if value := query.Get("limit"); value != "" {
+		if req.Limit, err = strconv.Atoi(value); err != nil || req.Limit < 0 {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'limit'")
+		}
+	}
+	return req, nil
+}
+
+type attributesRequest struct {
+	ID uuid.UUID
+}
+
+type updateAttributesRequest struct {
+	ID         uuid.UUID
+	Attributes map[string]interface{}
+}
+
+type attributesResponse struct {
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+type attributeDefinitionRequest struct {
+	Name string
+}
+
+type attributeDefinitionsResponse struct {
+	Attributes []attributeDefinitionData `json:"attributes"`
+}
+
+type attributeDefinitionData struct {
+	Name        string                  `json:"name"`
+	Type        string                  `json:"type"`
+	Description string                  `json:"description,omitempty"`
+	Visibility  string                  `json:"visibility"`
+	Searchable  bool                    `json:"searchable"`
+	Validation  attributeValidationData `json:"validation"`
+	CreatedAt   *time.Time              `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time              `json:"updatedAt,omitempty"`
+}
+
+type attributeValidationData struct {
+	Pattern   string   `json:"pattern,omitempty"`
+	MinLength *int     `json:"minLength,omitempty"`
+	MaxLength *int     `json:"maxLength,omitempty"`
+	Min       *float64 `json:"min,omitempty"`
+	Max       *float64 `json:"max,omitempty"`
+	Values    []string `json:"values,omitempty"`
+}
+
+type listCustomersRequest struct {
+	Filters map[string]string
+	After   application.CustomerID
+	Limit   int
+}
+
+type listCustomersResponse struct {
+	Customers []adminUserData `json:"customers"`
+	// Next is the value of 'after' for the next page, empty when the page is empty.
+	Next string `json:"next,omitempty"`
+}
@@ -0,0 +1,167 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/logging"
+)
+
+const (
+	eventStreamMediaType = "text/event-stream"
+	// streamHeartbeat is the longest silence of an event stream, to keep proxies from closing it.
+	streamHeartbeat = 15 * time.Second
+	streamBatchSize = 100
+)
+
+func makeListChangesEndpoint(feed *application.ChangeFeed) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listChangesRequest)
+		changes, err := feed.Changes(ctx, req.After, req.Limit, req.Wait)
+		if err != nil {
+			return nil, err
+		}
+		response := &listChangesResponse{Changes: make([]changeData, 0, len(changes)), Next: formatCursor(req.After)}
+		for _, change := range changes {
+			response.Changes = append(response.Changes, toChangeData(change))
+		}
+		if len(changes) > 0 {
+			response.Next = formatCursor(changes[len(changes)-1].Sequence)
+		}
+		return response, nil
+	}
+}
+
+func toChangeData(change application.Change) changeData {
+	data := changeData{
+		Cursor:     formatCursor(change.Sequence),
+		Type:       change.EventType,
+		CustomerID: change.CustomerID.String(),
+		OccurredAt: change.OccurredAt,
+	}
+	if change.Customer != nil {
+		customer := toUserData(*change.Customer)
+		data.Customer = &customer
+	}
+	return data
+}
+
+// Cursors are sequences of the change log, clients must treat them as opaque.
+func formatCursor(sequence int64) string {
+	return strconv.FormatInt(sequence, 10)
+}
+
+func parseCursor(cursor string) (int64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	sequence, err := strconv.ParseInt(cursor, 10, 64)
+	if err != nil || sequence < 0 {
+		return 0, errors.WithMessage(ErrBadRequest, "invalid cursor")
+	}
+	return sequence, nil
+}
+
+func decodeListChangesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	var req listChangesRequest
+	if req.After, err = parseCursor(query.Get("after")); err != nil {
+		return nil, err
+	}
+	if value := query.Get("limit"); value != "" {
+		if req.Limit, err = strconv.Atoi(value); err != nil || req.Limit < 0 {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'limit'")
+		}
+	}
+	if value := query.Get("wait"); value != "" {
+		seconds, err := strconv.Atoi(value)
+		if err != nil || seconds < 0 {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'wait', expected seconds")
+		}
+		req.Wait = time.Duration(seconds) * time.Second
+	}
+	return req, nil
+}
+
+// acceptsEventStream routes subscribers of server-sent events to stream, other clients to poll.
+func acceptsEventStream(stream, poll http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.Contains(r.Header.Get("Accept"), eventStreamMediaType) {
+			stream.ServeHTTP(w, r)
+			return
+		}
+		poll.ServeHTTP(w, r)
+	})
+}
+
+// makeChangesStreamHandler serves the change feed as server-sent events with the cursor as the event ID,
+// so that a reconnecting EventSource resumes from the Last-Event-ID header.
+func makeChangesStreamHandler(listChanges endpoint.Endpoint, logger *logrus.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		cursor := r.Header.Get("Last-Event-ID")
+		if cursor == "" {
+			cursor = r.URL.Query().Get("after")
+		}
+		after, err := parseCursor(cursor)
+		if err != nil {
+			encodeErrorResponse(ctx, err, w)
+			return
+		}
+
+		controller := http.NewResponseController(w)
+		started := false
+		for {
+			response, err := listChanges(ctx, listChangesRequest{After: after, Limit: streamBatchSize, Wait: streamHeartbeat})
+			if err != nil {
+				if !started {
+					encodeErrorResponse(ctx, err, w)
+				} else if ctx.Err() == nil && !errors.Is(err, application.ErrChangeFeedClosed) {
+					logging.FromContext(ctx, logger).WithError(err).Error("change stream failed")
+				}
+				return
+			}
+			if !started {
+				started = true
+				w.Header().Set("Content-Type", eventStreamMediaType)
+				w.Header().Set("Cache-Control", "no-cache")
+				w.WriteHeader(http.StatusOK)
+			}
+			changes := response.(*listChangesResponse).Changes
+			if len(changes) == 0 {
+				_, err = fmt.Fprint(w, ": heartbeat\n\n")
+			}
+			for _, change := range changes {
+				if err = writeChangeEvent(w, change); err != nil {
+					break
+				}
+				after, _ = parseCursor(change.Cursor)
+			}
+			if err == nil {
+				err = controller.Flush()
+			}
+			if err != nil {
+				return
+			}
+		}
+	})
+}
+
+func writeChangeEvent(w http.ResponseWriter, change changeData) error {
+	data, err := json.Marshal(change)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", change.Cursor, change.Type, data)
+	return err
+}
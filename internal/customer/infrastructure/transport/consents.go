@@ -0,0 +1,185 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeGetConsentsEndpoint(consents *application.Consents) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(consentsRequest)
+		current, err := consents.Current(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return toConsentsResponse(current), nil
+	}
+}
+
+func makeGetConsentHistoryEndpoint(consents *application.Consents) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(consentsRequest)
+		history, err := consents.History(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return toConsentsResponse(history), nil
+	}
+}
+
+func makeUpdateConsentsEndpoint(consents *application.Consents) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateConsentsRequest)
+		decisions := make([]application.Consent, 0, len(req.Consents))
+		for _, c := range req.Consents {
+			decisions = append(decisions, application.Consent{
+				Purpose:       c.Purpose,
+				Channel:       c.Channel,
+				Granted:       c.Granted,
+				Source:        c.Source,
+				PolicyVersion: c.PolicyVersion,
+			})
+		}
+		current, err := consents.Record(ctx, req.ID, decisions)
+		if err != nil {
+			return nil, err
+		}
+		return toConsentsResponse(current), nil
+	}
+}
+
+func makeListConsentingCustomersEndpoint(consents *application.Consents) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listConsentingCustomersRequest)
+		customers, err := consents.ConsentingCustomers(ctx, req.Purpose, req.Channel, req.After, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		response := &listConsentingCustomersResponse{Customers: make([]userData, 0, len(customers))}
+		for _, customer := range customers {
+			response.Customers = append(response.Customers, toUserData(customer))
+		}
+		if len(customers) > 0 {
+			response.Next = customers[len(customers)-1].ID.String()
+		}
+		return response, nil
+	}
+}
+
+func toConsentsResponse(consents []application.Consent) *consentsResponse {
+	response := &consentsResponse{Consents: make([]consentData, 0, len(consents))}
+	for _, c := range consents {
+		recordedAt := c.RecordedAt
+		response.Consents = append(response.Consents, consentData{
+			Purpose:       c.Purpose,
+			Channel:       c.Channel,
+			Granted:       c.Granted,
+			Source:        c.Source,
+			PolicyVersion: c.PolicyVersion,
+			RecordedAt:    &recordedAt,
+		})
+	}
+	return response
+}
+
+func decodeConsentsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return consentsRequest{ID: id}, nil
+}
+
+func decodeUpdateConsentsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	req := updateConsentsRequest{ID: id}
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if len(req.Consents) == 0 {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameter 'consents'")
+	}
+	return req, nil
+}
+
+func decodeListConsentingCustomersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	query := r.URL.Query()
+	req := listConsentingCustomersRequest{Purpose: query.Get("purpose"), Channel: query.Get("channel")}
+	if req.Purpose == "" || req.Channel == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameters 'purpose' and 'channel'")
+	}
+	if value := query.Get("after"); value != "" {
+		after, err := uuid.FromString(value)
+		if err != nil {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'after'")
+		}
+		req.After = application.CustomerID(after)
+	}
+	if value := query.Get("limit"); value != "" {
+		if req.Limit, err = strconv.Atoi(value); err != nil || req.Limit < 0 {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'limit'")
+		}
+	}
+	return req, nil
+}
+
+func customerID(r *http.Request) (uuid.UUID, error) {
+	sID, ok := mux.Vars(r)["userId"]
+	if !ok {
+		return uuid.UUID{}, ErrBadRouting
+	}
+	id, err := uuid.FromString(sID)
+	if err != nil {
+		return uuid.UUID{}, ErrBadRouting
+	}
+	return id, nil
+}
+
+type consentsRequest struct {
+	ID uuid.UUID
+}
+
+type updateConsentsRequest struct {
+	ID       uuid.UUID     `json:"-"`
+	Consents []consentData `json:"consents"`
+}
+
+type consentsResponse struct {
+	Consents []consentData `json:"consents"`
+}
+
+type consentData struct {
+	Purpose       string     `json:"purpose"`
+	Channel       string     `json:"channel"`
+	Granted       bool       `json:"granted"`
+	Source        string     `json:"source"`
+	PolicyVersion string     `json:"policyVersion"`
+	RecordedAt    *time.Time `json:"recordedAt,omitempty"`
+}
+
+type listConsentingCustomersRequest struct {
+	Purpose string
+	Channel string
+	After   application.CustomerID
+	Limit   int
+}
+
+type listConsentingCustomersResponse struct {
+	Customers []userData `json:"customers"`
+	// Next is the value of 'after' for the next page, empty when the page is empty.
+	Next string `json:"next,omitempty"`
+}
@@ -0,0 +1,110 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeListDuplicatesEndpoint(duplicates *application.Duplicates) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listDuplicatesRequest)
+		pairs, err := duplicates.DuplicatesOf(ctx, application.CustomerID(req.ID))
+		if err != nil {
+			return nil, err
+		}
+		return &duplicatesResponse{Duplicates: toDuplicatePairData(duplicates, pairs)}, nil
+	}
+}
+
+func makeListDuplicateClustersEndpoint(duplicates *application.Duplicates) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listDuplicateClustersRequest)
+		clusters, err := duplicates.Clusters(ctx, req.MinScore)
+		if err != nil {
+			return nil, err
+		}
+		response := &duplicateClustersResponse{Clusters: make([]duplicateClusterData, 0, len(clusters))}
+		for _, cluster := range clusters {
+			ids := make([]string, 0, len(cluster.CustomerIDs))
+			for _, id := range cluster.CustomerIDs {
+				ids = append(ids, id.String())
+			}
+			response.Clusters = append(response.Clusters, duplicateClusterData{
+				CustomerIDs: ids,
+				Pairs:       toDuplicatePairData(duplicates, cluster.Pairs),
+			})
+		}
+		return response, nil
+	}
+}
+
+func toDuplicatePairData(duplicates *application.Duplicates, pairs []application.DuplicatePair) []duplicatePairData {
+	data := make([]duplicatePairData, 0, len(pairs))
+	for _, pair := range pairs {
+		data = append(data, duplicatePairData{
+			CustomerID:  pair.CustomerID.String(),
+			CandidateID: pair.CandidateID.String(),
+			Score:       pair.Score,
+			Reasons:     pair.Reasons,
+			Flagged:     duplicates.Flagged(pair),
+			DetectedAt:  pair.DetectedAt,
+		})
+	}
+	return data
+}
+
+func decodeListDuplicatesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return listDuplicatesRequest{ID: id}, nil
+}
+
+func decodeListDuplicateClustersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req listDuplicateClustersRequest
+	if value := r.URL.Query().Get("minScore"); value != "" {
+		if req.MinScore, err = strconv.ParseFloat(value, 64); err != nil || req.MinScore <= 0 || req.MinScore > 1 {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'minScore', expected a number greater than 0 and at most 1")
+		}
+	}
+	return req, nil
+}
+
+type listDuplicatesRequest struct {
+	ID uuid.UUID
+}
+
+type listDuplicateClustersRequest struct {
+	MinScore float64
+}
+
+type duplicatesResponse struct {
+	Duplicates []duplicatePairData `json:"duplicates"`
+}
+
+type duplicateClustersResponse struct {
+	Clusters []duplicateClusterData `json:"clusters"`
+}
+
+type duplicateClusterData struct {
+	CustomerIDs []string            `json:"customerIds"`
+	Pairs       []duplicatePairData `json:"pairs"`
+}
+
+type duplicatePairData struct {
+	CustomerID  string    `json:"customerId"`
+	CandidateID string    `json:"candidateId"`
+	Score       float64   `json:"score"`
+	Reasons     []string  `json:"reasons"`
+	Flagged     bool      `json:"flagged"`
+	DetectedAt  time.Time `json:"detectedAt"`
+}
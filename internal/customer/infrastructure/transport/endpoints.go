@@ -4,54 +4,62 @@ import (
 	"context"
 
 	"github.com/go-kit/kit/endpoint"
-	"github.com/jnikolaeva/eshop-common/uuid"
-	"github.com/pkg/errors"
 
 	"github.com/jnikolaeva/customerservice/internal/customer/application"
-	"github.com/jnikolaeva/customerservice/internal/customer/infrastructure/identity"
 )
 
-type IdentityProviderProxy interface {
-	Register(username, password string) (uuid.UUID, error)
-	Delete(userID uuid.UUID) error
-}
-
 type Endpoints struct {
 	RegisterCustomer   endpoint.Endpoint
 	GetCurrentCustomer endpoint.Endpoint
 	FindCustomer       endpoint.Endpoint
 	UpdateCustomer     endpoint.Endpoint
-}
+	ListChanges        endpoint.Endpoint
+	GetConsents        endpoint.Endpoint
+	GetConsentHistory  endpoint.Endpoint
+	UpdateConsents     endpoint.Endpoint
+	GetPreferences     endpoint.Endpoint
+	UpdatePreferences  endpoint.Endpoint
+	GetTaxID           endpoint.Endpoint
+	SetTaxID           endpoint.Endpoint
+	VerifyTaxID        endpoint.Endpoint
+	DeleteTaxID        endpoint.Endpoint
 
-func MakeEndpoints(s application.Service, identityProviderUrl string) Endpoints {
-	identityProvider := identity.NewProviderProxy(identityProviderUrl)
+	ListAttributeDefinitions endpoint.Endpoint
+	GetAttributes            endpoint.Endpoint
+	UpdateAttributes         endpoint.Endpoint
+}
 
+func MakeEndpoints(s application.Service, feed *application.ChangeFeed, consents *application.Consents, preferences *application.PreferencesService,
+	taxIDs *application.TaxIDs, attributes *application.Attributes) Endpoints {
 	return Endpoints{
-		RegisterCustomer:   makeRegisterCustomerEndpoint(s, identityProvider),
+		RegisterCustomer:   makeRegisterCustomerEndpoint(s),
 		GetCurrentCustomer: makeGetCurrentCustomerEndpoint(s),
 		FindCustomer:       makeFindCustomerEndpoint(s),
 		UpdateCustomer:     makeUpdateCustomerEndpoint(s),
+		ListChanges:        makeListChangesEndpoint(feed),
+		GetConsents:        makeGetConsentsEndpoint(consents),
+		GetConsentHistory:  makeGetConsentHistoryEndpoint(consents),
+		UpdateConsents:     makeUpdateConsentsEndpoint(consents),
+		GetPreferences:     makeGetPreferencesEndpoint(preferences),
+		UpdatePreferences:  makeUpdatePreferencesEndpoint(preferences),
+		GetTaxID:           makeGetTaxIDEndpoint(taxIDs),
+		SetTaxID:           makeSetTaxIDEndpoint(taxIDs),
+		VerifyTaxID:        makeVerifyTaxIDEndpoint(taxIDs),
+		DeleteTaxID:        makeDeleteTaxIDEndpoint(taxIDs),
+
+		ListAttributeDefinitions: makeListAttributeDefinitionsEndpoint(attributes),
+		GetAttributes:            makeGetAttributesEndpoint(attributes),
+		UpdateAttributes:         makeUpdateAttributesEndpoint(attributes),
 	}
 }
 
-func makeRegisterCustomerEndpoint(s application.Service, identityProviderProxy IdentityProviderProxy) endpoint.Endpoint {
+func makeRegisterCustomerEndpoint(s application.Service) endpoint.Endpoint {
 	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(registerCustomerRequest)
-
-		id, err := identityProviderProxy.Register(req.Username, req.Password)
+		customerID, err := s.Register(ctx, req.Username, req.Password, req.FirstName, req.LastName, req.Email, req.Phone)
 		if err != nil {
 			return nil, err
 		}
-
-		customerID, err := s.Create(ctx, id, req.FirstName, req.LastName, req.Email, req.Phone)
-		if err != nil {
-			deleteErr := identityProviderProxy.Delete(id)
-			if deleteErr != nil {
-				err = errors.Wrap(err, deleteErr.Error())
-			}
-			return nil, err
-		}
-
 		return &registerCustomerResponse{ID: customerID.String()}, err
 	}
 }
@@ -97,5 +105,7 @@ func toUserData(user application.Customer) userData {
 			Email:     user.Email,
 			Phone:     user.Phone,
 		},
+		Status:     user.Status,
+		Attributes: user.Attributes,
 	}
 }
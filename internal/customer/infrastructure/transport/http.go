@@ -5,19 +5,27 @@ import (
 	"encoding/json"
 	"io"
 	"net/http"
+	"strings"
+	"time"
 
-	"github.com/go-kit/kit/log"
-	gokittransport "github.com/go-kit/kit/transport"
 	gokithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/jnikolaeva/eshop-common/httpkit"
 	"github.com/jnikolaeva/eshop-common/uuid"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 
 	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/logging"
 )
 
-const userIDHeader = "X-Auth-User-Id"
+const (
+	userIDHeader = "X-Auth-User-Id"
+	// rolesHeader lists the comma separated roles of the authenticated user, set by the gateway.
+	rolesHeader = "X-Auth-User-Roles"
+	adminRole   = "admin"
+)
 
 var (
 	ErrBadRouting       = errors.New("bad routing")
@@ -25,26 +33,71 @@ var (
 	ErrBadRequest       = errors.New("bad request")
 )
 
-func MakeHandler(pathPrefix string, endpoints Endpoints, errorLogger log.Logger, metrics *httpkit.MetricsHolder) http.Handler {
+func MakeHandler(pathPrefix string, endpoints Endpoints, logger *logrus.Logger, metrics *httpkit.MetricsHolder) http.Handler {
 	options := []gokithttp.ServerOption{
 		gokithttp.ServerErrorEncoder(encodeErrorResponse),
-		gokithttp.ServerErrorHandler(gokittransport.NewLogErrorHandler(errorLogger)),
+		gokithttp.ServerErrorHandler(logging.NewErrorHandler(logger)),
 	}
 
-	registerCustomerHandler := gokithttp.NewServer(endpoints.RegisterCustomer, decodeRegisterCustomerRequest, encodeResponse, options...)
+	registerCustomerHandler := gokithttp.NewServer(endpoints.RegisterCustomer, decodeRegisterCustomerRequest, encodeResponse,
+		append(options, gokithttp.ServerBefore(withAcceptLanguage))...)
 	getCurrentCustomerHandler := gokithttp.NewServer(endpoints.GetCurrentCustomer, decodeGetCurrentCustomerRequest, encodeResponse, options...)
 	findCustomerHandler := gokithttp.NewServer(endpoints.FindCustomer, decodeFindCustomerRequest, encodeResponse, options...)
 	updateCustomerHandler := gokithttp.NewServer(endpoints.UpdateCustomer, decodeUpdateCustomerRequest, encodeResponse, options...)
+	getConsentsHandler := gokithttp.NewServer(endpoints.GetConsents, decodeConsentsRequest, encodeResponse, options...)
+	getConsentHistoryHandler := gokithttp.NewServer(endpoints.GetConsentHistory, decodeConsentsRequest, encodeResponse, options...)
+	updateConsentsHandler := gokithttp.NewServer(endpoints.UpdateConsents, decodeUpdateConsentsRequest, encodeResponse, options...)
+	getPreferencesHandler := gokithttp.NewServer(endpoints.GetPreferences, decodePreferencesRequest, encodeResponse, options...)
+	updatePreferencesHandler := gokithttp.NewServer(endpoints.UpdatePreferences, decodeUpdatePreferencesRequest, encodeResponse, options...)
+	getTaxIDHandler := gokithttp.NewServer(endpoints.GetTaxID, decodeCustomerTaxIDRequest, encodeResponse, options...)
+	setTaxIDHandler := gokithttp.NewServer(endpoints.SetTaxID, decodeSetCustomerTaxIDRequest, encodeResponse, options...)
+	verifyTaxIDHandler := gokithttp.NewServer(endpoints.VerifyTaxID, decodeCustomerTaxIDRequest, encodeResponse, options...)
+	deleteTaxIDHandler := gokithttp.NewServer(endpoints.DeleteTaxID, decodeCustomerTaxIDRequest, encodeResponse, options...)
+	listAttributeDefinitionsHandler := gokithttp.NewServer(endpoints.ListAttributeDefinitions, decodeListAttributeDefinitionsRequest, encodeResponse, options...)
+	getAttributesHandler := gokithttp.NewServer(endpoints.GetAttributes, decodeAttributesRequest, encodeResponse, options...)
+	updateAttributesHandler := gokithttp.NewServer(endpoints.UpdateAttributes, decodeUpdateAttributesRequest, encodeResponse, options...)
+	listChangesHandler := gokithttp.NewServer(endpoints.ListChanges, decodeListChangesRequest, encodeResponse, options...)
+	changesHandler := acceptsEventStream(
+		withoutWriteDeadline(authMiddleware(makeChangesStreamHandler(endpoints.ListChanges, logger)), logger),
+		withoutWriteDeadline(instrument(authMiddleware(listChangesHandler), metrics, "ListChanges"), logger))
 
 	r := mux.NewRouter()
 	s := r.PathPrefix(pathPrefix).Subrouter()
-	s.Handle("", httpkit.InstrumentingMiddleware(registerCustomerHandler, metrics, "RegisterCustomer")).Methods(http.MethodPost)
-	s.Handle("/me", httpkit.InstrumentingMiddleware(authMiddleware(getCurrentCustomerHandler), metrics, "LoggedInCustomerInfo")).Methods(http.MethodGet)
-	s.Handle("/{userId}", httpkit.InstrumentingMiddleware(authMiddleware(findCustomerHandler), metrics, "GetCustomer")).Methods(http.MethodGet)
-	s.Handle("/{userId}", httpkit.InstrumentingMiddleware(authMiddleware(updateCustomerHandler), metrics, "UpdateCustomer")).Methods(http.MethodPut)
+	s.Handle("", instrument(registerCustomerHandler, metrics, "RegisterCustomer")).Methods(http.MethodPost)
+	s.Handle("/changes", changesHandler).Methods(http.MethodGet)
+	s.Handle("/me", instrument(authMiddleware(getCurrentCustomerHandler), metrics, "LoggedInCustomerInfo")).Methods(http.MethodGet)
+	s.Handle("/attributes", instrument(authMiddleware(listAttributeDefinitionsHandler), metrics, "ListAttributeDefinitions")).Methods(http.MethodGet)
+	s.Handle("/{userId}", instrument(authMiddleware(findCustomerHandler), metrics, "GetCustomer")).Methods(http.MethodGet)
+	s.Handle("/{userId}", instrument(authMiddleware(updateCustomerHandler), metrics, "UpdateCustomer")).Methods(http.MethodPut)
+	s.Handle("/{userId}/consents", instrument(authMiddleware(getConsentsHandler), metrics, "GetConsents")).Methods(http.MethodGet)
+	s.Handle("/{userId}/consents", instrument(authMiddleware(updateConsentsHandler), metrics, "UpdateConsents")).Methods(http.MethodPut)
+	s.Handle("/{userId}/consents/history", instrument(authMiddleware(getConsentHistoryHandler), metrics, "GetConsentHistory")).Methods(http.MethodGet)
+	s.Handle("/{userId}/preferences", instrument(authMiddleware(getPreferencesHandler), metrics, "GetPreferences")).Methods(http.MethodGet)
+	s.Handle("/{userId}/preferences", instrument(authMiddleware(updatePreferencesHandler), metrics, "UpdatePreferences")).Methods(http.MethodPut)
+	s.Handle("/{userId}/tax-id", instrument(authMiddleware(getTaxIDHandler), metrics, "GetTaxID")).Methods(http.MethodGet)
+	s.Handle("/{userId}/tax-id", instrument(authMiddleware(setTaxIDHandler), metrics, "SetTaxID")).Methods(http.MethodPut)
+	s.Handle("/{userId}/tax-id", instrument(authMiddleware(deleteTaxIDHandler), metrics, "DeleteTaxID")).Methods(http.MethodDelete)
+	s.Handle("/{userId}/tax-id/verify", instrument(authMiddleware(verifyTaxIDHandler), metrics, "VerifyTaxID")).Methods(http.MethodPost)
+	s.Handle("/{userId}/attributes", instrument(authMiddleware(getAttributesHandler), metrics, "GetAttributes")).Methods(http.MethodGet)
+	s.Handle("/{userId}/attributes", instrument(authMiddleware(updateAttributesHandler), metrics, "UpdateAttributes")).Methods(http.MethodPatch)
 	return r
 }
 
+// instrument records request metrics and starts a server span continuing the inbound W3C trace context.
+func instrument(next http.Handler, metrics *httpkit.MetricsHolder, endpointName string) http.Handler {
+	return otelhttp.NewHandler(httpkit.InstrumentingMiddleware(next, metrics, endpointName), endpointName)
+}
+
+// withoutWriteDeadline lifts the server write timeout for long running streams.
+func withoutWriteDeadline(next http.Handler, logger *logrus.Logger) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			logger.WithError(err).Debug("failed to lift write deadline")
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
 func authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userID, err := uuid.FromString(r.Header.Get(userIDHeader))
@@ -53,10 +106,24 @@ func authMiddleware(next http.Handler) http.Handler {
 			return
 		}
 		ctx := application.WithUserID(r.Context(), userID)
+		if hasRole(r, adminRole) {
+			ctx = application.WithAdmin(ctx)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+func hasRole(r *http.Request, role string) bool {
+	for _, value := range r.Header.Values(rolesHeader) {
+		for _, candidate := range strings.Split(value, ",") {
+			if strings.TrimSpace(candidate) == role {
+				return true
+			}
+		}
+	}
+	return false
+}
+
 func decodeRegisterCustomerRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
 	var req registerCustomerRequest
 	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
@@ -121,9 +188,22 @@ func encodeResponse(ctx context.Context, w http.ResponseWriter, response interfa
 	return json.NewEncoder(w).Encode(response)
 }
 
+// encodeAcceptedResponse answers 202 for a request whose work goes on in the background.
+func encodeAcceptedResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(response)
+}
+
 func encodeErrorResponse(ctx context.Context, err error, w http.ResponseWriter) {
 	w.Header().Set("Content-Type", "application/json; charset=utf-8")
 	var errorResponse = translateError(err)
+	var merged *application.MergedError
+	if errors.As(err, &merged) {
+		// relative to the requested customer, so that clients follow it to the survivor
+		w.Header().Set("Location", merged.SurvivorID.String())
+		w.Header().Set("X-Merged-Into", merged.SurvivorID.String())
+	}
 	w.WriteHeader(errorResponse.Status)
 	_ = json.NewEncoder(w).Encode(errorResponse.Response)
 }
@@ -134,7 +214,11 @@ type transportError struct {
 }
 
 func translateError(err error) transportError {
-	if errors.Is(err, ErrBadRequest) {
+	if errors.Is(err, ErrBadRequest) || errors.Is(err, application.ErrInvalidWebhook) || errors.Is(err, application.ErrInvalidConsent) ||
+		errors.Is(err, application.ErrInvalidPreferences) || errors.Is(err, application.ErrInvalidStatusChange) ||
+		errors.Is(err, application.ErrInvalidOrganization) || errors.Is(err, application.ErrInvalidTaxID) ||
+		errors.Is(err, application.ErrInvalidMerge) || errors.Is(err, application.ErrInvalidAttribute) ||
+		errors.Is(err, application.ErrInvalidTag) || errors.Is(err, application.ErrInvalidSegment) {
 		return transportError{
 			Status: http.StatusBadRequest,
 			Response: errorResponse{
@@ -143,37 +227,169 @@ func translateError(err error) transportError {
 			},
 		}
 	}
-	switch err {
-	case application.ErrCustomerNotFound:
+	if errors.Is(err, application.ErrUsernameTaken) {
+		return transportError{
+			Status: http.StatusConflict,
+			Response: errorResponse{
+				Code:    107,
+				Message: err.Error(),
+			},
+		}
+	}
+	if errors.Is(err, application.ErrWeakPassword) {
+		return transportError{
+			Status: http.StatusUnprocessableEntity,
+			Response: errorResponse{
+				Code:    108,
+				Message: err.Error(),
+			},
+		}
+	}
+	if errors.Is(err, application.ErrIdentityProviderUnavailable) {
+		return transportError{
+			Status: http.StatusServiceUnavailable,
+			Response: errorResponse{
+				Code:    106,
+				Message: application.ErrIdentityProviderUnavailable.Error(),
+			},
+		}
+	}
+	if errors.Is(err, application.ErrChangeFeedClosed) {
+		return transportError{
+			Status: http.StatusServiceUnavailable,
+			Response: errorResponse{
+				Code:    109,
+				Message: "service is shutting down, retry the request",
+			},
+		}
+	}
+	switch {
+	case errors.Is(err, application.ErrCustomerNotFound):
 		return transportError{
 			Status: http.StatusNotFound,
 			Response: errorResponse{
 				Code:    102,
+				Message: application.ErrCustomerNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrAccountNotActive):
+		return transportError{
+			Status: http.StatusForbidden,
+			Response: errorResponse{
+				Code:    111,
+				Message: application.ErrAccountNotActive.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrStatusTransitionNotAllowed):
+		return transportError{
+			Status: http.StatusConflict,
+			Response: errorResponse{
+				Code:    112,
+				Message: err.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrOrganizationNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    113,
+				Message: application.ErrOrganizationNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrMemberNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    114,
+				Message: application.ErrMemberNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrInvitationNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    115,
+				Message: application.ErrInvitationNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrLastOwner):
+		return transportError{
+			Status: http.StatusConflict,
+			Response: errorResponse{
+				Code:    116,
+				Message: application.ErrLastOwner.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrTaxIDNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    117,
+				Message: application.ErrTaxIDNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrCustomerMerged):
+		return transportError{
+			Status: http.StatusMovedPermanently,
+			Response: errorResponse{
+				Code:    118,
 				Message: err.Error(),
 			},
 		}
-	case application.ErrDuplicateUser:
+	case errors.Is(err, application.ErrAttributeNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    119,
+				Message: application.ErrAttributeNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrTagNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    120,
+				Message: application.ErrTagNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrSegmentNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    121,
+				Message: application.ErrSegmentNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrWebhookNotFound):
+		return transportError{
+			Status: http.StatusNotFound,
+			Response: errorResponse{
+				Code:    110,
+				Message: application.ErrWebhookNotFound.Error(),
+			},
+		}
+	case errors.Is(err, application.ErrDuplicateUser):
 		return transportError{
 			Status: http.StatusConflict,
 			Response: errorResponse{
 				Code:    103,
-				Message: err.Error(),
+				Message: application.ErrDuplicateUser.Error(),
 			},
 		}
-	case ErrNotAuthenticated:
+	case errors.Is(err, ErrNotAuthenticated):
 		return transportError{
 			Status: http.StatusUnauthorized,
 			Response: errorResponse{
 				Code:    104,
-				Message: err.Error(),
+				Message: ErrNotAuthenticated.Error(),
 			},
 		}
-	case application.ErrNotAuthorized:
+	case errors.Is(err, application.ErrNotAuthorized):
 		return transportError{
 			Status: http.StatusForbidden,
 			Response: errorResponse{
 				Code:    105,
-				Message: err.Error(),
+				Message: application.ErrNotAuthorized.Error(),
 			},
 		}
 	default:
@@ -0,0 +1,51 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeMergeCustomersEndpoint(s application.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(mergeCustomersRequest)
+		customer, err := s.Merge(ctx, req.SurvivorID, req.MergedID)
+		if err != nil {
+			return nil, err
+		}
+		return &findCustomerResponse{toUserData(*customer)}, nil
+	}
+}
+
+func decodeMergeCustomersRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var body struct {
+		SurvivorID string `json:"survivorId"`
+		MergedID   string `json:"mergedId"`
+	}
+	if e := json.NewDecoder(r.Body).Decode(&body); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if body.SurvivorID == "" || body.MergedID == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameters 'survivorId' and 'mergedId'")
+	}
+	var req mergeCustomersRequest
+	if req.SurvivorID, err = uuid.FromString(body.SurvivorID); err != nil {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'survivorId'")
+	}
+	if req.MergedID, err = uuid.FromString(body.MergedID); err != nil {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'mergedId'")
+	}
+	return req, nil
+}
+
+type mergeCustomersRequest struct {
+	SurvivorID uuid.UUID
+	MergedID   uuid.UUID
+}
@@ -1,6 +1,12 @@
 package transport
 
-import "github.com/jnikolaeva/eshop-common/uuid"
+import (
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
 
 type registerCustomerRequest struct {
 	Username string `json:"username"`
@@ -37,6 +43,15 @@ type errorResponse struct {
 type userData struct {
 	ID string `json:"id"`
 	userDetails
+	Status string `json:"status,omitempty"`
+	// Attributes are the custom attributes the caller may see.
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+}
+
+// adminUserData adds to userData what only admins see.
+type adminUserData struct {
+	userData
+	IdentityMissingAt *time.Time `json:"identityMissingAt,omitempty"`
 }
 
 type userDetails struct {
@@ -45,3 +60,43 @@ type userDetails struct {
 	Email     string `json:"email,omitempty"`
 	Phone     string `json:"phone,omitempty"`
 }
+
+type importCustomersRequest struct {
+	source  application.ImportSource
+	options application.ImportOptions
+}
+
+type importCustomersResponse struct {
+	*application.ImportReport
+	Error string `json:"error,omitempty"`
+}
+
+type exportCustomersRequest struct {
+	format  string
+	options application.ExportOptions
+}
+
+type exportCustomersResponse struct {
+	exporter *application.Exporter
+	format   string
+	options  application.ExportOptions
+}
+
+type listChangesRequest struct {
+	After int64
+	Limit int
+	Wait  time.Duration
+}
+
+type listChangesResponse struct {
+	Changes []changeData `json:"changes"`
+	Next    string       `json:"next"`
+}
+
+type changeData struct {
+	Cursor     string    `json:"cursor"`
+	Type       string    `json:"type"`
+	CustomerID string    `json:"customerId"`
+	Customer   *userData `json:"customer"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
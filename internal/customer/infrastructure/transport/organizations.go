@@ -0,0 +1,401 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	gokithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/jnikolaeva/eshop-common/httpkit"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+	"github.com/jnikolaeva/customerservice/internal/logging"
+)
+
+type OrganizationEndpoints struct {
+	CreateOrganization endpoint.Endpoint
+	ListMemberships    endpoint.Endpoint
+	GetOrganization    endpoint.Endpoint
+	UpdateOrganization endpoint.Endpoint
+	ListMembers        endpoint.Endpoint
+	ChangeMemberRole   endpoint.Endpoint
+	RemoveMember       endpoint.Endpoint
+	InviteMember       endpoint.Endpoint
+	AcceptInvitation   endpoint.Endpoint
+	GetTaxID           endpoint.Endpoint
+	SetTaxID           endpoint.Endpoint
+	VerifyTaxID        endpoint.Endpoint
+	DeleteTaxID        endpoint.Endpoint
+}
+
+func MakeOrganizationEndpoints(organizations *application.Organizations, taxIDs *application.TaxIDs) OrganizationEndpoints {
+	return OrganizationEndpoints{
+		CreateOrganization: makeCreateOrganizationEndpoint(organizations),
+		ListMemberships:    makeListMembershipsEndpoint(organizations),
+		GetOrganization:    makeGetOrganizationEndpoint(organizations),
+		UpdateOrganization: makeUpdateOrganizationEndpoint(organizations),
+		ListMembers:        makeListMembersEndpoint(organizations),
+		ChangeMemberRole:   makeChangeMemberRoleEndpoint(organizations),
+		RemoveMember:       makeRemoveMemberEndpoint(organizations),
+		InviteMember:       makeInviteMemberEndpoint(organizations),
+		AcceptInvitation:   makeAcceptInvitationEndpoint(organizations),
+		GetTaxID:           makeGetTaxIDEndpoint(taxIDs),
+		SetTaxID:           makeSetTaxIDEndpoint(taxIDs),
+		VerifyTaxID:        makeVerifyTaxIDEndpoint(taxIDs),
+		DeleteTaxID:        makeDeleteTaxIDEndpoint(taxIDs),
+	}
+}
+
+func MakeOrganizationHandler(pathPrefix string, endpoints OrganizationEndpoints, logger *logrus.Logger, metrics *httpkit.MetricsHolder) http.Handler {
+	options := []gokithttp.ServerOption{
+		gokithttp.ServerErrorEncoder(encodeErrorResponse),
+		gokithttp.ServerErrorHandler(logging.NewErrorHandler(logger)),
+	}
+
+	createOrganizationHandler := gokithttp.NewServer(endpoints.CreateOrganization, decodeCreateOrganizationRequest, encodeResponse, options...)
+	listMembershipsHandler := gokithttp.NewServer(endpoints.ListMemberships, decodeGetCurrentCustomerRequest, encodeResponse, options...)
+	getOrganizationHandler := gokithttp.NewServer(endpoints.GetOrganization, decodeOrganizationRequest, encodeResponse, options...)
+	updateOrganizationHandler := gokithttp.NewServer(endpoints.UpdateOrganization, decodeUpdateOrganizationRequest, encodeResponse, options...)
+	listMembersHandler := gokithttp.NewServer(endpoints.ListMembers, decodeOrganizationRequest, encodeResponse, options...)
+	changeMemberRoleHandler := gokithttp.NewServer(endpoints.ChangeMemberRole, decodeChangeMemberRoleRequest, encodeResponse, options...)
+	removeMemberHandler := gokithttp.NewServer(endpoints.RemoveMember, decodeMemberRequest, encodeResponse, options...)
+	inviteMemberHandler := gokithttp.NewServer(endpoints.InviteMember, decodeInviteMemberRequest, encodeResponse, options...)
+	acceptInvitationHandler := gokithttp.NewServer(endpoints.AcceptInvitation, decodeAcceptInvitationRequest, encodeResponse, options...)
+	getTaxIDHandler := gokithttp.NewServer(endpoints.GetTaxID, decodeOrganizationTaxIDRequest, encodeResponse, options...)
+	setTaxIDHandler := gokithttp.NewServer(endpoints.SetTaxID, decodeSetOrganizationTaxIDRequest, encodeResponse, options...)
+	verifyTaxIDHandler := gokithttp.NewServer(endpoints.VerifyTaxID, decodeOrganizationTaxIDRequest, encodeResponse, options...)
+	deleteTaxIDHandler := gokithttp.NewServer(endpoints.DeleteTaxID, decodeOrganizationTaxIDRequest, encodeResponse, options...)
+
+	r := mux.NewRouter()
+	s := r.PathPrefix(pathPrefix).Subrouter()
+	s.Handle("", instrument(authMiddleware(createOrganizationHandler), metrics, "CreateOrganization")).Methods(http.MethodPost)
+	s.Handle("", instrument(authMiddleware(listMembershipsHandler), metrics, "ListMemberships")).Methods(http.MethodGet)
+	s.Handle("/invitations/accept", instrument(authMiddleware(acceptInvitationHandler), metrics, "AcceptInvitation")).Methods(http.MethodPost)
+	s.Handle("/{organizationId}", instrument(authMiddleware(getOrganizationHandler), metrics, "GetOrganization")).Methods(http.MethodGet)
+	s.Handle("/{organizationId}", instrument(authMiddleware(updateOrganizationHandler), metrics, "UpdateOrganization")).Methods(http.MethodPut)
+	s.Handle("/{organizationId}/members", instrument(authMiddleware(listMembersHandler), metrics, "ListMembers")).Methods(http.MethodGet)
+	s.Handle("/{organizationId}/members/{userId}", instrument(authMiddleware(changeMemberRoleHandler), metrics, "ChangeMemberRole")).Methods(http.MethodPut)
+	s.Handle("/{organizationId}/members/{userId}", instrument(authMiddleware(removeMemberHandler), metrics, "RemoveMember")).Methods(http.MethodDelete)
+	s.Handle("/{organizationId}/invitations", instrument(authMiddleware(inviteMemberHandler), metrics, "InviteMember")).Methods(http.MethodPost)
+	s.Handle("/{organizationId}/tax-id", instrument(authMiddleware(getTaxIDHandler), metrics, "GetOrganizationTaxID")).Methods(http.MethodGet)
+	s.Handle("/{organizationId}/tax-id", instrument(authMiddleware(setTaxIDHandler), metrics, "SetOrganizationTaxID")).Methods(http.MethodPut)
+	s.Handle("/{organizationId}/tax-id", instrument(authMiddleware(deleteTaxIDHandler), metrics, "DeleteOrganizationTaxID")).Methods(http.MethodDelete)
+	s.Handle("/{organizationId}/tax-id/verify", instrument(authMiddleware(verifyTaxIDHandler), metrics, "VerifyOrganizationTaxID")).Methods(http.MethodPost)
+	return r
+}
+
+func makeCreateOrganizationEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(organizationData)
+		organization, err := organizations.Create(ctx, req.toOrganization())
+		if err != nil {
+			return nil, err
+		}
+		return toOrganizationData(*organization), nil
+	}
+}
+
+func makeListMembershipsEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		memberships, err := organizations.MembershipsOf(ctx, *application.GetUserID(ctx))
+		if err != nil {
+			return nil, err
+		}
+		return toMembersResponse(memberships), nil
+	}
+}
+
+func makeGetOrganizationEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(organizationRequest)
+		organization, err := organizations.Get(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return toOrganizationData(*organization), nil
+	}
+}
+
+func makeUpdateOrganizationEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updateOrganizationRequest)
+		organization, err := organizations.Update(ctx, req.ID, req.toOrganization())
+		if err != nil {
+			return nil, err
+		}
+		return toOrganizationData(*organization), nil
+	}
+}
+
+func makeListMembersEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(organizationRequest)
+		members, err := organizations.Members(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return toMembersResponse(members), nil
+	}
+}
+
+func makeChangeMemberRoleEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(changeMemberRoleRequest)
+		member, err := organizations.ChangeRole(ctx, req.OrganizationID, req.CustomerID, req.Role)
+		if err != nil {
+			return nil, err
+		}
+		return toMemberData(*member), nil
+	}
+}
+
+func makeRemoveMemberEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(memberRequest)
+		return nil, organizations.RemoveMember(ctx, req.OrganizationID, req.CustomerID)
+	}
+}
+
+func makeInviteMemberEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(inviteMemberRequest)
+		invitation, token, err := organizations.Invite(ctx, req.OrganizationID, req.Email, req.Role)
+		if err != nil {
+			return nil, err
+		}
+		return &invitationData{
+			ID:             invitation.ID.String(),
+			OrganizationID: invitation.OrganizationID.String(),
+			Email:          invitation.Email,
+			Role:           invitation.Role,
+			Token:          token,
+			ExpiresAt:      invitation.ExpiresAt,
+		}, nil
+	}
+}
+
+func makeAcceptInvitationEndpoint(organizations *application.Organizations) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(acceptInvitationRequest)
+		member, err := organizations.AcceptInvitation(ctx, req.Token)
+		if err != nil {
+			return nil, err
+		}
+		return toMemberData(*member), nil
+	}
+}
+
+func toOrganizationData(o application.Organization) *organizationData {
+	return &organizationData{
+		ID:        o.ID.String(),
+		LegalName: o.LegalName,
+		BillingAddress: addressData{
+			Line1:      o.BillingAddress.Line1,
+			Line2:      o.BillingAddress.Line2,
+			City:       o.BillingAddress.City,
+			PostalCode: o.BillingAddress.PostalCode,
+			Region:     o.BillingAddress.Region,
+			Country:    o.BillingAddress.Country,
+		},
+		CreatedAt: o.CreatedAt,
+		UpdatedAt: o.UpdatedAt,
+	}
+}
+
+func (d organizationData) toOrganization() application.Organization {
+	return application.Organization{
+		LegalName: d.LegalName,
+		BillingAddress: application.Address{
+			Line1:      d.BillingAddress.Line1,
+			Line2:      d.BillingAddress.Line2,
+			City:       d.BillingAddress.City,
+			PostalCode: d.BillingAddress.PostalCode,
+			Region:     d.BillingAddress.Region,
+			Country:    d.BillingAddress.Country,
+		},
+	}
+}
+
+func toMemberData(m application.Membership) memberData {
+	return memberData{
+		OrganizationID: m.OrganizationID.String(),
+		CustomerID:     m.CustomerID.String(),
+		Role:           m.Role,
+		JoinedAt:       m.JoinedAt,
+	}
+}
+
+func toMembersResponse(memberships []application.Membership) *membersResponse {
+	response := &membersResponse{Members: make([]memberData, 0, len(memberships))}
+	for _, m := range memberships {
+		response.Members = append(response.Members, toMemberData(m))
+	}
+	return response
+}
+
+func decodeCreateOrganizationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req organizationData
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	return req, nil
+}
+
+func decodeOrganizationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := organizationID(r)
+	if err != nil {
+		return nil, err
+	}
+	return organizationRequest{ID: id}, nil
+}
+
+func decodeUpdateOrganizationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := organizationID(r)
+	if err != nil {
+		return nil, err
+	}
+	req := updateOrganizationRequest{ID: id}
+	if e := json.NewDecoder(r.Body).Decode(&req.organizationData); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	return req, nil
+}
+
+func decodeMemberRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	organizationID, err := organizationID(r)
+	if err != nil {
+		return nil, err
+	}
+	customerID, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return memberRequest{OrganizationID: organizationID, CustomerID: customerID}, nil
+}
+
+func decodeChangeMemberRoleRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	member, err := decodeMemberRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := changeMemberRoleRequest{memberRequest: member.(memberRequest)}
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if req.Role == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameter 'role'")
+	}
+	return req, nil
+}
+
+func decodeInviteMemberRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := organizationID(r)
+	if err != nil {
+		return nil, err
+	}
+	req := inviteMemberRequest{OrganizationID: id}
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if req.Email == "" || req.Role == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameters 'email' and 'role'")
+	}
+	return req, nil
+}
+
+func decodeAcceptInvitationRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req acceptInvitationRequest
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if req.Token == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameter 'token'")
+	}
+	return req, nil
+}
+
+func organizationID(r *http.Request) (uuid.UUID, error) {
+	sID, ok := mux.Vars(r)["organizationId"]
+	if !ok {
+		return uuid.UUID{}, ErrBadRouting
+	}
+	id, err := uuid.FromString(sID)
+	if err != nil {
+		return uuid.UUID{}, errors.WithMessagef(ErrBadRequest, "invalid organization id '%s'", sID)
+	}
+	return id, nil
+}
+
+type organizationRequest struct {
+	ID uuid.UUID
+}
+
+type updateOrganizationRequest struct {
+	ID uuid.UUID
+	organizationData
+}
+
+type memberRequest struct {
+	OrganizationID uuid.UUID
+	CustomerID     uuid.UUID
+}
+
+type changeMemberRoleRequest struct {
+	memberRequest
+	Role string `json:"role"`
+}
+
+type inviteMemberRequest struct {
+	OrganizationID uuid.UUID `json:"-"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+}
+
+type acceptInvitationRequest struct {
+	Token string `json:"token"`
+}
+
+type organizationData struct {
+	ID             string      `json:"id,omitempty"`
+	LegalName      string      `json:"legalName"`
+	BillingAddress addressData `json:"billingAddress"`
+	CreatedAt      time.Time   `json:"createdAt"`
+	UpdatedAt      time.Time   `json:"updatedAt"`
+}
+
+type addressData struct {
+	Line1      string `json:"line1"`
+	Line2      string `json:"line2,omitempty"`
+	City       string `json:"city"`
+	PostalCode string `json:"postalCode,omitempty"`
+	Region     string `json:"region,omitempty"`
+	Country    string `json:"country"`
+}
+
+type memberData struct {
+	OrganizationID string    `json:"organizationId"`
+	CustomerID     string    `json:"customerId"`
+	Role           string    `json:"role"`
+	JoinedAt       time.Time `json:"joinedAt"`
+}
+
+type membersResponse struct {
+	Members []memberData `json:"members"`
+}
+
+type invitationData struct {
+	ID             string `json:"id"`
+	OrganizationID string `json:"organizationId"`
+	Email          string `json:"email"`
+	Role           string `json:"role"`
+	// Token is returned only once, the caller delivers it to the invitee.
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeGetPreferencesEndpoint(preferences *application.PreferencesService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(preferencesRequest)
+		p, err := preferences.Get(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		return toPreferencesData(*p), nil
+	}
+}
+
+func makeUpdatePreferencesEndpoint(preferences *application.PreferencesService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(updatePreferencesRequest)
+		p, err := preferences.Update(ctx, req.ID, application.Preferences{
+			Locale:        req.Locale,
+			Timezone:      req.Timezone,
+			Currency:      req.Currency,
+			Notifications: req.Notifications,
+		})
+		if err != nil {
+			return nil, err
+		}
+		return toPreferencesData(*p), nil
+	}
+}
+
+func toPreferencesData(p application.Preferences) *preferencesData {
+	data := &preferencesData{
+		Locale:        p.Locale,
+		Timezone:      p.Timezone,
+		Currency:      p.Currency,
+		Notifications: p.Notifications,
+	}
+	if !p.UpdatedAt.IsZero() {
+		updatedAt := p.UpdatedAt
+		data.UpdatedAt = &updatedAt
+	}
+	return data
+}
+
+// withAcceptLanguage passes the Accept-Language header of a registration to the defaults of the preferences.
+func withAcceptLanguage(ctx context.Context, r *http.Request) context.Context {
+	return application.WithAcceptLanguage(ctx, r.Header.Get("Accept-Language"))
+}
+
+func decodePreferencesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return preferencesRequest{ID: id}, nil
+}
+
+func decodeUpdatePreferencesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	req := updatePreferencesRequest{ID: id}
+	if e := json.NewDecoder(r.Body).Decode(&req.preferencesData); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	return req, nil
+}
+
+type preferencesRequest struct {
+	ID uuid.UUID
+}
+
+type updatePreferencesRequest struct {
+	ID uuid.UUID
+	preferencesData
+}
+
+type preferencesData struct {
+	Locale        string              `json:"locale"`
+	Timezone      string              `json:"timezone"`
+	Currency      string              `json:"currency"`
+	Notifications map[string][]string `json:"notifications"`
+	UpdatedAt     *time.Time          `json:"updatedAt,omitempty"`
+}
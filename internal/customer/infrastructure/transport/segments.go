@@ -0,0 +1,220 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeListSegmentsEndpoint(segments *application.Segments) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		list, err := segments.Segments(ctx)
+		if err != nil {
+			return nil, err
+		}
+		response := &segmentsResponse{Segments: make([]segmentData, 0, len(list))}
+		for _, segment := range list {
+			response.Segments = append(response.Segments, toSegmentData(segment))
+		}
+		return response, nil
+	}
+}
+
+func makeGetSegmentEndpoint(segments *application.Segments) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(segmentRequest)
+		segment, err := segments.Segment(ctx, req.Name)
+		if err != nil {
+			return nil, err
+		}
+		data := toSegmentData(*segment)
+		return &data, nil
+	}
+}
+
+func makeDefineSegmentEndpoint(segments *application.Segments) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(segmentData)
+		segment, err := segments.Define(ctx, application.Segment{
+			Name:        req.Name,
+			Description: req.Description,
+			Rule:        req.Rule,
+		})
+		if err != nil {
+			return nil, err
+		}
+		data := toSegmentData(*segment)
+		return &data, nil
+	}
+}
+
+func makeDeleteSegmentEndpoint(segments *application.Segments) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(segmentRequest)
+		return nil, segments.Delete(ctx, req.Name)
+	}
+}
+
+func makeListSegmentMembersEndpoint(segments *application.Segments) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listSegmentMembersRequest)
+		members, err := segments.Members(ctx, req.Name, req.After, req.Limit)
+		if err != nil {
+			return nil, err
+		}
+		response := &segmentMembersResponse{Members: toSegmentMembershipData(members)}
+		if len(members) > 0 {
+			response.Next = members[len(members)-1].CustomerID.String()
+		}
+		return response, nil
+	}
+}
+
+func makeListCustomerSegmentsEndpoint(segments *application.Segments) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(customerSegmentsRequest)
+		memberships, err := segments.SegmentsOf(ctx, application.CustomerID(req.ID))
+		if err != nil {
+			return nil, err
+		}
+		return &customerSegmentsResponse{Segments: toSegmentMembershipData(memberships)}, nil
+	}
+}
+
+func toSegmentData(s application.Segment) segmentData {
+	createdAt, updatedAt := s.CreatedAt, s.UpdatedAt
+	return segmentData{
+		Name:               s.Name,
+		Description:        s.Description,
+		Rule:               s.Rule,
+		Members:            s.Members,
+		RebuildRequestedAt: s.RebuildRequestedAt,
+		CreatedAt:          &createdAt,
+		UpdatedAt:          &updatedAt,
+	}
+}
+
+func toSegmentMembershipData(memberships []application.SegmentMembership) []segmentMembershipData {
+	data := make([]segmentMembershipData, 0, len(memberships))
+	for _, membership := range memberships {
+		data = append(data, segmentMembershipData{
+			Segment:    membership.Segment,
+			CustomerID: membership.CustomerID.String(),
+			JoinedAt:   membership.JoinedAt,
+		})
+	}
+	return data
+}
+
+func decodeListSegmentsRequest(_ context.Context, _ *http.Request) (request interface{}, err error) {
+	return nil, nil
+}
+
+func decodeSegmentRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	name, ok := mux.Vars(r)["name"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return segmentRequest{Name: name}, nil
+}
+
+// decodeDefineSegmentRequest takes the name from the path, a name in the body is ignored.
+func decodeDefineSegmentRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	name, err := decodeSegmentRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	var req segmentData
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if req.Rule == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameter 'rule'")
+	}
+	req.Name = name.(segmentRequest).Name
+	return req, nil
+}
+
+func decodeListSegmentMembersRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	name, err := decodeSegmentRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := listSegmentMembersRequest{Name: name.(segmentRequest).Name}
+	query := r.URL.Query()
+	if value := query.Get("after"); value != "" {
+		after, err := uuid.FromString(value)
+		if err != nil {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'after'")
+		}
+		req.After = application.CustomerID(after)
+	}
+	if value := query.Get("limit"); value != "" {
+		if req.Limit, err = strconv.Atoi(value); err != nil || req.Limit < 0 {
+			return nil, errors.WithMessage(ErrBadRequest, "invalid parameter 'limit'")
+		}
+	}
+	return req, nil
+}
+
+func decodeCustomerSegmentsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return customerSegmentsRequest{ID: id}, nil
+}
+
+type segmentRequest struct {
+	Name string
+}
+
+type listSegmentMembersRequest struct {
+	Name  string
+	After application.CustomerID
+	Limit int
+}
+
+type customerSegmentsRequest struct {
+	ID uuid.UUID
+}
+
+type segmentsResponse struct {
+	Segments []segmentData `json:"segments"`
+}
+
+type segmentData struct {
+	Name               string     `json:"name"`
+	Description        string     `json:"description,omitempty"`
+	Rule               string     `json:"rule"`
+	Members            int        `json:"members"`
+	RebuildRequestedAt *time.Time `json:"rebuildRequestedAt,omitempty"`
+	CreatedAt          *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt          *time.Time `json:"updatedAt,omitempty"`
+}
+
+type segmentMembersResponse struct {
+	Members []segmentMembershipData `json:"members"`
+	// Next is the value of 'after' for the next page, empty when the page is empty.
+	Next string `json:"next,omitempty"`
+}
+
+type customerSegmentsResponse struct {
+	Segments []segmentMembershipData `json:"segments"`
+}
+
+type segmentMembershipData struct {
+	Segment    string    `json:"segment"`
+	CustomerID string    `json:"customerId"`
+	JoinedAt   time.Time `json:"joinedAt"`
+}
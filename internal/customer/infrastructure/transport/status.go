@@ -0,0 +1,98 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeChangeStatusEndpoint(s application.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(changeStatusRequest)
+		customer, err := s.ChangeStatus(ctx, req.ID, req.Status, req.Reason, req.Note)
+		if err != nil {
+			return nil, err
+		}
+		return &findCustomerResponse{toUserData(*customer)}, nil
+	}
+}
+
+func makeGetStatusHistoryEndpoint(s application.Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(statusHistoryRequest)
+		history, err := s.StatusHistory(ctx, req.ID)
+		if err != nil {
+			return nil, err
+		}
+		response := &statusHistoryResponse{Changes: make([]statusChangeData, 0, len(history))}
+		for _, change := range history {
+			response.Changes = append(response.Changes, statusChangeData{
+				From:      change.From,
+				To:        change.To,
+				Reason:    change.Reason,
+				Note:      change.Note,
+				Actor:     change.Actor,
+				ChangedAt: change.ChangedAt,
+			})
+		}
+		return response, nil
+	}
+}
+
+func decodeChangeStatusRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	req := changeStatusRequest{ID: id}
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if req.Status == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameter 'status'")
+	}
+	if req.Reason == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameter 'reason'")
+	}
+	return req, nil
+}
+
+func decodeStatusHistoryRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return statusHistoryRequest{ID: id}, nil
+}
+
+type changeStatusRequest struct {
+	ID     uuid.UUID `json:"-"`
+	Status string    `json:"status"`
+	Reason string    `json:"reason"`
+	Note   string    `json:"note"`
+}
+
+type statusHistoryRequest struct {
+	ID uuid.UUID
+}
+
+type statusHistoryResponse struct {
+	Changes []statusChangeData `json:"changes"`
+}
+
+type statusChangeData struct {
+	From      string    `json:"from"`
+	To        string    `json:"to"`
+	Reason    string    `json:"reason"`
+	Note      string    `json:"note,omitempty"`
+	Actor     string    `json:"actor"`
+	ChangedAt time.Time `json:"changedAt"`
+}
@@ -0,0 +1,101 @@
+package transport
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/jnikolaeva/eshop-common/uuid"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeListTagsEndpoint(tags *application.Tags) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		counts, err := tags.All(ctx)
+		if err != nil {
+			return nil, err
+		}
+		response := &tagCountsResponse{Tags: make([]tagCountData, 0, len(counts))}
+		for _, count := range counts {
+			response.Tags = append(response.Tags, tagCountData{Tag: count.Tag, Customers: count.Customers})
+		}
+		return response, nil
+	}
+}
+
+func makeGetCustomerTagsEndpoint(tags *application.Tags) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(customerTagsRequest)
+		customerTags, err := tags.TagsOf(ctx, application.CustomerID(req.ID))
+		if err != nil {
+			return nil, err
+		}
+		return &customerTagsResponse{Tags: customerTags}, nil
+	}
+}
+
+func makeTagCustomerEndpoint(tags *application.Tags) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(customerTagRequest)
+		customerTags, err := tags.Tag(ctx, application.CustomerID(req.ID), req.Tag)
+		if err != nil {
+			return nil, err
+		}
+		return &customerTagsResponse{Tags: customerTags}, nil
+	}
+}
+
+func makeUntagCustomerEndpoint(tags *application.Tags) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(customerTagRequest)
+		return nil, tags.Untag(ctx, application.CustomerID(req.ID), req.Tag)
+	}
+}
+
+func decodeListTagsRequest(_ context.Context, _ *http.Request) (request interface{}, err error) {
+	return nil, nil
+}
+
+func decodeCustomerTagsRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return customerTagsRequest{ID: id}, nil
+}
+
+func decodeCustomerTagRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	tag, ok := mux.Vars(r)["tag"]
+	if !ok {
+		return nil, ErrBadRouting
+	}
+	return customerTagRequest{ID: id, Tag: tag}, nil
+}
+
+type customerTagsRequest struct {
+	ID uuid.UUID
+}
+
+type customerTagRequest struct {
+	ID  uuid.UUID
+	Tag string
+}
+
+type customerTagsResponse struct {
+	Tags []string `json:"tags"`
+}
+
+type tagCountsResponse struct {
+	Tags []tagCountData `json:"tags"`
+}
+
+type tagCountData struct {
+	Tag       string `json:"tag"`
+	Customers int    `json:"customers"`
+}
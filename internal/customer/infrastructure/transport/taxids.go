@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeGetTaxIDEndpoint(taxIDs *application.TaxIDs) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(taxIDRequest)
+		taxID, err := taxIDs.Get(ctx, req.Holder)
+		if err != nil {
+			return nil, err
+		}
+		return toTaxIDData(*taxID), nil
+	}
+}
+
+func makeSetTaxIDEndpoint(taxIDs *application.TaxIDs) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setTaxIDRequest)
+		taxID, err := taxIDs.Set(ctx, req.Holder, req.Type, req.Value)
+		if err != nil {
+			return nil, err
+		}
+		return toTaxIDData(*taxID), nil
+	}
+}
+
+func makeVerifyTaxIDEndpoint(taxIDs *application.TaxIDs) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(taxIDRequest)
+		taxID, err := taxIDs.Verify(ctx, req.Holder)
+		if err != nil {
+			return nil, err
+		}
+		return toTaxIDData(*taxID), nil
+	}
+}
+
+func makeDeleteTaxIDEndpoint(taxIDs *application.TaxIDs) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(taxIDRequest)
+		return nil, taxIDs.Delete(ctx, req.Holder)
+	}
+}
+
+func toTaxIDData(t application.TaxID) *taxIDData {
+	return &taxIDData{
+		Type:      t.Type,
+		Value:     t.Value,
+		Country:   t.Country,
+		Status:    t.Status,
+		CheckedAt: t.CheckedAt,
+		UpdatedAt: t.UpdatedAt,
+	}
+}
+
+func decodeCustomerTaxIDRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := customerID(r)
+	if err != nil {
+		return nil, err
+	}
+	return taxIDRequest{Holder: application.TaxIDHolder{Kind: application.TaxIDHolderCustomer, ID: id}}, nil
+}
+
+func decodeOrganizationTaxIDRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := organizationID(r)
+	if err != nil {
+		return nil, err
+	}
+	return taxIDRequest{Holder: application.TaxIDHolder{Kind: application.TaxIDHolderOrganization, ID: id}}, nil
+}
+
+func decodeSetCustomerTaxIDRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	return decodeSetTaxIDRequest(ctx, r, decodeCustomerTaxIDRequest)
+}
+
+func decodeSetOrganizationTaxIDRequest(ctx context.Context, r *http.Request) (request interface{}, err error) {
+	return decodeSetTaxIDRequest(ctx, r, decodeOrganizationTaxIDRequest)
+}
+
+func decodeSetTaxIDRequest(ctx context.Context, r *http.Request, decodeHolder func(context.Context, *http.Request) (interface{}, error)) (interface{}, error) {
+	holder, err := decodeHolder(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	req := setTaxIDRequest{taxIDRequest: holder.(taxIDRequest)}
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if req.Type == "" || req.Value == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameters 'type' and 'value'")
+	}
+	return req, nil
+}
+
+type taxIDRequest struct {
+	Holder application.TaxIDHolder
+}
+
+type setTaxIDRequest struct {
+	taxIDRequest
+	Type  string `json:"type"`
+	Value string `json:"value"`
+}
+
+type taxIDData struct {
+	Type      string     `json:"type"`
+	Value     string     `json:"value"`
+	Country   string     `json:"country"`
+	Status    string     `json:"status"`
+	CheckedAt *time.Time `json:"checkedAt,omitempty"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+}
@@ -0,0 +1,189 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/pkg/errors"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+func makeCreateWebhookEndpoint(webhooks *application.Webhooks) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createWebhookRequest)
+		subscription, err := webhooks.Subscribe(ctx, req.URL, req.EventTypes, req.Secret)
+		if err != nil {
+			return nil, err
+		}
+		// the secret is returned once, the receiver needs it to verify the signatures
+		data := toWebhookData(*subscription)
+		data.Secret = subscription.Secret
+		return &data, nil
+	}
+}
+
+func makeListWebhooksEndpoint(webhooks *application.Webhooks) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		subscriptions, err := webhooks.Subscriptions(ctx)
+		if err != nil {
+			return nil, err
+		}
+		response := &listWebhooksResponse{Webhooks: make([]webhookData, 0, len(subscriptions))}
+		for _, subscription := range subscriptions {
+			response.Webhooks = append(response.Webhooks, toWebhookData(subscription))
+		}
+		return response, nil
+	}
+}
+
+func makeDeleteWebhookEndpoint(webhooks *application.Webhooks) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(webhookRequest)
+		return nil, webhooks.Unsubscribe(ctx, req.ID)
+	}
+}
+
+func makeListWebhookDeliveriesEndpoint(webhooks *application.Webhooks) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listWebhookDeliveriesRequest)
+		deliveries, err := webhooks.Deliveries(ctx, req.ID, req.Status)
+		if err != nil {
+			return nil, err
+		}
+		response := &listWebhookDeliveriesResponse{Deliveries: make([]webhookDeliveryData, 0, len(deliveries))}
+		for _, delivery := range deliveries {
+			response.Deliveries = append(response.Deliveries, toWebhookDeliveryData(delivery))
+		}
+		return response, nil
+	}
+}
+
+func makeRedeliverWebhookEndpoint(webhooks *application.Webhooks) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(webhookRequest)
+		return nil, webhooks.Redeliver(ctx, req.ID)
+	}
+}
+
+func toWebhookData(subscription application.WebhookSubscription) webhookData {
+	return webhookData{
+		ID:         subscription.ID.String(),
+		URL:        subscription.URL,
+		EventTypes: subscription.EventTypes,
+		CreatedAt:  subscription.CreatedAt,
+	}
+}
+
+func toWebhookDeliveryData(delivery application.WebhookDelivery) webhookDeliveryData {
+	data := webhookDeliveryData{
+		ID:             delivery.ID.String(),
+		EventType:      delivery.EventType,
+		Payload:        json.RawMessage(delivery.Payload),
+		Status:         delivery.Status,
+		Attempts:       delivery.Attempts,
+		LastStatusCode: delivery.LastStatusCode,
+		LastError:      delivery.LastError,
+		CreatedAt:      delivery.CreatedAt,
+		DeliveredAt:    delivery.DeliveredAt,
+	}
+	if delivery.Status == application.WebhookStatusPending {
+		nextAttemptAt := delivery.NextAttemptAt
+		data.NextAttemptAt = &nextAttemptAt
+	}
+	return data
+}
+
+func decodeCreateWebhookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	var req createWebhookRequest
+	if e := json.NewDecoder(r.Body).Decode(&req); e != nil && e != io.EOF {
+		return nil, errors.WithMessage(ErrBadRequest, "invalid request body")
+	}
+	if req.URL == "" {
+		return nil, errors.WithMessage(ErrBadRequest, "missing required parameter 'url'")
+	}
+	return req, nil
+}
+
+func decodeListWebhooksRequest(_ context.Context, _ *http.Request) (request interface{}, err error) {
+	return nil, nil
+}
+
+func decodeWebhookRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := webhookID(r)
+	if err != nil {
+		return nil, err
+	}
+	return webhookRequest{ID: id}, nil
+}
+
+func decodeListWebhookDeliveriesRequest(_ context.Context, r *http.Request) (request interface{}, err error) {
+	id, err := webhookID(r)
+	if err != nil {
+		return nil, err
+	}
+	return listWebhookDeliveriesRequest{ID: id, Status: r.URL.Query().Get("status")}, nil
+}
+
+func webhookID(r *http.Request) (uuid.UUID, error) {
+	sID, ok := mux.Vars(r)["id"]
+	if !ok {
+		return uuid.UUID{}, ErrBadRouting
+	}
+	id, err := uuid.FromString(sID)
+	if err != nil {
+		return uuid.UUID{}, errors.WithMessagef(ErrBadRequest, "invalid id '%s'", sID)
+	}
+	return id, nil
+}
+
+type createWebhookRequest struct {
+	URL        string   `json:"url"`
+	EventTypes []string `json:"eventTypes"`
+	// Secret is generated when it is empty.
+	Secret string `json:"secret"`
+}
+
+type webhookRequest struct {
+	ID uuid.UUID
+}
+
+type listWebhookDeliveriesRequest struct {
+	ID     uuid.UUID
+	Status string
+}
+
+type listWebhooksResponse struct {
+	Webhooks []webhookData `json:"webhooks"`
+}
+
+type listWebhookDeliveriesResponse struct {
+	Deliveries []webhookDeliveryData `json:"deliveries"`
+}
+
+type webhookData struct {
+	ID         string    `json:"id"`
+	URL        string    `json:"url"`
+	EventTypes []string  `json:"eventTypes"`
+	Secret     string    `json:"secret,omitempty"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type webhookDeliveryData struct {
+	ID             string          `json:"id"`
+	EventType      string          `json:"eventType"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  *time.Time      `json:"nextAttemptAt,omitempty"`
+	LastStatusCode int             `json:"lastStatusCode,omitempty"`
+	LastError      string          `json:"lastError,omitempty"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	DeliveredAt    *time.Time      `json:"deliveredAt,omitempty"`
+}
@@ -0,0 +1,29 @@
+package webhook
+
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+type Config struct {
+	MaxAttempts    int           `envconfig:"WEBHOOK_MAX_ATTEMPTS" default:"8"` // attempts before a delivery is dead
+	InitialBackoff time.Duration `envconfig:"WEBHOOK_INITIAL_BACKOFF" default:"10s"`
+	MaxBackoff     time.Duration `envconfig:"WEBHOOK_MAX_BACKOFF" default:"1h"`
+	Timeout        time.Duration `envconfig:"WEBHOOK_TIMEOUT" default:"10s"` // timeout of a single attempt
+	PollInterval   time.Duration `envconfig:"WEBHOOK_POLL_INTERVAL" default:"2s"`
+	BatchSize      int           `envconfig:"WEBHOOK_BATCH_SIZE" default:"20"`
+	Concurrency    int           `envconfig:"WEBHOOK_CONCURRENCY" default:"4"`
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse webhook environment config values")
+	}
+	if config.MaxAttempts < 1 || config.BatchSize < 1 || config.Concurrency < 1 {
+		return Config{}, errors.New("WEBHOOK_MAX_ATTEMPTS, WEBHOOK_BATCH_SIZE and WEBHOOK_CONCURRENCY must be positive")
+	}
+	return config, nil
+}
@@ -0,0 +1,140 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+
+	"github.com/jnikolaeva/customerservice/internal/customer/application"
+)
+
+const (
+	deliveryIDHeader = "X-Webhook-Id"
+	eventTypeHeader  = "X-Webhook-Event"
+	// maxResponseSize is read from the receiver to reuse the connection.
+	maxResponseSize = 64 * 1024
+)
+
+// Dispatcher sends due deliveries and records the outcome of every attempt.
+// Deliveries are claimed with a lease, so several instances may dispatch concurrently.
+type Dispatcher struct {
+	repo       application.WebhookRepository
+	client     *http.Client
+	config     Config
+	policy     application.WebhookRetryPolicy
+	deliveries metrics.Counter // labels: outcome
+	logger     logrus.FieldLogger
+}
+
+func NewDispatcher(repo application.WebhookRepository, config Config, deliveries metrics.Counter, logger logrus.FieldLogger) *Dispatcher {
+	return &Dispatcher{
+		repo: repo,
+		client: &http.Client{
+			Timeout:   config.Timeout,
+			Transport: otelhttp.NewTransport(http.DefaultTransport),
+			// a redirect would resend the signed payload to another receiver
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		config: config,
+		policy: application.WebhookRetryPolicy{
+			MaxAttempts:    config.MaxAttempts,
+			InitialBackoff: config.InitialBackoff,
+			MaxBackoff:     config.MaxBackoff,
+		},
+		deliveries: deliveries,
+		logger:     logger,
+	}
+}
+
+// Run dispatches until ctx is canceled. A full batch is followed by the next one without waiting.
+func (d *Dispatcher) Run(ctx context.Context) error {
+	for {
+		claimed, err := d.repo.ClaimDue(ctx, d.config.BatchSize, d.lease())
+		if err != nil && ctx.Err() == nil {
+			d.logger.WithError(err).Warn("failed to claim webhook deliveries")
+		}
+		d.dispatch(ctx, claimed)
+		if len(claimed) == d.config.BatchSize {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(d.config.PollInterval):
+		}
+	}
+}
+
+// lease covers the attempts of a whole batch, so that a claimed delivery is not claimed again meanwhile.
+func (d *Dispatcher) lease() time.Duration {
+	rounds := (d.config.BatchSize + d.config.Concurrency - 1) / d.config.Concurrency
+	return time.Duration(rounds+1) * d.config.Timeout
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context, claimed []application.ClaimedDelivery) {
+	semaphore := make(chan struct{}, d.config.Concurrency)
+	var wg sync.WaitGroup
+	for _, delivery := range claimed {
+		semaphore <- struct{}{}
+		wg.Add(1)
+		go func(delivery application.ClaimedDelivery) {
+			defer func() {
+				<-semaphore
+				wg.Done()
+			}()
+			d.attempt(ctx, delivery)
+		}(delivery)
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) attempt(ctx context.Context, claimed application.ClaimedDelivery) {
+	statusCode, err := d.send(ctx, claimed)
+	if ctx.Err() != nil {
+		// the lease expires and the delivery is attempted again, possibly by another instance
+		return
+	}
+	delivery := claimed.WebhookDelivery
+	delivery.RecordAttempt(statusCode, err, time.Now().UTC(), d.policy)
+	d.deliveries.With("outcome", delivery.Status).Add(1)
+	logger := d.logger.WithFields(logrus.Fields{
+		"delivery":     delivery.ID.String(),
+		"subscription": delivery.SubscriptionID.String(),
+		"attempts":     delivery.Attempts,
+		"status":       delivery.Status,
+	})
+	if delivery.Status == application.WebhookStatusDead {
+		logger.WithField("error", delivery.LastError).Warn("webhook delivery is dead")
+	}
+	// the update is not bound to ctx, so that the outcome of a finished attempt is kept on shutdown
+	if err := d.repo.UpdateDelivery(context.Background(), delivery); err != nil {
+		logger.WithError(err).Error("failed to record webhook delivery attempt")
+	}
+}
+
+func (d *Dispatcher) send(ctx context.Context, claimed application.ClaimedDelivery) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, claimed.URL, bytes.NewReader(claimed.Payload))
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(deliveryIDHeader, claimed.ID.String())
+	req.Header.Set(eventTypeHeader, claimed.EventType)
+	req.Header.Set(SignatureHeader, Sign(claimed.Secret, time.Now(), claimed.Payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, maxResponseSize))
+	return resp.StatusCode, nil
+}
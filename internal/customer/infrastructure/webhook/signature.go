@@ -0,0 +1,23 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// SignatureHeader carries the timestamp and the HMAC-SHA256 of "<timestamp>.<body>" keyed with
+// the subscription secret, e.g. "t=1602000000,v1=5257a869...". Receivers should reject old timestamps
+// to prevent replays.
+const SignatureHeader = "X-Webhook-Signature"
+
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + t + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
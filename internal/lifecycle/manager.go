@@ -0,0 +1,182 @@
+package lifecycle
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Exit codes of the process. Startup failures are reported by logrus.Fatal, which exits with 1.
+const (
+	ExitOK              = 0
+	ExitStartupFailure  = 1
+	ExitServerFailure   = 2
+	ExitShutdownTimeout = 3
+)
+
+type Config struct {
+	ReadTimeout       time.Duration `envconfig:"APP_READ_TIMEOUT" default:"10s"`
+	ReadHeaderTimeout time.Duration `envconfig:"APP_READ_HEADER_TIMEOUT" default:"5s"`
+	WriteTimeout      time.Duration `envconfig:"APP_WRITE_TIMEOUT" default:"30s"`
+	IdleTimeout       time.Duration `envconfig:"APP_IDLE_TIMEOUT" default:"120s"`
+	PreStopDelay      time.Duration `envconfig:"APP_PRE_STOP_DELAY" default:"5s"`       // time for load balancers to notice the failing readiness probe
+	DrainTimeout      time.Duration `envconfig:"APP_DRAIN_TIMEOUT" default:"20s"`       // deadline for in-flight requests
+	WorkerStopTimeout time.Duration `envconfig:"APP_WORKER_STOP_TIMEOUT" default:"10s"` // deadline for background workers, after the requests
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse lifecycle environment config values")
+	}
+	return config, nil
+}
+
+// WorkerFunc runs a background job until its context is canceled.
+type WorkerFunc func(ctx context.Context) error
+
+type worker struct {
+	name string
+	run  WorkerFunc
+}
+
+type closer struct {
+	name  string
+	close func()
+}
+
+// Manager serves HTTP and runs background workers until a termination signal,
+// then shuts everything down in order: shutdown hooks, pre-stop delay, connection draining,
+// workers and finally closers in reverse registration order.
+type Manager struct {
+	config  Config
+	logger  *logrus.Logger
+	server  *http.Server
+	hooks   []func()
+	workers []worker
+	closers []closer
+}
+
+func NewManager(config Config, serverAddr string, handler http.Handler, logger *logrus.Logger) *Manager {
+	return &Manager{
+		config: config,
+		logger: logger,
+		server: &http.Server{
+			Addr:              serverAddr,
+			Handler:           handler,
+			ReadTimeout:       config.ReadTimeout,
+			ReadHeaderTimeout: config.ReadHeaderTimeout,
+			WriteTimeout:      config.WriteTimeout,
+			IdleTimeout:       config.IdleTimeout,
+		},
+	}
+}
+
+// OnShutdown registers a hook called as soon as the shutdown begins.
+func (m *Manager) OnShutdown(hook func()) {
+	m.hooks = append(m.hooks, hook)
+}
+
+func (m *Manager) AddWorker(name string, run WorkerFunc) {
+	m.workers = append(m.workers, worker{name: name, run: run})
+}
+
+func (m *Manager) AddCloser(name string, close func()) {
+	m.closers = append(m.closers, closer{name: name, close: close})
+}
+
+// Run blocks until the service is stopped and returns the process exit code.
+func (m *Manager) Run() int {
+	exitCode := ExitOK
+
+	serverErr := make(chan error, 1)
+	go func() {
+		m.logger.WithFields(logrus.Fields{"url": m.server.Addr}).Info("starting the server")
+		if err := m.server.ListenAndServe(); err != http.ErrServerClosed {
+			serverErr <- err
+		}
+	}()
+
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workersDone := m.startWorkers(workersCtx)
+
+	killSignalChan := make(chan os.Signal, 1)
+	signal.Notify(killSignalChan, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case sig := <-killSignalChan:
+		m.logger.WithFields(logrus.Fields{"signal": sig.String()}).Info("shutting down")
+		for _, hook := range m.hooks {
+			hook()
+		}
+		time.Sleep(m.config.PreStopDelay)
+	case err := <-serverErr:
+		m.logger.WithError(err).Error("server failed")
+		exitCode = ExitServerFailure
+		for _, hook := range m.hooks {
+			hook()
+		}
+	}
+
+	drainCtx, cancelDrain := context.WithTimeout(context.Background(), m.config.DrainTimeout)
+	defer cancelDrain()
+
+	if err := m.server.Shutdown(drainCtx); err != nil {
+		m.logger.WithError(err).Error("failed to drain connections")
+		_ = m.server.Close()
+		if exitCode == ExitOK {
+			exitCode = ExitShutdownTimeout
+		}
+	}
+
+	// workers get a deadline of their own, so that slow requests do not leave them without time to stop
+	workersStopCtx, cancelWorkersStop := context.WithTimeout(context.Background(), m.config.WorkerStopTimeout)
+	defer cancelWorkersStop()
+
+	stopWorkers()
+	select {
+	case <-workersDone:
+	case <-workersStopCtx.Done():
+		m.logger.Error("background workers did not stop in time")
+		if exitCode == ExitOK {
+			exitCode = ExitShutdownTimeout
+		}
+	}
+
+	for i := len(m.closers) - 1; i >= 0; i-- {
+		m.logger.WithFields(logrus.Fields{"resource": m.closers[i].name}).Info("closing")
+		m.closers[i].close()
+	}
+
+	m.logger.WithFields(logrus.Fields{"exitCode": exitCode}).Info("stopped")
+	return exitCode
+}
+
+func (m *Manager) startWorkers(ctx context.Context) <-chan struct{} {
+	var wg sync.WaitGroup
+	for _, w := range m.workers {
+		wg.Add(1)
+		go func(w worker) {
+			defer wg.Done()
+			m.logger.WithFields(logrus.Fields{"worker": w.name}).Info("starting worker")
+			if err := w.run(ctx); err != nil && ctx.Err() == nil {
+				m.logger.WithError(err).WithFields(logrus.Fields{"worker": w.name}).Error("worker failed")
+			}
+		}(w)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	return done
+}
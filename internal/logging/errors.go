@@ -0,0 +1,22 @@
+package logging
+
+import (
+	"context"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ErrorHandler reports errors of go-kit transports.
+type ErrorHandler struct {
+	logger *logrus.Logger
+}
+
+func NewErrorHandler(logger *logrus.Logger) *ErrorHandler {
+	return &ErrorHandler{
+		logger: logger,
+	}
+}
+
+func (h *ErrorHandler) Handle(ctx context.Context, err error) {
+	FromContext(ctx, h.logger).WithError(err).Error("request failed")
+}
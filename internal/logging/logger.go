@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	fieldAppName   = "appName"
+	fieldRequestID = "requestId"
+)
+
+type Config struct {
+	Level string `envconfig:"LOG_LEVEL" default:"info"`
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse logging environment config values")
+	}
+	if _, err := logrus.ParseLevel(config.Level); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse log level")
+	}
+	return config, nil
+}
+
+// New creates the JSON logger shared by the whole service. Personal data is masked in every entry.
+func New(appName string, config Config) *logrus.Logger {
+	logger := logrus.New()
+	logger.SetOutput(os.Stdout)
+	logger.SetFormatter(&maskingFormatter{
+		next: &logrus.JSONFormatter{
+			TimestampFormat: time.RFC3339Nano,
+			FieldMap: logrus.FieldMap{
+				logrus.FieldKeyTime: "@timestamp",
+				logrus.FieldKeyMsg:  "message",
+			},
+		},
+		appName: appName,
+	})
+	level, err := logrus.ParseLevel(config.Level)
+	if err != nil {
+		level = logrus.InfoLevel
+	}
+	logger.SetLevel(level)
+	return logger
+}
+
+// FromContext returns an entry correlated with the current request.
+func FromContext(ctx context.Context, logger logrus.FieldLogger) *logrus.Entry {
+	entry := logger.WithFields(logrus.Fields{})
+	if requestID := RequestID(ctx); requestID != "" {
+		entry = entry.WithField(fieldRequestID, requestID)
+	}
+	return entry
+}
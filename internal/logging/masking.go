@@ -0,0 +1,66 @@
+package logging
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+const mask = "***"
+
+// piiFields are masked regardless of their value.
+var piiFields = map[string]bool{
+	"email":     true,
+	"phone":     true,
+	"firstname": true,
+	"lastname":  true,
+	"username":  true,
+	"password":  true,
+}
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9.\-]+\.[A-Za-z]{2,}`)
+	// only international numbers are recognized, so that IDs and durations stay readable
+	phonePattern = regexp.MustCompile(`\+\d[\d\-\s()]{6,}\d`)
+)
+
+type maskingFormatter struct {
+	next    logrus.Formatter
+	appName string
+}
+
+func (f *maskingFormatter) Format(entry *logrus.Entry) ([]byte, error) {
+	data := make(logrus.Fields, len(entry.Data)+1)
+	data[fieldAppName] = f.appName
+	for key, value := range entry.Data {
+		data[key] = maskField(key, value)
+	}
+	masked := *entry
+	masked.Data = data
+	masked.Message = MaskString(entry.Message)
+	return f.next.Format(&masked)
+}
+
+func maskField(key string, value interface{}) interface{} {
+	if piiFields[strings.ToLower(key)] {
+		return mask
+	}
+	switch v := value.(type) {
+	case string:
+		return MaskString(v)
+	case error:
+		return MaskString(v.Error())
+	case fmt.Stringer:
+		return MaskString(v.String())
+	default:
+		return value
+	}
+}
+
+// MaskString hides email addresses and phone numbers in free text.
+func MaskString(s string) string {
+	s = emailPattern.ReplaceAllString(s, mask)
+	return phonePattern.ReplaceAllString(s, mask)
+}
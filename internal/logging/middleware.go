@@ -0,0 +1,103 @@
+package logging
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/jnikolaeva/eshop-common/uuid"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	RequestIDHeader = "X-Request-Id"
+
+	maxRequestIDLength = 128
+)
+
+type requestIDContextKeyType string
+
+const requestIDContextKey requestIDContextKeyType = "requestID"
+
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey, requestID)
+}
+
+func RequestID(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey).(string)
+	return requestID
+}
+
+// RequestIDMiddleware takes the correlation ID from the request or generates a new one, and echoes it back.
+func RequestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestID := r.Header.Get(RequestIDHeader)
+		if !isValidRequestID(requestID) {
+			requestID = uuid.Generate().String()
+		}
+		w.Header().Set(RequestIDHeader, requestID)
+		next.ServeHTTP(w, r.WithContext(WithRequestID(r.Context(), requestID)))
+	})
+}
+
+func isValidRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > maxRequestIDLength {
+		return false
+	}
+	for _, c := range requestID {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+	size       int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.statusCode = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	n, err := r.ResponseWriter.Write(b)
+	r.size += n
+	return n, err
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// AccessLogMiddleware logs every request. Requests to the given quiet paths, such as probes, are logged at debug level.
+func AccessLogMiddleware(next http.Handler, logger *logrus.Logger, quietPaths ...string) http.Handler {
+	quiet := make(map[string]bool, len(quietPaths))
+	for _, path := range quietPaths {
+		quiet[path] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		start := time.Now()
+
+		next.ServeHTTP(recorder, r)
+
+		entry := FromContext(r.Context(), logger).WithFields(logrus.Fields{
+			"method":     r.Method,
+			"path":       r.URL.Path,
+			"status":     recorder.statusCode,
+			"size":       recorder.size,
+			"durationMs": time.Since(start).Milliseconds(),
+			"remoteAddr": r.RemoteAddr,
+		})
+		if quiet[r.URL.Path] {
+			entry.Debug("request handled")
+		} else {
+			entry.Info("request handled")
+		}
+	})
+}
@@ -0,0 +1,250 @@
+package migration
+
+import (
+	"context"
+
+	"github.com/jackc/pgx"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// advisoryLockID identifies the migration lock among other advisory locks of the database.
+const advisoryLockID = 7346120385
+
+var ErrDirty = errors.New("schema is dirty, fix it manually and force the version")
+
+// Runner applies migrations. It keeps the version in the schema_migrations table
+// in the format of golang-migrate, so that databases migrated with it can be taken over.
+// Every migration runs in a transaction together with the version change,
+// and concurrent runners are serialized with an advisory lock.
+type Runner struct {
+	connPool   *pgx.ConnPool
+	migrations []Migration
+	logger     logrus.FieldLogger
+}
+
+type Status struct {
+	Version int64
+	Dirty   bool
+	Latest  int64
+	Pending []Migration
+}
+
+func NewRunner(connPool *pgx.ConnPool, migrations []Migration, logger logrus.FieldLogger) *Runner {
+	return &Runner{
+		connPool:   connPool,
+		migrations: migrations,
+		logger:     logger,
+	}
+}
+
+// Latest returns the version the binary is built against.
+func (r *Runner) Latest() int64 {
+	if len(r.migrations) == 0 {
+		return 0
+	}
+	return r.migrations[len(r.migrations)-1].Version
+}
+
+func (r *Runner) Status(ctx context.Context) (Status, error) {
+	conn, err := r.connPool.AcquireEx(ctx)
+	if err != nil {
+		return Status{}, errors.Wrap(err, "failed to acquire connection")
+	}
+	defer r.connPool.Release(conn)
+
+	version, dirty, err := r.version(ctx, conn)
+	if err != nil {
+		return Status{}, err
+	}
+	status := Status{Version: version, Dirty: dirty, Latest: r.Latest()}
+	for _, m := range r.migrations {
+		if m.Version > version {
+			status.Pending = append(status.Pending, m)
+		}
+	}
+	return status, nil
+}
+
+// Check fails when the schema is dirty or behind the binary. A newer schema is accepted,
+// so that instances of the previous release keep serving during a rollout.
+func (r *Runner) Check(ctx context.Context) error {
+	status, err := r.Status(ctx)
+	if err != nil {
+		return err
+	}
+	if status.Dirty {
+		return errors.Wrapf(ErrDirty, "version %d", status.Version)
+	}
+	if status.Version < status.Latest {
+		return errors.Errorf("schema version %d is behind expected %d", status.Version, status.Latest)
+	}
+	return nil
+}
+
+func (r *Runner) Up(ctx context.Context) error {
+	return r.Goto(ctx, r.Latest())
+}
+
+// Down reverts the given number of applied migrations.
+func (r *Runner) Down(ctx context.Context, steps int) error {
+	return r.withLock(ctx, func(conn *pgx.Conn) error {
+		version, dirty, err := r.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+		target := version
+		for i := 0; i < steps; i++ {
+			target = r.previous(target)
+		}
+		return r.migrate(ctx, conn, version, target)
+	})
+}
+
+// Goto migrates up or down to the given version, 0 reverts all migrations.
+func (r *Runner) Goto(ctx context.Context, target int64) error {
+	if target != 0 && r.find(target) < 0 {
+		return errors.Errorf("unknown migration version %d", target)
+	}
+	return r.withLock(ctx, func(conn *pgx.Conn) error {
+		version, dirty, err := r.version(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if dirty {
+			return ErrDirty
+		}
+		return r.migrate(ctx, conn, version, target)
+	})
+}
+
+// Force records the version without running any migration, to recover from a dirty schema.
+func (r *Runner) Force(ctx context.Context, version int64) error {
+	return r.withLock(ctx, func(conn *pgx.Conn) error {
+		tx, err := conn.BeginEx(ctx, nil)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		defer func() { _ = tx.Rollback() }()
+		if err := setVersion(ctx, tx, version); err != nil {
+			return err
+		}
+		return errors.WithStack(tx.CommitEx(ctx))
+	})
+}
+
+func (r *Runner) migrate(ctx context.Context, conn *pgx.Conn, version, target int64) error {
+	if target == version {
+		r.logger.WithFields(logrus.Fields{"version": version}).Info("schema is up to date")
+		return nil
+	}
+	if target > version {
+		for _, m := range r.migrations {
+			if m.Version > version && m.Version <= target {
+				if err := r.apply(ctx, conn, m.Up, m.Version, m); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	for i := len(r.migrations) - 1; i >= 0; i-- {
+		m := r.migrations[i]
+		if m.Version <= version && m.Version > target {
+			if err := r.apply(ctx, conn, m.Down, r.previous(m.Version), m); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (r *Runner) apply(ctx context.Context, conn *pgx.Conn, script string, newVersion int64, m Migration) error {
+	logger := r.logger.WithFields(logrus.Fields{"migration": m.Name, "version": m.Version, "newVersion": newVersion})
+	logger.Info("applying migration")
+
+	tx, err := conn.BeginEx(ctx, nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if _, err := tx.ExecEx(ctx, script, nil); err != nil {
+		return errors.Wrapf(err, "migration %d_%s failed", m.Version, m.Name)
+	}
+	if err := setVersion(ctx, tx, newVersion); err != nil {
+		return err
+	}
+	return errors.WithStack(tx.CommitEx(ctx))
+}
+
+func (r *Runner) withLock(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := r.connPool.AcquireEx(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to acquire connection")
+	}
+	defer r.connPool.Release(conn)
+
+	if _, err := conn.ExecEx(ctx, "SELECT pg_advisory_lock($1)", nil, advisoryLockID); err != nil {
+		return errors.Wrap(err, "failed to acquire migration lock")
+	}
+	defer func() {
+		// the lock must be released even if ctx is done, the connection returns to the pool
+		_, _ = conn.Exec("SELECT pg_advisory_unlock($1)", advisoryLockID)
+	}()
+
+	if _, err := conn.ExecEx(ctx, "CREATE TABLE IF NOT EXISTS schema_migrations (version BIGINT NOT NULL PRIMARY KEY, dirty BOOLEAN NOT NULL)", nil); err != nil {
+		return errors.Wrap(err, "failed to create schema_migrations table")
+	}
+	return fn(conn)
+}
+
+func (r *Runner) version(ctx context.Context, conn *pgx.Conn) (version int64, dirty bool, err error) {
+	var exists bool
+	if err := conn.QueryRowEx(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL", nil).Scan(&exists); err != nil {
+		return 0, false, errors.Wrap(err, "failed to read schema version")
+	}
+	if !exists {
+		return 0, false, nil
+	}
+	err = conn.QueryRowEx(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1", nil).Scan(&version, &dirty)
+	if err == pgx.ErrNoRows {
+		return 0, false, nil
+	}
+	return version, dirty, errors.Wrap(err, "failed to read schema version")
+}
+
+// previous returns the version of the migration applied before the given one, 0 if there is none.
+func (r *Runner) previous(version int64) int64 {
+	var previous int64
+	for _, m := range r.migrations {
+		if m.Version >= version {
+			break
+		}
+		previous = m.Version
+	}
+	return previous
+}
+
+func (r *Runner) find(version int64) int {
+	for i, m := range r.migrations {
+		if m.Version == version {
+			return i
+		}
+	}
+	return -1
+}
+
+func setVersion(ctx context.Context, tx *pgx.Tx, version int64) error {
+	if _, err := tx.ExecEx(ctx, "DELETE FROM schema_migrations", nil); err != nil {
+		return errors.Wrap(err, "failed to update schema version")
+	}
+	if version == 0 {
+		return nil
+	}
+	_, err := tx.ExecEx(ctx, "INSERT INTO schema_migrations (version, dirty) VALUES ($1, false)", nil, version)
+	return errors.Wrap(err, "failed to update schema version")
+}
@@ -1,12 +1,20 @@
 package probes
 
-import "net/http"
+import (
+	"encoding/json"
+	"net/http"
+)
 
-func MakeReadyHandler() http.Handler {
+func MakeReadyHandler(readiness *Readiness) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := readiness.report(r.Context())
 		w.Header().Set("Content-Type", "application/json; charset=UTF-8")
-		w.WriteHeader(http.StatusOK)
-		_, _ = w.Write([]byte("{\"status\": \"OK\"}"))
+		if report.Status == statusOK {
+			w.WriteHeader(http.StatusOK)
+		} else {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		_ = json.NewEncoder(w).Encode(report)
 	})
 }
 
@@ -0,0 +1,124 @@
+package probes
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+)
+
+const (
+	statusOK   = "OK"
+	statusFail = "FAIL"
+)
+
+var errShuttingDown = errors.New("server is shutting down")
+
+// CheckFunc reports whether a dependency is usable.
+type CheckFunc func(ctx context.Context) error
+
+type Config struct {
+	CheckTimeout time.Duration `envconfig:"READINESS_CHECK_TIMEOUT" default:"2s"`
+	CacheTTL     time.Duration `envconfig:"READINESS_CACHE_TTL" default:"5s"` // how long a check result is reused
+}
+
+func ParseEnvConfig(prefix string) (Config, error) {
+	var config Config
+	if err := envconfig.Process(prefix, &config); err != nil {
+		return Config{}, errors.Wrap(err, "failed to parse readiness probe environment config values")
+	}
+	return config, nil
+}
+
+// Readiness runs the registered checks. It reports failure as soon as the shutdown begins,
+// so that no new traffic is routed to the instance while it drains connections.
+type Readiness struct {
+	config       Config
+	checks       []*check
+	shuttingDown int32
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+
+	mu        sync.Mutex
+	result    checkResult
+	checkedAt time.Time
+}
+
+type checkResult struct {
+	Status     string `json:"status"`
+	DurationMs int64  `json:"durationMs"`
+	Error      string `json:"error,omitempty"`
+}
+
+type readinessReport struct {
+	Status string                 `json:"status"`
+	Error  string                 `json:"error,omitempty"`
+	Checks map[string]checkResult `json:"checks,omitempty"`
+}
+
+func NewReadiness(config Config) *Readiness {
+	return &Readiness{config: config}
+}
+
+// Register adds a check. It must not be called once the probe is served.
+func (r *Readiness) Register(name string, fn CheckFunc) {
+	r.checks = append(r.checks, &check{name: name, fn: fn})
+}
+
+func (r *Readiness) Shutdown() {
+	atomic.StoreInt32(&r.shuttingDown, 1)
+}
+
+func (r *Readiness) report(ctx context.Context) readinessReport {
+	if atomic.LoadInt32(&r.shuttingDown) == 1 {
+		return readinessReport{Status: statusFail, Error: errShuttingDown.Error()}
+	}
+
+	results := make([]checkResult, len(r.checks))
+	var wg sync.WaitGroup
+	for i, c := range r.checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run(ctx, r.config)
+		}(i, c)
+	}
+	wg.Wait()
+
+	report := readinessReport{Status: statusOK, Checks: make(map[string]checkResult, len(r.checks))}
+	for i, c := range r.checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != statusOK {
+			report.Status = statusFail
+		}
+	}
+	return report
+}
+
+func (c *check) run(ctx context.Context, config Config) checkResult {
+	// concurrent probes wait for the running check instead of hitting the dependency again
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.checkedAt.IsZero() && time.Since(c.checkedAt) < config.CacheTTL {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, config.CheckTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.fn(ctx)
+	c.result = checkResult{Status: statusOK, DurationMs: time.Since(start).Milliseconds()}
+	if err != nil {
+		c.result.Status = statusFail
+		c.result.Error = err.Error()
+	}
+	c.checkedAt = time.Now()
+	return c.result
+}